@@ -0,0 +1,89 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFdsStart is the first file descriptor passed
+// by socket activation.
+var listenFdsStart = 3 // used by tests
+
+// ActivationFiles returns the files of the sockets passed to the
+// process by socket activation, as specified by systemd's LISTEN_FDS,
+// LISTEN_PID and LISTEN_FDNAMES environment variables. The files are
+// named by LISTEN_FDNAMES, if set. It returns nil if no sockets were
+// passed to this process. If unsetEnv is true, the variables are
+// unset so that they aren't inherited by child processes.
+func ActivationFiles(unsetEnv bool) []*os.File {
+	if unsetEnv {
+		defer func() {
+			os.Unsetenv("LISTEN_PID")
+			os.Unsetenv("LISTEN_FDS")
+			os.Unsetenv("LISTEN_FDNAMES")
+		}()
+	}
+	pid := os.Getenv("LISTEN_PID")
+	if p, i, ok := dtoi(pid, 0); !ok || i != len(pid) || p != os.Getpid() {
+		return nil
+	}
+	fds := os.Getenv("LISTEN_FDS")
+	n, i, ok := dtoi(fds, 0)
+	if !ok || i != len(fds) || n == 0 {
+		return nil
+	}
+	var names []string
+	if s := os.Getenv("LISTEN_FDNAMES"); s != "" {
+		names = splitAtBytes(s, ":")
+	}
+	files := make([]*os.File, n)
+	for i := range files {
+		fd := listenFdsStart + i
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) {
+			name = names[i]
+		}
+		files[i] = os.NewFile(uintptr(fd), name)
+	}
+	return files
+}
+
+// ActivationListeners returns listeners for the stream sockets and
+// connections for the datagram sockets passed to the process by
+// socket activation, as described by ActivationFiles, such as
+// *net.TCPListeners and *net.UDPConns. The environment variables
+// are unset. A socket that can't be used is closed and its error
+// is returned after the others are tried.
+func ActivationListeners() ([]net.Listener, []net.PacketConn, error) {
+	var (
+		lns   []net.Listener
+		pcs   []net.PacketConn
+		first error
+	)
+	for _, f := range ActivationFiles(true) {
+		if ln, err := net.FileListener(f); err == nil {
+			lns = append(lns, ln)
+		} else if pc, perr := net.FilePacketConn(f); perr == nil {
+			pcs = append(pcs, pc)
+		} else if first == nil {
+			first = err
+		}
+		f.Close()
+	}
+	return lns, pcs, first
+}
+
+// FileConn returns a connection for the socket with the file
+// descriptor fd inherited from the parent process, such as a
+// *net.TCPConn, *net.UDPConn or *net.UnixConn. The descriptor is
+// closed; the connection uses a duplicate of it.
+func FileConn(fd uintptr, name string) (net.Conn, error) {
+	f := os.NewFile(fd, name)
+	defer f.Close()
+	return net.FileConn(f)
+}
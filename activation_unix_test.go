@@ -0,0 +1,90 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package nett
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+// activate sets the environment as if the socket of c, which must
+// have a File method, was passed to the process by socket activation.
+func activate(t *testing.T, c interface{ File() (*os.File, error) }, name string) {
+	f, err := c.File()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+	// Duplicate the descriptor, which is owned by f.
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	listenFdsStart = fd
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "1")
+	os.Setenv("LISTEN_FDNAMES", name)
+}
+
+func TestActivationListeners(t *testing.T) {
+	defer func(start int) { listenFdsStart = start }(listenFdsStart)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+	activate(t, ln.(*net.TCPListener), "http")
+	files := ActivationFiles(false)
+	if len(files) != 1 || files[0].Name() != "http" {
+		t.Fatalf("unexpected files: %v", files)
+	}
+	files[0].Close()
+
+	activate(t, ln.(*net.TCPListener), "http")
+	lns, pcs, err := ActivationListeners()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(lns) != 1 || len(pcs) != 0 {
+		t.Fatalf("expected 1 listener; got %v and %v", lns, pcs)
+	}
+	defer lns[0].Close()
+	if _, ok := lns[0].(*net.TCPListener); !ok {
+		t.Fatalf("expected *net.TCPListener; got %T", lns[0])
+	}
+	if got, want := lns[0].Addr().String(), ln.Addr().String(); got != want {
+		t.Fatalf("expected %s; got %s", want, got)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Fatal("expected the environment to be unset")
+	}
+	if files := ActivationFiles(false); files != nil {
+		t.Fatalf("expected no files; got %v", files)
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Close()
+	activate(t, pc.(*net.UDPConn), "dns")
+	lns, pcs, err = ActivationListeners()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(lns) != 0 || len(pcs) != 1 {
+		t.Fatalf("expected 1 packet conn; got %v and %v", lns, pcs)
+	}
+	defer pcs[0].Close()
+	if _, ok := pcs[0].(*net.UDPConn); !ok {
+		t.Fatalf("expected *net.UDPConn; got %T", pcs[0])
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when dialing an address whose circuit
+// is open because its previous connection attempts failed.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// A CircuitBreaker short-circuits connection attempts to addresses
+// that have failed repeatedly. Once an address's circuit is open,
+// attempts fail with ErrCircuitOpen until its cooldown has passed.
+// Then a single attempt is allowed: if it succeeds, the circuit is
+// closed; otherwise, it stays open for another cooldown.
+//
+// Its methods are safe for concurrent use.
+type CircuitBreaker struct {
+	// Threshold is the number of consecutive failed connection
+	// attempts that opens an address's circuit.
+	//
+	// If zero, a default threshold of 5 is used.
+	Threshold int
+
+	// Cooldown is the length of time for which a circuit stays
+	// open before another attempt is allowed.
+	//
+	// If zero, a default cooldown of 30s is used.
+	Cooldown time.Duration
+
+	// OnStateChange, if non-nil, is called when an address's
+	// circuit opens or closes.
+	OnStateChange func(address string, open bool)
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// A circuit tracks an address that has failed.
+type circuit struct {
+	failures  int
+	openUntil time.Time // zero if closed
+	probing   bool      // an attempt is allowed while open
+}
+
+// allow returns ErrCircuitOpen if an attempt to dial the address
+// isn't allowed. Otherwise the attempt's outcome must be reported.
+func (b *CircuitBreaker) allow(address string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[address]
+	if c == nil || c.openUntil.IsZero() {
+		return nil
+	}
+	if c.probing || timeNow().Before(c.openUntil) {
+		return ErrCircuitOpen
+	}
+	c.probing = true
+	return nil
+}
+
+// report reports the outcome of an allowed attempt to dial the
+// address. Attempts that weren't counted, such as those that were
+// canceled, don't affect the circuit.
+func (b *CircuitBreaker) report(address string, err error, counted bool) {
+	b.mu.Lock()
+	c := b.circuits[address]
+	switch {
+	case !counted:
+		if c != nil {
+			c.probing = false
+		}
+		b.mu.Unlock()
+		return
+	case err == nil:
+		delete(b.circuits, address)
+		b.mu.Unlock()
+		if c != nil && !c.openUntil.IsZero() {
+			b.changed(address, false)
+		}
+		return
+	}
+	if c == nil {
+		c = &circuit{}
+		if b.circuits == nil {
+			b.circuits = make(map[string]*circuit)
+		}
+		b.circuits[address] = c
+	}
+	c.failures++
+	wasOpen := !c.openUntil.IsZero()
+	if wasOpen || c.failures >= b.threshold() {
+		c.openUntil = timeNow().Add(b.cooldown())
+		c.probing = false
+	}
+	opened := !wasOpen && !c.openUntil.IsZero()
+	b.mu.Unlock()
+	if opened {
+		b.changed(address, true)
+	}
+}
+
+func (b *CircuitBreaker) changed(address string, open bool) {
+	if b.OnStateChange != nil {
+		b.OnStateChange(address, open)
+	}
+}
+
+func (b *CircuitBreaker) threshold() int {
+	if b.Threshold > 0 {
+		return b.Threshold
+	}
+	return 5
+}
+
+func (b *CircuitBreaker) cooldown() time.Duration {
+	if b.Cooldown > 0 {
+		return b.Cooldown
+	}
+	return 30 * time.Second
+}
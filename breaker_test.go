@@ -0,0 +1,79 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	defer func(timeFn func() time.Time) { timeNow = timeFn }(timeNow)
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+
+	var changes []bool
+	b := &CircuitBreaker{
+		Threshold: 2,
+		Cooldown:  time.Minute,
+		OnStateChange: func(address string, open bool) {
+			changes = append(changes, open)
+		},
+	}
+	const addr = "192.0.2.1:80"
+	errRefused := errors.New("refused")
+	attempt := func(err error) error {
+		if err := b.allow(addr); err != nil {
+			return err
+		}
+		b.report(addr, err, true)
+		return nil
+	}
+
+	attempt(errRefused)
+	attempt(errRefused) // opens
+	if err := attempt(nil); err != ErrCircuitOpen {
+		t.Fatalf("expected ErrCircuitOpen; got %v", err)
+	}
+	now = now.Add(time.Minute)
+	if err := b.allow(addr); err != nil {
+		t.Fatalf("unexpected error for probe: %v", err)
+	}
+	if err := b.allow(addr); err != ErrCircuitOpen {
+		t.Fatalf("expected ErrCircuitOpen while probing; got %v", err)
+	}
+	b.report(addr, errRefused, true) // reopens
+	if err := attempt(nil); err != ErrCircuitOpen {
+		t.Fatalf("expected ErrCircuitOpen; got %v", err)
+	}
+	now = now.Add(time.Minute)
+	if err := attempt(nil); err != nil { // closes
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []bool{true, false}; !reflect.DeepEqual(changes, want) {
+		t.Fatalf("state changes: expected %v; got %v", want, changes)
+	}
+}
+
+func TestDialCircuitBreaker(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	d := &Dialer{CircuitBreaker: &CircuitBreaker{Threshold: 1}}
+	if _, err := d.Dial("tcp", addr); err == nil {
+		t.Fatal("expected error dialing closed listener")
+	}
+	_, err = d.Dial("tcp", addr)
+	if derr, ok := err.(*DialError); !ok || derr.Unwrap() != ErrCircuitOpen {
+		t.Fatalf("expected ErrCircuitOpen; got %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Prefetch resolves the hosts concurrently and caches the results,
+// replacing any cached results. It returns the first error that
+// occurred, if any.
+func (r *CacheResolver) Prefetch(hosts ...string) error {
+	return r.PrefetchContext(context.Background(), hosts...)
+}
+
+// PrefetchContext resolves the hosts concurrently using the provided
+// context and caches the results, replacing any cached results. It
+// returns the first error that occurred, if any.
+func (r *CacheResolver) PrefetchContext(ctx context.Context, hosts ...string) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			if _, err := r.update(ctx, host, true); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(host)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// refreshAhead resolves the host of item in the background,
+// unless it's already being resolved.
+func (r *CacheResolver) refreshAhead(host string, item *cacheItem) {
+	r.mu.Lock()
+	if item.refreshing || r.cache[host] != item {
+		r.mu.Unlock()
+		return
+	}
+	item.refreshing = true
+	r.mu.Unlock()
+	go func() {
+		if _, err := r.update(context.Background(), host, false); err != nil {
+			// Keep the current item until it expires
+			// and allow another attempt in the meantime.
+			r.mu.Lock()
+			item.refreshing = false
+			r.mu.Unlock()
+		}
+	}()
+}
+
+// Invalidate removes the host from the cache.
+func (r *CacheResolver) Invalidate(host string) {
+	r.mu.Lock()
+	r.remove(host)
+	r.mu.Unlock()
+}
+
+// InvalidateAll removes all hosts from the cache.
+func (r *CacheResolver) InvalidateAll() {
+	r.mu.Lock()
+	r.cache, r.order = nil, nil
+	r.mu.Unlock()
+}
+
+// Set caches ips as the host's IP addresses, replacing any that
+// are cached. The host expires after ttl. If ttl is zero, the
+// host doesn't expire.
+func (r *CacheResolver) Set(host string, ips []net.IP, ttl time.Duration) {
+	item := &cacheItem{ips: make([]net.IP, len(ips))}
+	copy(item.ips, ips)
+	if ttl > 0 {
+		item.ttl = timeNow().Add(ttl)
+	}
+	r.mu.Lock()
+	r.store(host, item)
+	r.mu.Unlock()
+}
+
+// ReportFailure evicts ip from the cached IP addresses of host,
+// so that it isn't returned again until host is resolved again.
+// If no addresses remain, host is removed from the cache.
+func (r *CacheResolver) ReportFailure(host string, ip net.IP) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	item, ok := r.cache[host]
+	if !ok || item.err != nil {
+		return
+	}
+	ips := make([]net.IP, 0, len(item.ips))
+	for _, cached := range item.ips {
+		if !cached.Equal(ip) {
+			ips = append(ips, cached)
+		}
+	}
+	switch {
+	case len(ips) == len(item.ips):
+	case len(ips) == 0:
+		r.remove(host)
+	default:
+		// Cached items are immutable, so replace it. A refresh
+		// of the original won't be reported to the replacement.
+		replaced := *item
+		replaced.ips = ips
+		replaced.refreshing = false
+		r.cache[host] = &replaced
+	}
+}
+
+// remove removes the host from the cache.
+// It must be called with r.mu held.
+func (r *CacheResolver) remove(host string) {
+	if item, ok := r.cache[host]; ok {
+		r.order.Remove(item.elem)
+		delete(r.cache, host)
+	}
+}
+
+// snapshotVersion is the version of the snapshot format.
+const snapshotVersion = 1
+
+var errSnapshotVersion = errors.New("unsupported snapshot version")
+
+type cacheSnapshot struct {
+	Version int            `json:"version"`
+	Hosts   []snapshotHost `json:"hosts"`
+}
+
+type snapshotHost struct {
+	Host string   `json:"host"`
+	IPs  []net.IP `json:"ips"`
+	// TTL is the remaining time to live.
+	// If zero, the host doesn't expire.
+	TTL time.Duration `json:"ttl,omitempty"`
+}
+
+// Snapshot returns a serialization of the cached hosts, including
+// their remaining time to live, which can be given to Restore.
+// Expired hosts and failed lookups are not included.
+func (r *CacheResolver) Snapshot() ([]byte, error) {
+	snap := cacheSnapshot{Version: snapshotVersion}
+	now := timeNow()
+	r.mu.RLock()
+	if r.order != nil {
+		// Hosts are kept in the order they were stored,
+		// so that it can be restored.
+		for e := r.order.Front(); e != nil; e = e.Next() {
+			host := e.Value.(string)
+			item := r.cache[host]
+			if item.err != nil || !item.fresh(now) {
+				continue
+			}
+			var ttl time.Duration
+			if !item.ttl.IsZero() {
+				ttl = item.ttl.Sub(now)
+			}
+			snap.Hosts = append(snap.Hosts, snapshotHost{host, item.ips, ttl})
+		}
+	}
+	r.mu.RUnlock()
+	return json.Marshal(&snap)
+}
+
+// Restore caches the hosts of a snapshot returned by Snapshot,
+// replacing any that are already cached. Hosts expire after their
+// remaining time to live at the time of the snapshot. Hosts that
+// had already expired are skipped.
+func (r *CacheResolver) Restore(data []byte) error {
+	var snap cacheSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+	if snap.Version != snapshotVersion {
+		return errSnapshotVersion
+	}
+	now := timeNow()
+	r.mu.Lock()
+	for _, h := range snap.Hosts {
+		if h.TTL < 0 {
+			continue
+		}
+		var ttl time.Time
+		if h.TTL > 0 {
+			ttl = now.Add(h.TTL)
+		}
+		r.store(h.Host, &cacheItem{ips: h.IPs, ttl: ttl})
+	}
+	r.mu.Unlock()
+	return nil
+}
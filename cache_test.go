@@ -0,0 +1,342 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCacheResolverPrefetch(t *testing.T) {
+	defer func(fn func(context.Context, string) ([]net.IP, error)) {
+		lookupIPs = fn
+	}(lookupIPs)
+	lookups := make(chan string, 10)
+	lookupIPs = func(_ context.Context, host string) ([]net.IP, error) {
+		lookups <- host
+		return []net.IP{net.IPv6loopback}, nil
+	}
+	resolver := &CacheResolver{}
+	if err := resolver.Prefetch("foo.com", "bar.net"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len(lookups); n != 2 {
+		t.Fatalf("lookups: expected 2; got %d", n)
+	}
+	for _, host := range []string{"foo.com", "bar.net"} {
+		if _, err := resolver.Resolve(host); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if n := len(lookups); n != 2 {
+		t.Fatalf("lookups: expected 2; got %d", n)
+	}
+}
+
+func TestCacheResolverRefreshAhead(t *testing.T) {
+	defer func(lookupFn func(context.Context, string) ([]net.IP, error), timeFn func() time.Time) {
+		lookupIPs = lookupFn
+		timeNow = timeFn
+	}(lookupIPs, timeNow)
+	lookups := make(chan string, 10)
+	lookupIPs = func(_ context.Context, host string) ([]net.IP, error) {
+		lookups <- host
+		return []net.IP{net.IPv6loopback}, nil
+	}
+	start := time.Now()
+	now := start
+	timeNow = func() time.Time { return now }
+	resolver := &CacheResolver{TTL: time.Minute, RefreshAhead: 10 * time.Second}
+
+	if _, err := resolver.Resolve("foo.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-lookups
+	now = start.Add(55 * time.Second)
+	if _, err := resolver.Resolve("foo.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case <-lookups:
+	case <-time.After(5 * time.Second):
+		t.Fatal("host wasn't refreshed")
+	}
+	// Wait for the refreshed item to be stored.
+	for i := 0; ; i++ {
+		resolver.mu.RLock()
+		ttl := resolver.cache["foo.com"].ttl
+		resolver.mu.RUnlock()
+		if ttl.Equal(now.Add(time.Minute)) {
+			break
+		}
+		if i == 100 {
+			t.Fatal("refreshed host wasn't cached")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCacheResolverSnapshot(t *testing.T) {
+	defer func(lookupFn func(context.Context, string) ([]net.IP, error), timeFn func() time.Time) {
+		lookupIPs = lookupFn
+		timeNow = timeFn
+	}(lookupIPs, timeNow)
+	lookups := 0
+	ips := []net.IP{net.IPv4(192, 0, 2, 1), net.ParseIP("2001:db8::1")}
+	lookupIPs = func(context.Context, string) ([]net.IP, error) {
+		lookups++
+		return ips, nil
+	}
+	start := time.Now()
+	now := start
+	timeNow = func() time.Time { return now }
+
+	r := &CacheResolver{TTL: time.Minute}
+	if err := r.Prefetch("foo.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now = start.Add(20 * time.Second)
+	data, err := r.Snapshot()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	now = start.Add(time.Hour)
+	restored := &CacheResolver{TTL: time.Minute}
+	if err := restored.Restore(data); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := restored.Resolve("foo.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lookups != 1 {
+		t.Fatalf("lookups: expected 1; got %d", lookups)
+	}
+	if !reflect.DeepEqual(got, ips) {
+		t.Fatalf("ips: expected %v; got %v", ips, got)
+	}
+	now = start.Add(time.Hour + 40*time.Second) // remaining TTL expired
+	if _, err := restored.Resolve("foo.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lookups != 2 {
+		t.Fatalf("lookups: expected 2; got %d", lookups)
+	}
+
+	expired := []byte(`{"version":1,"hosts":[{"host":"bar.com","ips":["192.0.2.2"],"ttl":-1000000000}]}`)
+	if err := restored.Restore(expired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := restored.Resolve("bar.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lookups != 3 {
+		t.Fatalf("expired lookups: expected 3; got %d", lookups)
+	}
+}
+
+func TestCacheResolverInvalidate(t *testing.T) {
+	defer func(fn func(context.Context, string) ([]net.IP, error)) {
+		lookupIPs = fn
+	}(lookupIPs)
+	lookups := 0
+	lookupIPs = func(context.Context, string) ([]net.IP, error) {
+		lookups++
+		return []net.IP{net.IPv6loopback}, nil
+	}
+	ip := net.IPv4(192, 0, 2, 1)
+	r := &CacheResolver{}
+	r.Set("foo.com", []net.IP{ip}, time.Minute)
+	r.Set("bar.net", []net.IP{ip}, 0)
+	for _, host := range []string{"foo.com", "bar.net"} {
+		if ips, err := r.Resolve(host); err != nil || !reflect.DeepEqual(ips, []net.IP{ip}) {
+			t.Fatalf("%s: expected %v; got %v, %v", host, ip, ips, err)
+		}
+	}
+	if lookups != 0 {
+		t.Fatalf("lookups: expected 0; got %d", lookups)
+	}
+	r.Invalidate("foo.com")
+	r.Resolve("foo.com")
+	r.Resolve("bar.net")
+	if lookups != 1 {
+		t.Fatalf("lookups: expected 1; got %d", lookups)
+	}
+	r.InvalidateAll()
+	r.Resolve("foo.com")
+	r.Resolve("bar.net")
+	if lookups != 3 {
+		t.Fatalf("lookups: expected 3; got %d", lookups)
+	}
+}
+
+func TestCacheResolverReportFailure(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	// Nothing listens on 127.0.0.2, so dialing it is refused.
+	good, bad := net.IPv4(127, 0, 0, 1), net.IPv4(127, 0, 0, 2)
+	r := &CacheResolver{}
+	r.Set("foo.com", []net.IP{bad, good}, 0)
+	d := &Dialer{Resolver: r} // dial the first address
+	if c, err := d.Dial("tcp4", "foo.com:"+port); err == nil {
+		c.Close()
+		t.Fatal("expected error")
+	}
+	ips, err := r.Resolve("foo.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []net.IP{good}; !reflect.DeepEqual(ips, want) {
+		t.Fatalf("ips: expected %v; got %v", want, ips)
+	}
+	c, err := d.Dial("tcp4", "foo.com:"+port)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Close()
+
+	// The replacement keeps the original's metadata.
+	item := r.storeAddrs("bar.com", Addrs{IPs: []net.IP{bad, good}, TTL: time.Hour, Source: SourceHosts})
+	r.ReportFailure("bar.com", bad)
+	r.mu.RLock()
+	replaced := r.cache["bar.com"]
+	r.mu.RUnlock()
+	if replaced.source != item.source || !replaced.ttl.Equal(item.ttl) || replaced.elem != item.elem {
+		t.Fatalf("expected metadata of %+v; got %+v", item, replaced)
+	}
+}
+
+// slowResolver resolves hosts once released. It can't be cancelled.
+type slowResolver struct {
+	release chan struct{}
+	lookups chan string
+}
+
+func (r *slowResolver) Resolve(host string) ([]net.IP, error) {
+	r.lookups <- host
+	<-r.release
+	return []net.IP{net.IPv4(192, 0, 2, 1)}, nil
+}
+
+func TestCacheResolverLateResults(t *testing.T) {
+	slow := &slowResolver{release: make(chan struct{}), lookups: make(chan string, 10)}
+	r := &CacheResolver{Resolver: slow}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := r.ResolveContext(ctx, "ip", "foo.test"); err == nil {
+		t.Fatal("expected error when the lookup outlives the context")
+	}
+	close(slow.release)
+	// The abandoned lookup's results are cached when they arrive.
+	deadline := time.Now().Add(time.Second)
+	for {
+		r.mu.RLock()
+		_, ok := r.cache["foo.test"]
+		r.mu.RUnlock()
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected late results to be cached")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := r.Resolve("foo.test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len(slow.lookups); n != 1 {
+		t.Fatalf("lookups: expected 1; got %d", n)
+	}
+}
+
+type deadlineResolver struct {
+	deadline time.Time
+}
+
+func (r *deadlineResolver) Resolve(host string) ([]net.IP, error) {
+	return nil, errors.New("Resolve called")
+}
+
+func (r *deadlineResolver) ResolveDeadline(host string, deadline time.Time) ([]net.IP, error) {
+	r.deadline = deadline
+	return []net.IP{net.IPv4(192, 0, 2, 1)}, nil
+}
+
+func TestResolveDeadline(t *testing.T) {
+	r := &deadlineResolver{}
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	if _, err := resolveContext(ctx, r, "ip", "foo.test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !r.deadline.Equal(deadline) {
+		t.Fatalf("deadline: expected %v; got %v", deadline, r.deadline)
+	}
+}
+
+func TestCacheResolverAddrs(t *testing.T) {
+	defer func(fn func() time.Time) { timeNow = fn }(timeNow)
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+
+	static := StaticResolver{"foo.test": {net.IPv4(192, 0, 2, 1)}}
+	ttl := &ttlResolver{static, 10 * time.Second}
+	r := &CacheResolver{Resolver: ttl, TTL: time.Minute}
+	ctx := context.Background()
+	addrs, err := r.ResolveAddrs(ctx, "ip", "foo.test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if addrs.Source != SourceStatic || addrs.TTL != 10*time.Second {
+		t.Fatalf("expected TTL 10s from %q; got %v from %q", SourceStatic, addrs.TTL, addrs.Source)
+	}
+	now = now.Add(4 * time.Second)
+	if addrs, err = r.ResolveAddrs(ctx, "ip", "foo.test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if addrs.Source != SourceCache || addrs.TTL != 6*time.Second {
+		t.Fatalf("expected TTL 6s from %q; got %v from %q", SourceCache, addrs.TTL, addrs.Source)
+	}
+	// The reported TTL is shorter than the cache's TTL.
+	now = now.Add(6 * time.Second)
+	if addrs, err = r.ResolveAddrs(ctx, "ip", "foo.test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if addrs.Source != SourceStatic {
+		t.Fatalf("expected expired addresses to be resolved again; got them from %q", addrs.Source)
+	}
+}
+
+// ttlResolver reports a TTL for the addresses of its Resolver.
+type ttlResolver struct {
+	StaticResolver
+	ttl time.Duration
+}
+
+func (r *ttlResolver) ResolveAddrs(ctx context.Context, network, host string) (Addrs, error) {
+	addrs, err := r.StaticResolver.ResolveAddrs(ctx, network, host)
+	addrs.TTL = r.ttl
+	return addrs, err
+}
@@ -0,0 +1,30 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"net"
+	"syscall"
+)
+
+// CheckConn is a health check, for use as a Dialer's HealthCheck,
+// that returns an error if c was closed by its peer or its socket
+// has an error, such as a connection that stayed established after
+// the server went away. It doesn't consume any data pending on c.
+//
+// Connections that don't implement syscall.Conn, such as those
+// wrapped by a Dialer's OnConn, and connections on platforms that
+// can't peek at a socket's data pass the check.
+func CheckConn(c net.Conn) error {
+	sc, ok := c.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	return peekConn(rc)
+}
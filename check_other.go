@@ -0,0 +1,15 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package nett
+
+import "syscall"
+
+// peekConn can't tell whether the peer of the socket has closed
+// its side of the connection on this platform.
+func peekConn(c syscall.RawConn) error {
+	return nil
+}
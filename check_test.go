@@ -0,0 +1,79 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCheckConn(t *testing.T) {
+	switch runtime.GOOS {
+	case "darwin", "dragonfly", "freebsd", "linux", "netbsd", "openbsd", "solaris":
+	default:
+		t.Skipf("not supported on %s", runtime.GOOS)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		accepted <- c
+	}()
+
+	d := &Dialer{HealthCheck: CheckConn}
+	p := &Pool{Dialer: d}
+	defer p.Close()
+	ctx := context.Background()
+	c, err := p.Get(ctx, "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conn := c.Conn
+	s := <-accepted
+	if err := CheckConn(conn); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Pending data isn't consumed.
+	s.Write([]byte("x"))
+	time.Sleep(10 * time.Millisecond)
+	if err := CheckConn(conn); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b := make([]byte, 1)
+	if n, err := conn.Read(b); n != 1 || b[0] != 'x' {
+		t.Fatalf("unexpected read: %d, %v", n, err)
+	}
+
+	// An idle connection closed by its peer isn't reused.
+	c.Close()
+	s.Close()
+	time.Sleep(10 * time.Millisecond)
+	if err := CheckConn(conn); err == nil {
+		t.Fatal("expected error after the peer closed")
+	}
+	go func() {
+		if c, err := ln.Accept(); err == nil {
+			accepted <- c
+		}
+	}()
+	c, err = p.Get(ctx, "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+	if c.Conn == conn {
+		t.Fatal("expected a new connection")
+	}
+}
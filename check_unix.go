@@ -0,0 +1,34 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package nett
+
+import (
+	"io"
+	"syscall"
+)
+
+// peekConn reports whether the peer of the socket has closed its
+// side of the connection, by peeking at its pending data without
+// blocking. It returns io.EOF if the peer has closed it.
+func peekConn(c syscall.RawConn) error {
+	var err error
+	if cerr := c.Control(func(fd uintptr) {
+		var b [1]byte
+		var n int
+		// Sockets are non-blocking, so this doesn't wait for data.
+		n, _, err = syscall.Recvfrom(int(fd), b[:], syscall.MSG_PEEK)
+		switch {
+		case err == syscall.EAGAIN || err == syscall.EWOULDBLOCK:
+			err = nil // no pending data
+		case err == nil && n == 0:
+			err = io.EOF
+		}
+	}); cerr != nil {
+		return cerr
+	}
+	return err
+}
@@ -0,0 +1,141 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrConnExpired is returned by the methods of a connection
+// returned by WrapConn after it has closed itself.
+var ErrConnExpired = errors.New("connection expired")
+
+// WrapConn returns a connection that closes c once no data has been
+// read from or written to it for idleTimeout, or once maxLifetime
+// has passed, if they're positive. After it's closed itself, its
+// Read and Write methods return ErrConnExpired. If neither duration
+// is positive, c is returned.
+func WrapConn(c net.Conn, idleTimeout, maxLifetime time.Duration) net.Conn {
+	if idleTimeout <= 0 && maxLifetime <= 0 {
+		return c
+	}
+	ec := &expiringConn{Conn: c, idleTimeout: idleTimeout, lastUse: time.Now().UnixNano()}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	if idleTimeout > 0 {
+		ec.idleTimer = time.AfterFunc(idleTimeout, ec.checkIdle)
+	}
+	if maxLifetime > 0 {
+		ec.lifeTimer = time.AfterFunc(maxLifetime, ec.expire)
+	}
+	return ec
+}
+
+type expiringConn struct {
+	lastUse int64 // in Unix nanoseconds; first for atomic alignment
+
+	net.Conn
+	idleTimeout time.Duration
+
+	mu        sync.Mutex
+	idleTimer *time.Timer
+	lifeTimer *time.Timer
+	closed    bool // by Close
+	expired   bool // by a timer
+}
+
+func (c *expiringConn) Read(b []byte) (int, error) {
+	if c.isExpired() {
+		return 0, ErrConnExpired
+	}
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		atomic.StoreInt64(&c.lastUse, time.Now().UnixNano())
+	}
+	if err != nil && c.isExpired() {
+		err = ErrConnExpired
+	}
+	return n, err
+}
+
+func (c *expiringConn) Write(b []byte) (int, error) {
+	if c.isExpired() {
+		return 0, ErrConnExpired
+	}
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		atomic.StoreInt64(&c.lastUse, time.Now().UnixNano())
+	}
+	if err != nil && c.isExpired() {
+		err = ErrConnExpired
+	}
+	return n, err
+}
+
+// Close closes the connection. If it has already closed itself,
+// Close returns nil.
+func (c *expiringConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return c.Conn.Close() // report the error
+	}
+	c.closed = true
+	expired := c.expired
+	c.stopTimers()
+	c.mu.Unlock()
+	if expired {
+		return nil
+	}
+	return c.Conn.Close()
+}
+
+func (c *expiringConn) isExpired() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.expired
+}
+
+// checkIdle closes the connection if it's been idle for
+// idleTimeout or checks again when it could have been.
+func (c *expiringConn) checkIdle() {
+	idle := time.Since(time.Unix(0, atomic.LoadInt64(&c.lastUse)))
+	if idle >= c.idleTimeout {
+		c.expire()
+		return
+	}
+	c.mu.Lock()
+	if !c.closed && !c.expired {
+		c.idleTimer.Reset(c.idleTimeout - idle)
+	}
+	c.mu.Unlock()
+}
+
+// expire closes the connection unless it's already closed.
+func (c *expiringConn) expire() {
+	c.mu.Lock()
+	if c.closed || c.expired {
+		c.mu.Unlock()
+		return
+	}
+	c.expired = true
+	c.stopTimers()
+	c.mu.Unlock()
+	c.Conn.Close()
+}
+
+// stopTimers stops the timers. It must be called with c.mu held.
+func (c *expiringConn) stopTimers() {
+	if c.idleTimer != nil {
+		c.idleTimer.Stop()
+	}
+	if c.lifeTimer != nil {
+		c.lifeTimer.Stop()
+	}
+}
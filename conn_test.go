@@ -0,0 +1,67 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestWrapConnIdleTimeout(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	go func() {
+		b := make([]byte, 1)
+		for {
+			if _, err := c2.Read(b); err != nil {
+				return
+			}
+		}
+	}()
+
+	c := WrapConn(c1, 50*time.Millisecond, 0)
+	// Activity keeps the connection open.
+	for i := 0; i < 4; i++ {
+		time.Sleep(20 * time.Millisecond)
+		if _, err := c.Write([]byte{0}); err != nil {
+			t.Fatalf("write %d: unexpected error: %v", i, err)
+		}
+	}
+	// A read that waits for data is idle.
+	start := time.Now()
+	if _, err := c.Read(make([]byte, 1)); err != ErrConnExpired {
+		t.Fatalf("expected ErrConnExpired; got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expired after %v", elapsed)
+	}
+	if _, err := c.Write([]byte{0}); err != ErrConnExpired {
+		t.Fatalf("expected ErrConnExpired; got %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("unexpected error closing expired conn: %v", err)
+	}
+}
+
+func TestWrapConnMaxLifetime(t *testing.T) {
+	ln, _ := testAccepter(t)
+	defer ln.Close()
+
+	d := &Dialer{ConnMaxLifetime: 50 * time.Millisecond}
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+	time.Sleep(100 * time.Millisecond)
+	if _, err := c.Write([]byte{0}); err != ErrConnExpired {
+		t.Fatalf("expected ErrConnExpired; got %v", err)
+	}
+
+	if wc := WrapConn(c, 0, 0); wc != c {
+		t.Fatal("expected the connection to be returned")
+	}
+}
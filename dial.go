@@ -5,7 +5,12 @@
 package nett
 
 import (
+	"context"
 	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -24,6 +29,23 @@ type Dialer struct {
 	// often around 3 minutes.
 	Timeout time.Duration
 
+	// ResolveTimeout is the maximum amount of time a dial will
+	// wait for the address to be resolved, leaving the rest of
+	// the dial's time for connecting. A dial that times out while
+	// resolving fails with ErrResolveTimeout.
+	//
+	// The default is no timeout beyond the dial's.
+	ResolveTimeout time.Duration
+
+	// AddrTimeout is the maximum amount of time a dial will wait
+	// for a connect to a single address to complete. It bounds
+	// each attempt when multiple addresses are dialed, while
+	// Timeout and Deadline bound the whole dial. An attempt that
+	// times out fails with ErrConnectTimeout.
+	//
+	// The default is no per-address timeout.
+	AddrTimeout time.Duration
+
 	// Deadline is the absolute point in time after which dials
 	// will fail. If Timeout is set, it may fail earlier.
 	//
@@ -38,31 +60,243 @@ type Dialer struct {
 	// If nil, a local address is automatically chosen.
 	LocalAddr net.Addr
 
+	// LocalAddrFunc, if non-nil, returns the local address to use
+	// when dialing the remote address, so that the local address's
+	// family can match the remote address's. It takes precedence
+	// over LocalAddr. See LocalAddrFamily.
+	LocalAddrFunc func(remote net.Addr) net.Addr
+
 	// Resolver is used to resolve IP addresses from domain names.
 	//
 	// If nil, DefaultResolver will be used.
 	Resolver Resolver
 
+	// Filter selects addresses from those available after
+	// resolving a host to a set of supported IPs, given the
+	// network and host being dialed. It takes precedence over
+	// IPFilter.
+	//
+	// If multiple addresses are selected, they are dialed as
+	// specified by DialStrategy until a connection is established.
+	Filter Filter
+
 	// IPFilter selects addresses from those available after
-	// resolving a host to a set of supported IPs.
+	// resolving a host to a set of supported IPs. It's used
+	// when Filter is nil.
 	//
-	// When dialing a TCP connection if multiple addresses are
-	// returned, then a connection will attempt to be established
-	// with each address and the first that succeeds will be returned.
-	// With any other type of connection, only the first address
-	// returned will be dialed.
+	// If nil, a single address of the family specified by
+	// Preference is selected.
 	//
-	// If nil, a single address is selected.
+	// Deprecated: Use Filter with the FilterFunc adapter.
 	IPFilter func(ips []net.IP) []net.IP
 
+	// PublicOnly specifies whether dials are restricted to publicly
+	// routable addresses, as selected by PublicOnlyFilter before
+	// IPFilter. A dial to a host that resolves only to non-public
+	// addresses, or to an empty host, fails with ErrNonPublicAddress.
+	// Unix networks are not restricted.
+	//
+	// The address of a Proxy isn't restricted. Instead, the host
+	// being dialed through it is resolved and restricted locally,
+	// and the proxy is asked to connect to the address selected.
+	PublicOnly bool
+
+	// Preference specifies the preferred address family of the
+	// address selected when Filter and IPFilter are nil. Filters
+	// are given addresses in the order returned by the Resolver.
+	//
+	// The default is PreferIPv4.
+	Preference Preference
+
+	// DialStrategy specifies how a connection is established when
+	// dialing multiple TCP addresses. Addresses of other networks
+	// are always dialed sequentially.
+	//
+	// The default is Race.
+	DialStrategy DialStrategy
+
+	// FallbackDelay specifies the length of time to wait before
+	// starting the next connection attempt when DialStrategy is
+	// HappyEyeballs.
+	//
+	// If zero, a default delay of 300ms is used.
+	FallbackDelay time.Duration
+
+	// CancelGracePeriod is the length of time for which the attempts
+	// that lost a race of addresses may continue before they're
+	// canceled, so that their outcomes are reported, such as to the
+	// CircuitBreaker and OnDialDone. Connections they establish are
+	// closed. They're canceled at the dial's deadline regardless.
+	//
+	// If zero, they're canceled as soon as the race is won.
+	CancelGracePeriod time.Duration
+
+	// Proxy specifies a function to return a proxy for dialing
+	// the address on the named TCP network. If the function returns
+	// a non-nil error, the dial fails with that error. If it returns
+	// a nil URL, no proxy is used. The address of the proxy itself
+	// is resolved and filtered like any other.
+	//
+	// The supported schemes are "http", for HTTP CONNECT tunnels,
+	// and "socks5". Credentials are taken from the URL's user info.
+	// The address is sent to the proxy to be resolved there.
+	//
+	// If nil, no proxy is used.
+	Proxy func(network, address string) (*url.URL, error)
+
+	// Limiter, if non-nil, limits the rate of all of the Dialer's
+	// connection attempts.
+	Limiter Limiter
+
+	// HostLimiter, if non-nil, returns the Limiter that limits the
+	// rate of connection attempts to the host, or nil if they're
+	// not limited. See PerHost.
+	HostLimiter func(host string) Limiter
+
+	// MaxConcurrentDials, if positive, limits the number of the
+	// Dialer's connection attempts that may be in progress at once.
+	// MaxConcurrentDialsPerHost, if positive, limits the number of
+	// those to each host. Further attempts wait for a slot.
+	//
+	// They must not be changed after the Dialer is first used.
+	MaxConcurrentDials        int
+	MaxConcurrentDialsPerHost int
+
+	// CircuitBreaker, if non-nil, tracks failed connection attempts
+	// to each resolved address and short-circuits further attempts
+	// to those that have failed repeatedly.
+	CircuitBreaker *CircuitBreaker
+
+	// OnDialStart, if non-nil, is called before each connection
+	// attempt with the network, the resolved address and the number
+	// of the attempt, starting at zero. It may be called concurrently.
+	OnDialStart func(network, address string, attempt int)
+
+	// OnDialDone, if non-nil, is called after each connection attempt
+	// with the same arguments as OnDialStart, the attempt's duration
+	// and its error. It may be called concurrently.
+	OnDialDone func(network, address string, attempt int, elapsed time.Duration, err error)
+
+	// Trace, if non-nil, is called at each phase of a dial. The
+	// hooks of a trace given by WithDialTrace are called first.
+	Trace *DialTrace
+
+	// ReadLimiter and WriteLimiter, if non-nil, limit the rates of
+	// reads from and writes to each established connection, which
+	// is wrapped by a ThrottledConn. They're shared by all of the
+	// Dialer's connections, so they limit their combined bandwidth.
+	ReadLimiter  ByteLimiter
+	WriteLimiter ByteLimiter
+
+	// ConnIdleTimeout and ConnMaxLifetime, if positive, wrap each
+	// established connection as by WrapConn, so that it closes itself
+	// after being idle for ConnIdleTimeout or once ConnMaxLifetime
+	// has passed since it was established.
+	ConnIdleTimeout time.Duration
+	ConnMaxLifetime time.Duration
+
+	// Metered specifies whether each established connection is
+	// wrapped by a MeteredConn, which implements Metered, before
+	// it's passed to OnConn.
+	Metered bool
+
+	// HealthCheck, if non-nil, is called with each connection
+	// established by a dial that races addresses before it may
+	// win the race, and with idle connections of a Pool that uses
+	// the Dialer before they're reused. If it returns an error,
+	// the connection is closed and isn't used, so that connections
+	// that were closed by their peers aren't returned. CheckConn
+	// may be used.
+	HealthCheck func(c net.Conn) error
+
+	// OnConn, if non-nil, is called with each established connection
+	// and the connection it returns is returned by the dial instead.
+	// It may wrap the connection, for example to count bytes.
+	OnConn func(c net.Conn) net.Conn
+
+	// Interface, if non-empty, is the name of the network interface
+	// to which connections are bound. Where the platform doesn't
+	// support binding a socket to an interface, an address of the
+	// interface of the remote address's family is used instead of
+	// LocalAddr.
+	Interface string
+
+	// IPv4Mapped specifies whether IPv4-mapped IPv6 addresses, such
+	// as ::ffff:192.0.2.1, that are resolved for IPv6-only networks,
+	// such as "tcp6", are used where the platform supports them (see
+	// SupportsIPv4Mapped), rather than dropped. Filters treat them as
+	// IPv4 addresses, and they're dialed as IPv4 addresses.
+	IPv4Mapped bool
+
+	// DefaultZone, if non-empty, is the zone, such as an interface
+	// name, of link-local IPv6 addresses resolved without one.
+	//
+	// If empty, such an address is dialed on each interface that is
+	// up, isn't a loopback interface, and has a link-local IPv6
+	// address, as specified by DialStrategy.
+	DefaultZone string
+
+	// Control, if non-nil, is called after creating the network
+	// connection but before actually dialing, with the network and
+	// the resolved address. It may set socket options on c, such as
+	// SO_MARK or IP_TOS.
+	//
+	// Network and address parameters passed to Control are not
+	// necessarily the ones passed to Dial. For example, passing
+	// "tcp" to Dial will cause Control to be called with "tcp4"
+	// or "tcp6".
+	Control func(network, address string, c syscall.RawConn) error
+
+	// NoDelay, if non-nil, specifies whether the operating system
+	// should delay packet transmission on TCP connections in hopes
+	// of sending fewer packets (Nagle's algorithm).
+	//
+	// If nil, the operating system's default is used, which is
+	// no delay in Go.
+	NoDelay *bool
+
+	// ReadBufferSize and WriteBufferSize, if positive, specify the
+	// sizes of the operating system's receive and transmit buffers
+	// of TCP connections.
+	ReadBufferSize  int
+	WriteBufferSize int
+
 	// KeepAlive specifies the keep-alive period for an active
 	// network connection.
 	//
 	// If zero, keep-alives are not enabled. Network protocols
 	// that do not support keep-alives ignore this field.
-	//
-	// Only functional for go1.3+.
 	KeepAlive time.Duration
+
+	// KeepAliveConfig, if non-nil, enables keep-alives on TCP
+	// connections and configures their probes, which bounds the
+	// time taken to detect a dead peer. Its Idle overrides KeepAlive.
+	KeepAliveConfig *KeepAliveConfig
+
+	// TCPUserTimeout, if positive, specifies the maximum time that
+	// data written to a TCP connection may remain unacknowledged
+	// before the connection is closed and the write fails, rather
+	// than the operating system's default of many minutes. It sets
+	// TCP_USER_TIMEOUT, which is only supported on Linux. Elsewhere
+	// it's ignored and WithTCPUserTimeout returns an error.
+	TCPUserTimeout time.Duration
+
+	// MultipathTCP specifies whether TCP connections use Multipath
+	// TCP (MPTCP), which can spread a connection over several paths,
+	// such as Wi-Fi and cellular. Where the kernel doesn't support
+	// it, or when built with Go before 1.21, TCP is used instead.
+	MultipathTCP bool
+
+	// TrafficClass, if positive, specifies the IPv4 type of service
+	// (IP_TOS) or IPv6 traffic class (IPV6_TCLASS) of connections,
+	// depending on their address family, such as to mark them with a
+	// DSCP for quality of service. The DSCP is the upper six bits, so
+	// for example, CS1 (low priority) is 0x20. It's ignored on
+	// platforms other than Unix.
+	TrafficClass int
+
+	slots dialSlots
+	stats dialStats
 }
 
 // Return either now+Timeout or Deadline, whichever comes first.
@@ -107,68 +341,808 @@ func (d *Dialer) deadline() time.Time {
 //
 // For Unix networks, the address must be a file system path.
 func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to the address on the named network using
+// the provided context.
+//
+// The provided Context must be non-nil. If the context expires before
+// the connection is complete, an error is returned. Once successfully
+// connected, any expiration of the context will not affect the
+// connection.
+//
+// If the context has a deadline, it is used in addition to the
+// Dialer's Timeout and Deadline and the earliest of them applies.
+//
+// See func Dial for a description of the network and address
+// parameters.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if ctx == nil {
+		panic("nil context")
+	}
+	ctx, deadline, cancel := d.withDeadline(ctx)
+	defer cancel()
+	var (
+		c   net.Conn
+		err error
+	)
+	if d.Proxy != nil && len(network) >= 3 && network[:3] == "tcp" {
+		u, err := d.Proxy(network, address)
+		if err != nil {
+			return nil, newDialError(network, address, "proxy", nil, err)
+		}
+		if u != nil {
+			c, err = d.dialProxy(ctx, deadline, u, network, address)
+			return d.wrapConn(c, err)
+		}
+	}
+	c, err = d.dialDirect(ctx, deadline, network, address, d.PublicOnly)
+	return d.wrapConn(c, err)
+}
+
+// withDeadline returns a copy of ctx with the earliest of its deadline
+// and the Dialer's Timeout and Deadline, and that deadline, which is
+// zero if there is none.
+func (d *Dialer) withDeadline(ctx context.Context) (context.Context, time.Time, context.CancelFunc) {
 	deadline := d.deadline()
-	filter := d.IPFilter
-	if filter == nil {
-		filter = defaultIP
+	if ctxDeadline, ok := ctx.Deadline(); ok && (deadline.IsZero() || ctxDeadline.Before(deadline)) {
+		deadline = ctxDeadline
+	}
+	if deadline.IsZero() {
+		return ctx, deadline, func() {}
+	}
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	return ctx, deadline, cancel
+}
+
+// DialTCP acts like Dial for TCP networks and returns a *net.TCPConn.
+// The Dialer's Proxy, OnConn, ReadLimiter, WriteLimiter,
+// ConnIdleTimeout, ConnMaxLifetime and Metered are not used by
+// DialTCP, DialUDP, DialIP or DialUnix, since they could change
+// the connection's type.
+func (d *Dialer) DialTCP(network, address string) (*net.TCPConn, error) {
+	c, err := d.dialNetwork(network, address, "tcp", "tcp4", "tcp6")
+	if err != nil {
+		return nil, err
 	}
-	addrs, err := resolveAddrsDeadline(d.Resolver, filter, network, address, deadline)
+	return c.(*net.TCPConn), nil
+}
+
+// DialUDP acts like Dial for UDP networks and returns a *net.UDPConn.
+func (d *Dialer) DialUDP(network, address string) (*net.UDPConn, error) {
+	c, err := d.dialNetwork(network, address, "udp", "udp4", "udp6")
 	if err != nil {
-		return nil, &net.OpError{Op: "dial", Net: network, Addr: nil, Err: err}
+		return nil, err
+	}
+	return c.(*net.UDPConn), nil
+}
+
+// DialIP acts like Dial for IP networks and returns a *net.IPConn.
+func (d *Dialer) DialIP(network, address string) (*net.IPConn, error) {
+	c, err := d.dialNetwork(network, address, "ip", "ip4", "ip6")
+	if err != nil {
+		return nil, err
+	}
+	return c.(*net.IPConn), nil
+}
+
+// DialUnix acts like Dial for Unix networks and returns a *net.UnixConn.
+func (d *Dialer) DialUnix(network, address string) (*net.UnixConn, error) {
+	c, err := d.dialNetwork(network, address, "unix", "unixgram", "unixpacket")
+	if err != nil {
+		return nil, err
+	}
+	return c.(*net.UnixConn), nil
+}
+
+// dialNetwork connects to the address on the named network without
+// a proxy if its address family network is one of afnets.
+func (d *Dialer) dialNetwork(network, address string, afnets ...string) (net.Conn, error) {
+	afnet, err := parseNetwork(network)
+	if err != nil {
+		return nil, newDialError(network, address, "resolve", nil, err)
+	}
+	for _, n := range afnets {
+		if afnet == n {
+			ctx, deadline, cancel := d.withDeadline(context.Background())
+			defer cancel()
+			return d.dialDirect(ctx, deadline, network, address, d.PublicOnly)
+		}
+	}
+	return nil, newDialError(network, address, "resolve", nil, net.UnknownNetworkError(network))
+}
+
+// filter returns the Filter that selects the addresses to dial:
+// Filter, IPFilter or the default selection of Preference.
+func (d *Dialer) filter() Filter {
+	switch {
+	case d.Filter != nil:
+		return d.Filter
+	case d.IPFilter != nil:
+		return FilterFunc(d.IPFilter)
+	}
+	switch d.Preference {
+	case PreferIPv4:
+		return FilterFunc(DefaultFilter)
+	case PreferIPv6:
+		return FilterFunc(PreferIPv6Filter)
+	}
+	return FilterFunc(defaultIP)
+}
+
+// wrapConn returns c wrapped by OnConn if the dial succeeded.
+func (d *Dialer) wrapConn(c net.Conn, err error) (net.Conn, error) {
+	if err != nil {
+		return c, err
+	}
+	if d.ReadLimiter != nil || d.WriteLimiter != nil {
+		c = &ThrottledConn{Conn: c, ReadLimiter: d.ReadLimiter, WriteLimiter: d.WriteLimiter}
+	}
+	c = WrapConn(c, d.ConnIdleTimeout, d.ConnMaxLifetime)
+	if d.Metered {
+		c = NewMeteredConn(c)
+	}
+	if d.OnConn == nil {
+		return c, nil
+	}
+	return d.OnConn(c), nil
+}
+
+// attemptNetwork returns the network on which to dial ip, which was
+// resolved for the named network. An IPv4-mapped IPv6 address is
+// dialed as an IPv4 address, since IPv6-only sockets can't reach it.
+func attemptNetwork(network string, ip net.IP) string {
+	if ip == nil || ip.To4() == nil || len(ip) != net.IPv6len {
+		return network
+	}
+	afnet, proto := network, ""
+	if i := byteIndex(network, ':'); i >= 0 {
+		afnet, proto = network[:i], network[i:]
+	}
+	if afnet[len(afnet)-1] != '6' {
+		return network
+	}
+	return afnet[:len(afnet)-1] + "4" + proto
+}
+
+// resolve resolves the address on the named network to the
+// addresses selected by the Dialer's filters. If publicOnly is
+// true, they're restricted as described by PublicOnly.
+func (d *Dialer) resolve(ctx context.Context, network, address string, publicOnly bool) (addrList, error) {
+	f, host := d.filter(), hostOf(address)
+	filter := func(ips []net.IP) []net.IP {
+		return f.Filter(network, host, ips)
+	}
+	var nonPublic bool // only non-public addresses were resolved
+	if publicOnly {
+		if _, err := parseNetwork(network); err == nil && network[:2] != "un" && host == "" {
+			// An empty host dials the local system.
+			return nil, newDialError(network, address, "resolve", nil, ErrNonPublicAddress)
+		}
+		next := filter
+		filter = func(ips []net.IP) []net.IP {
+			public := PublicOnlyFilter(ips)
+			nonPublic = len(public) == 0 && len(ips) > 0
+			return next(public)
+		}
+	}
+	resolver := d.Resolver
+	if trace := d.trace(ctx); trace != nil && (trace.DNSStart != nil || trace.DNSDone != nil) {
+		resolver = traceResolver{resolver, trace}
+	}
+	rctx := ctx
+	if d.ResolveTimeout > 0 {
+		var cancel context.CancelFunc
+		rctx, cancel = context.WithTimeout(ctx, d.ResolveTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	addrs, err := resolveAddrList(rctx, resolver, filter, d.IPv4Mapped, network, address)
+	if err != nil {
+		if rctx.Err() == context.DeadlineExceeded {
+			err = ErrResolveTimeout
+		} else if nonPublic && err == ErrNoSuitableAddress {
+			err = ErrNonPublicAddress
+		}
+		derr := newDialError(network, address, "resolve", nil, err)
+		derr.Attempts[0].Elapsed = time.Since(start)
+		return nil, derr
+	}
+	return withZones(addrs, d.zones), nil
+}
+
+// zones returns the zones of link-local IPv6 addresses
+// resolved without one.
+func (d *Dialer) zones() []string {
+	if d.DefaultZone != "" {
+		return []string{d.DefaultZone}
+	}
+	return linkLocalZones()
+}
+
+// linkLocalZones returns the names of the interfaces that are up,
+// aren't loopback interfaces, and have a link-local IPv6 address.
+// It's a variable for testing.
+var linkLocalZones = func() []string {
+	ifs, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var zones []string
+	for _, ifi := range ifs {
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && needsZone(ipnet.IP, "") {
+				zones = append(zones, ifi.Name)
+				break
+			}
+		}
+	}
+	return zones
+}
+
+// needsZone reports whether ip is a link-local IPv6 address
+// without a zone.
+func needsZone(ip net.IP, zone string) bool {
+	return zone == "" && ip.To4() == nil && ip.IsLinkLocalUnicast()
+}
+
+// withZones returns addrs with each link-local IPv6 address
+// without a zone replaced by an address for each of the zones.
+// An address is kept as is if there are no zones.
+func withZones(addrs addrList, zones func() []string) addrList {
+	linkLocal := false
+	for i := 0; i < addrs.Len(); i++ {
+		if ip := addrs.IP(i); ip != nil && needsZone(ip, "") {
+			linkLocal = true
+			break
+		}
+	}
+	if !linkLocal {
+		return addrs
+	}
+	var zs []string
+	expand := func(ip net.IP, zone string) []string {
+		if !needsZone(ip, zone) {
+			return []string{zone}
+		}
+		if zs == nil {
+			if zs = zones(); len(zs) == 0 {
+				zs = []string{""}
+			}
+		}
+		return zs
+	}
+	switch list := addrs.(type) {
+	case tcpList:
+		var a tcpList
+		for _, addr := range list {
+			for _, zone := range expand(addr.IP, addr.Zone) {
+				a = append(a, &net.TCPAddr{IP: addr.IP, Port: addr.Port, Zone: zone})
+			}
+		}
+		return a
+	case udpList:
+		var a udpList
+		for _, addr := range list {
+			for _, zone := range expand(addr.IP, addr.Zone) {
+				a = append(a, &net.UDPAddr{IP: addr.IP, Port: addr.Port, Zone: zone})
+			}
+		}
+		return a
+	case ipList:
+		var a ipList
+		for _, addr := range list {
+			for _, zone := range expand(addr.IP, addr.Zone) {
+				a = append(a, &net.IPAddr{IP: addr.IP, Zone: zone})
+			}
+		}
+		return a
+	}
+	return addrs
+}
+
+// dialDirect connects to the address on the named network
+// without a proxy.
+func (d *Dialer) dialDirect(ctx context.Context, deadline time.Time, network, address string, publicOnly bool) (net.Conn, error) {
+	addrs, err := d.resolve(ctx, network, address, publicOnly)
+	if err != nil {
+		return nil, err
 	}
 	dialer := d.netDialer(deadline)
-	if addrs.Len() == 1 || len(network) < 3 || network[:3] != "tcp" {
-		return dialer.Dial(network, addrs.Addr(0))
+	trace := d.trace(ctx)
+	// Whether the addresses are raced.
+	race := addrs.Len() > 1 && len(network) >= 3 && network[:3] == "tcp" && d.DialStrategy != Sequential
+	var (
+		attempts int32
+		mu       sync.Mutex
+		failures []*AttemptError
+	)
+	// fail records the failed attempt to dial the i'th address,
+	// which took elapsed if it was started.
+	fail := func(i int, err error, elapsed time.Duration) error {
+		if oerr, ok := err.(*net.OpError); ok {
+			err = oerr.Err
+		}
+		mu.Lock()
+		failures = append(failures, &AttemptError{Phase: "connect", Addr: addrs.Addr(i), Err: err, Elapsed: elapsed})
+		mu.Unlock()
+		return err
+	}
+	dial := func(ctx context.Context, i int) (net.Conn, error) {
+		if err := d.wait(ctx, address); err != nil {
+			return nil, fail(i, err, 0)
+		}
+		if d.MaxConcurrentDials > 0 || d.MaxConcurrentDialsPerHost > 0 {
+			release, err := d.slots.acquire(ctx, hostOf(address), d.MaxConcurrentDials, d.MaxConcurrentDialsPerHost)
+			if err != nil {
+				return nil, fail(i, err, 0)
+			}
+			defer release()
+		}
+		actx := ctx
+		if d.AddrTimeout > 0 {
+			var cancel context.CancelFunc
+			actx, cancel = context.WithTimeout(ctx, d.AddrTimeout)
+			defer cancel()
+		}
+		attempt := int(atomic.AddInt32(&attempts, 1) - 1)
+		raddr := addrs.Addr(i)
+		addr := raddr.String()
+		dialer := dialer
+		if d.LocalAddrFunc != nil {
+			dialer.LocalAddr = d.LocalAddrFunc(raddr)
+		}
+		if ip := addrs.IP(i); d.Interface != "" && !canBindToDevice && ip != nil {
+			local, err := interfaceAddr(d.Interface, ip)
+			if err != nil {
+				return nil, fail(i, err, 0)
+			}
+			dialer.LocalAddr = localAddr(network, local)
+		}
+		if d.CircuitBreaker != nil {
+			if err := d.CircuitBreaker.allow(addr); err != nil {
+				return nil, fail(i, err, 0)
+			}
+		}
+		if d.OnDialStart != nil {
+			d.OnDialStart(network, addr, attempt)
+		}
+		if trace != nil && trace.ConnectStart != nil {
+			trace.ConnectStart(network, addr)
+		}
+		start := time.Now()
+		c, err := dialer.DialContext(actx, attemptNetwork(network, addrs.IP(i)), addr)
+		if err != nil && (actx.Err() == context.DeadlineExceeded || isTimeout(err)) {
+			err = ErrConnectTimeout
+		} else if isPermission(err) && network[:2] == "ip" {
+			err = ErrRawSocketPermission
+		}
+		if trace != nil && trace.ConnectDone != nil {
+			trace.ConnectDone(network, addr, err)
+		}
+		d.stats.record(addrs.IP(i), time.Since(start), err)
+		if d.CircuitBreaker != nil {
+			// Attempts aborted by the caller say nothing about the address.
+			d.CircuitBreaker.report(addr, err, ctx.Err() == nil)
+		}
+		if err == nil {
+			if err = d.setConnOptions(c); err == nil && race && d.HealthCheck != nil {
+				err = d.HealthCheck(c)
+			}
+			if err != nil {
+				c.Close()
+				c = nil
+			}
+		}
+		if d.OnDialDone != nil {
+			d.OnDialDone(network, addr, attempt, time.Since(start), err)
+		}
+		if err != nil {
+			reportFailure(ctx, d.Resolver, address, addrs.IP(i))
+			return nil, fail(i, err, time.Since(start))
+		}
+		return c, nil
 	}
-	return dialMulti(dialer, network, addrs)
+	var c net.Conn
+	switch {
+	case addrs.Len() == 1:
+		c, err = dial(ctx, 0)
+	case len(network) < 3 || network[:3] != "tcp":
+		// Connecting without a handshake only fails locally,
+		// so there is nothing to gain by racing the addresses.
+		c, err = dialSequential(ctx, addrs.Len(), dial)
+	case d.DialStrategy == Sequential:
+		c, err = dialSequential(ctx, addrs.Len(), dial)
+	case d.DialStrategy == HappyEyeballs:
+		order := d.Preference.indexes(addrs.Len(), addrs.IP)
+		c, err = dialStaggered(ctx, order, d.fallbackDelay(), d.CancelGracePeriod, dial)
+	default:
+		c, err = dialMulti(ctx, addrs.Len(), d.CancelGracePeriod, dial)
+	}
+	if err != nil {
+		mu.Lock()
+		defer mu.Unlock()
+		return nil, &DialError{Net: network, Address: address, Attempts: failures}
+	}
+	return c, nil
 }
 
-func resolveAddrsDeadline(resolver Resolver, filter ipFilter, network, address string, deadline time.Time) (addrList, error) {
-	if deadline.IsZero() {
-		return resolveAddrList(resolver, filter, network, address)
+func (d *Dialer) fallbackDelay() time.Duration {
+	if d.FallbackDelay > 0 {
+		return d.FallbackDelay
 	}
+	return 300 * time.Millisecond
+}
+
+// A DialStrategy specifies how a connection is established
+// when dialing multiple addresses.
+type DialStrategy int
 
-	timeout := deadline.Sub(time.Now())
-	if timeout <= 0 {
-		return nil, errTimeout
+const (
+	// Race dials all of the addresses at once and returns the
+	// first connection that is established.
+	Race DialStrategy = iota
+
+	// Sequential dials the addresses one at a time, in order,
+	// until a connection is established.
+	Sequential
+
+	// HappyEyeballs dials the addresses in the order specified
+	// by the Dialer's Preference, starting the next attempt when
+	// the previous one fails or after the Dialer's FallbackDelay,
+	// and returns the first connection that is established.
+	// See RFC 8305.
+	HappyEyeballs
+)
+
+// reportFailure reports a failed dial of ip, resolved from the host of
+// address, if resolver implements FailureReporter. Failures caused by
+// the context or of addresses that weren't resolved aren't reported.
+func reportFailure(ctx context.Context, resolver Resolver, address string, ip net.IP) {
+	r, ok := resolver.(FailureReporter)
+	if !ok || ip == nil || ctx.Err() != nil {
+		return
 	}
-	t := time.NewTimer(timeout)
-	defer t.Stop()
-	type res struct {
-		addrList
-		error
+	host := address
+	if h, _, err := net.SplitHostPort(address); err == nil {
+		host = h
 	}
-	resc := make(chan res, 1)
+	if host, _ = splitHostZone(host); parseIPv4(host) != nil {
+		return
+	}
+	if ip, _ := parseIPv6(host, false); ip != nil {
+		return
+	}
+	r.ReportFailure(host, ip)
+}
+
+func (d *Dialer) netDialer(deadline time.Time) net.Dialer {
+	nd := net.Dialer{
+		Deadline:  deadline,
+		LocalAddr: d.LocalAddr,
+		KeepAlive: d.KeepAlive,
+		Control:   d.control(),
+	}
+	if d.MultipathTCP {
+		setMultipathTCP(&nd, true)
+	}
+	return nd
+}
+
+// control returns the function that controls the Dialer's sockets.
+func (d *Dialer) control() func(network, address string, c syscall.RawConn) error {
+	bind := d.Interface != "" && canBindToDevice
+	if !bind && d.TrafficClass <= 0 {
+		return d.Control
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		if bind {
+			if err := bindToDevice(network, d.Interface, c); err != nil {
+				return err
+			}
+		}
+		if d.TrafficClass > 0 {
+			if err := setTrafficClass(network, c, d.TrafficClass); err != nil {
+				return err
+			}
+		}
+		if d.Control != nil {
+			return d.Control(network, address, c)
+		}
+		return nil
+	}
+}
+
+// interfaceAddr returns an IP address of the named interface
+// of the same family as ip.
+func interfaceAddr(name string, ip net.IP) (net.IP, error) {
+	ifi, err := interfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	v4 := ip.To4() != nil
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if (ipnet.IP.To4() != nil) == v4 {
+			return ipnet.IP, nil
+		}
+	}
+	return nil, &net.AddrError{Err: "no suitable address on interface", Addr: name}
+}
+
+// LocalAddrFamily returns a function, for use as a Dialer's
+// LocalAddrFunc, that selects ip4 as the local address when
+// dialing IPv4 addresses and ip6 when dialing IPv6 addresses.
+// If the selected IP is nil, the local address is chosen
+// automatically.
+func LocalAddrFamily(ip4, ip6 net.IP) func(remote net.Addr) net.Addr {
+	return func(remote net.Addr) net.Addr {
+		var ip net.IP
+		switch a := remote.(type) {
+		case *net.TCPAddr:
+			ip = a.IP
+		case *net.UDPAddr:
+			ip = a.IP
+		case *net.IPAddr:
+			ip = a.IP
+		default:
+			return nil
+		}
+		local := ip6
+		if ip.To4() != nil {
+			local = ip4
+		}
+		if local == nil {
+			return nil
+		}
+		return localAddr(remote.Network(), local)
+	}
+}
+
+// localAddr returns the local address of ip for the named network.
+func localAddr(network string, ip net.IP) net.Addr {
+	switch network[:2] {
+	case "tc":
+		return &net.TCPAddr{IP: ip}
+	case "ud":
+		return &net.UDPAddr{IP: ip}
+	}
+	return &net.IPAddr{IP: ip}
+}
+
+// wait waits for the Dialer's Limiter and HostLimiter to allow
+// an attempt to dial the address.
+func (d *Dialer) wait(ctx context.Context, address string) error {
+	if d.Limiter != nil {
+		if err := d.Limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if d.HostLimiter != nil {
+		if l := d.HostLimiter(hostOf(address)); l != nil {
+			return l.Wait(ctx)
+		}
+	}
+	return nil
+}
+
+// hostOf returns the host of the address.
+func hostOf(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return host
+}
+
+// setConnOptions applies the Dialer's TCP options to c.
+func (d *Dialer) setConnOptions(c net.Conn) error {
+	tc, ok := c.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if d.NoDelay != nil {
+		if err := tc.SetNoDelay(*d.NoDelay); err != nil {
+			return err
+		}
+	}
+	if d.ReadBufferSize > 0 {
+		if err := tc.SetReadBuffer(d.ReadBufferSize); err != nil {
+			return err
+		}
+	}
+	if d.WriteBufferSize > 0 {
+		if err := tc.SetWriteBuffer(d.WriteBufferSize); err != nil {
+			return err
+		}
+	}
+	if cfg := d.KeepAliveConfig; cfg != nil {
+		if err := cfg.apply(tc); err != nil {
+			return err
+		}
+	}
+	if d.TCPUserTimeout > 0 && canSetTCPUserTimeout {
+		rc, err := tc.SyscallConn()
+		if err != nil {
+			return err
+		}
+		ms := int((d.TCPUserTimeout + time.Millisecond - 1) / time.Millisecond)
+		if err := setTCPUserTimeout(rc, ms); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A KeepAliveConfig configures the keep-alive probes of a TCP
+// connection. A dead peer is detected within about Idle plus
+// Interval times Count after the connection was last used.
+type KeepAliveConfig struct {
+	// Idle is the time that the connection must be idle before
+	// the first probe is sent. If zero, the Dialer's KeepAlive
+	// or else the operating system's default is used.
+	Idle time.Duration
+
+	// Interval is the time between unacknowledged probes.
+	// If zero, the operating system's default is used.
+	// It's rounded up to the nearest second.
+	Interval time.Duration
+
+	// Count is the number of unacknowledged probes sent before
+	// the connection is dropped. If zero, the operating system's
+	// default is used.
+	Count int
+}
+
+// apply enables keep-alives on c as configured. Interval and Count
+// are only set on Linux and Darwin and are ignored elsewhere.
+func (cfg *KeepAliveConfig) apply(c *net.TCPConn) error {
+	if err := c.SetKeepAlive(true); err != nil {
+		return err
+	}
+	if cfg.Idle > 0 {
+		if err := c.SetKeepAlivePeriod(cfg.Idle); err != nil {
+			return err
+		}
+	}
+	if cfg.Interval <= 0 && cfg.Count <= 0 {
+		return nil
+	}
+	rc, err := c.SyscallConn()
+	if err != nil {
+		return err
+	}
+	secs := int((cfg.Interval + time.Second - 1) / time.Second)
+	return setKeepAliveProbes(rc, secs, cfg.Count)
+}
+
+// withConn calls f, which uses c, with the context's deadline
+// applied to c. c is closed if ctx is done first.
+func withConn(ctx context.Context, c net.Conn, f func() error) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+		defer c.SetDeadline(time.Time{})
+	}
+	done := make(chan struct{})
+	defer close(done)
 	go func() {
-		addrs, err := resolveAddrList(resolver, filter, network, address)
-		resc <- res{addrs, err}
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-done:
+		}
 	}()
-	select {
-	case <-t.C:
-		return nil, errTimeout
-	case r := <-resc:
-		return r.addrList, r.error
+	if err := f(); err != nil {
+		return streamError(ctx, err)
 	}
+	return nil
 }
 
-// dialMulti attempts to establish connections to each destination of
-// the list of addresses. It will return the first established
+// isTimeout reports whether err is a timeout.
+func isTimeout(err error) bool {
+	t, ok := err.(interface{ Timeout() bool })
+	return ok && t.Timeout()
+}
+
+// contextError maps an expired context's error to the error
+// returned from dialing.
+func contextError(err error) error {
+	if err == context.DeadlineExceeded {
+		return errTimeout
+	}
+	return err
+}
+
+// A detachedContext has the deadline and values of its parent,
+// but it isn't canceled with it.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool)       { return c.parent.Deadline() }
+func (c detachedContext) Done() <-chan struct{}             { return nil }
+func (c detachedContext) Err() error                        { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// raceContext returns a context for the attempts of a race, which is
+// done when ctx is done before the race ends, and a function that
+// ends the race. Once it has ended, the losing attempts are canceled
+// after the grace period, or at ctx's deadline if it's sooner.
+func raceContext(ctx context.Context) (context.Context, func(grace time.Duration)) {
+	rctx, cancel := context.WithCancel(detachedContext{ctx})
+	if deadline, ok := ctx.Deadline(); ok {
+		rctx, cancel = context.WithDeadline(rctx, deadline)
+	}
+	var (
+		mu    sync.Mutex
+		over  bool // the race has ended
+		ended = make(chan struct{})
+	)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Both may be ready, so check whether ctx
+			// was done before the race ended.
+			mu.Lock()
+			if !over {
+				cancel()
+			}
+			mu.Unlock()
+		case <-ended:
+		}
+	}()
+	var once sync.Once
+	return rctx, func(grace time.Duration) {
+		once.Do(func() {
+			mu.Lock()
+			over = true
+			mu.Unlock()
+			close(ended)
+			if grace > 0 {
+				time.AfterFunc(grace, cancel)
+			} else {
+				cancel()
+			}
+		})
+	}
+}
+
+// dialMulti attempts to establish connections to each of the n
+// destinations using dial. It will return the first established
 // connection and close the other connections. Otherwise it returns
-// error on the last attempt.
-func dialMulti(dialer net.Dialer, network string, addrs addrList) (net.Conn, error) {
+// error on the last attempt. The remaining attempts are canceled
+// after the grace period once a connection has been established.
+func dialMulti(ctx context.Context, n int, grace time.Duration, dial func(ctx context.Context, i int) (net.Conn, error)) (net.Conn, error) {
 	type racer struct {
 		net.Conn
 		error
 	}
-	addrsLen := addrs.Len()
+	// Abort the remaining attempts once one has won the race.
+	ctx, end := raceContext(ctx)
+	defer end(grace)
 	// Sig controls the flow of dial results on lane. It passes a
 	// token to the next racer and also indicates the end of flow
 	// by using closed channel.
 	sig := make(chan bool, 1)
 	lane := make(chan racer, 1)
-	for i := 0; i < addrsLen; i++ {
+	for i := 0; i < n; i++ {
 		go func(i int) {
-			c, err := dialer.Dial(network, addrs.Addr(i))
+			c, err := dial(ctx, i)
 			if _, ok := <-sig; ok {
 				lane <- racer{c, err}
 			} else if err == nil {
@@ -182,7 +1156,7 @@ func dialMulti(dialer net.Dialer, network string, addrs addrList) (net.Conn, err
 	}
 	defer close(sig)
 	lastErr := errTimeout
-	for i := 0; i < addrsLen; i++ {
+	for i := 0; i < n; i++ {
 		sig <- true
 		racer := <-lane
 		if racer.error == nil {
@@ -193,53 +1167,168 @@ func dialMulti(dialer net.Dialer, network string, addrs addrList) (net.Conn, err
 	return nil, lastErr
 }
 
-// defaultIP gives priority to IPv4 addresses and selects the first address.
-func defaultIP(ips []net.IP) []net.IP {
-	if len(ips) <= 1 {
-		return ips
+// dialSequential attempts to establish a connection to each of the
+// n destinations in order using dial. It returns the first established
+// connection. Otherwise it returns the error of the last attempt.
+func dialSequential(ctx context.Context, n int, dial func(ctx context.Context, i int) (net.Conn, error)) (net.Conn, error) {
+	var lastErr error
+	for i := 0; i < n; i++ {
+		c, err := dial(ctx, i)
+		if err == nil {
+			return c, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
 	}
-	v6 := -1
-	for i, ip := range ips {
-		if ipLen := len(ip); ipLen == net.IPv4len {
-			return ips[i : i+1]
-		} else if v6 == -1 && ipLen == net.IPv6len {
-			v6 = i
+	return nil, lastErr
+}
+
+// dialStaggered attempts to establish connections to the destinations
+// with the given indexes in order using dial. The next attempt starts
+// when the previous one fails or after delay. It returns the first
+// established connection and closes the others, whose attempts are
+// canceled after the grace period. Otherwise it returns the error
+// of the last attempt.
+func dialStaggered(ctx context.Context, order []int, delay, grace time.Duration, dial func(ctx context.Context, i int) (net.Conn, error)) (net.Conn, error) {
+	type result struct {
+		net.Conn
+		error
+	}
+	// Abort the remaining attempts once one has succeeded.
+	ctx, end := raceContext(ctx)
+	defer end(grace)
+	results := make(chan result, len(order))
+	next, pending := 0, 0
+	start := func() {
+		i := order[next]
+		next++
+		pending++
+		go func() {
+			c, err := dial(ctx, i)
+			results <- result{c, err}
+		}()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	start()
+	lastErr := errTimeout
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.error == nil {
+				// Close connections established by the
+				// attempts that are still pending.
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if r := <-results; r.error == nil {
+							r.Conn.Close()
+						}
+					}
+				}(pending)
+				return r.Conn, nil
+			}
+			lastErr = r.error
+			if next < len(order) {
+				start()
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(delay)
+			}
+		case <-timer.C:
+			if next < len(order) {
+				start()
+				timer.Reset(delay)
+			}
 		}
 	}
-	if v6 == -1 {
-		return nil // shouldn't ever happen
+	return nil, lastErr
+}
+
+// A Preference specifies which address family is preferred
+// when selecting and dialing addresses.
+type Preference int
+
+const (
+	// PreferIPv4 orders IPv4 addresses first.
+	PreferIPv4 Preference = iota
+
+	// PreferIPv6 orders IPv6 addresses first.
+	PreferIPv6
+
+	// PreferSystem keeps the order returned by the Resolver.
+	// The system resolver sorts addresses by RFC 6724.
+	PreferSystem
+)
+
+// apply returns a filter that orders ips by the preference
+// before selecting addresses from them with filter.
+func (p Preference) apply(filter ipFilter) ipFilter {
+	return func(ips []net.IP) []net.IP {
+		return filter(p.order(ips))
 	}
-	return ips[v6 : v6+1]
 }
 
-// DualStack selects the first IPv4 address
-// and IPv6 address in ips.
-func DualStack(ips []net.IP) []net.IP {
-	if len(ips) <= 1 {
+// order returns ips ordered by the preference. Addresses of
+// the preferred family come first and are interleaved with
+// those of the other family, as recommended by RFC 8305.
+// The relative order of addresses in each family is kept.
+func (p Preference) order(ips []net.IP) []net.IP {
+	if p == PreferSystem || len(ips) <= 1 {
 		return ips
 	}
-	var (
-		ipv4, ipv6 bool
-		a          []net.IP
-	)
-	for _, ip := range ips {
-		if ipLen := len(ip); !ipv4 && ipLen == net.IPv4len {
-			a = append(a, ip)
-			ipv4 = true
-		} else if !ipv6 && ipLen == net.IPv6len {
-			a = append(a, ip)
-			ipv6 = true
-		}
-		if ipv4 && ipv6 {
-			break
-		}
+	idx := p.indexes(len(ips), func(i int) net.IP { return ips[i] })
+	a := make([]net.IP, len(idx))
+	for j, i := range idx {
+		a[j] = ips[i]
 	}
 	return a
 }
 
+// indexes returns the indexes of n addresses, whose IPs are given
+// by ip, in the order of the preference as described by order.
+func (p Preference) indexes(n int, ip func(i int) net.IP) []int {
+	if p == PreferSystem {
+		idx := make([]int, n)
+		for i := range idx {
+			idx[i] = i
+		}
+		return idx
+	}
+	var v4, v6 []int
+	for i := 0; i < n; i++ {
+		if ip(i).To4() != nil {
+			v4 = append(v4, i)
+		} else {
+			v6 = append(v6, i)
+		}
+	}
+	first, second := v4, v6
+	if p == PreferIPv6 {
+		first, second = v6, v4
+	}
+	idx := make([]int, 0, n)
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			idx = append(idx, first[i])
+		}
+		if i < len(second) {
+			idx = append(idx, second[i])
+		}
+	}
+	return idx
+}
+
 type addrList interface {
 	Len() int
-	Addr(i int) string
+	Addr(i int) net.Addr
+	IP(i int) net.IP // nil for non-IP addresses
 }
 
 type tcpList []*net.TCPAddr
@@ -247,20 +1336,116 @@ type udpList []*net.UDPAddr
 type ipList []*net.IPAddr
 type unixList []*net.UnixAddr
 
-func (list tcpList) Len() int          { return len(list) }
-func (list tcpList) Addr(i int) string { return list[i].String() }
+func (list tcpList) Len() int            { return len(list) }
+func (list tcpList) Addr(i int) net.Addr { return list[i] }
+func (list tcpList) IP(i int) net.IP     { return list[i].IP }
 
-func (list udpList) Len() int          { return len(list) }
-func (list udpList) Addr(i int) string { return list[i].String() }
+func (list udpList) Len() int            { return len(list) }
+func (list udpList) Addr(i int) net.Addr { return list[i] }
+func (list udpList) IP(i int) net.IP     { return list[i].IP }
 
-func (list ipList) Len() int          { return len(list) }
-func (list ipList) Addr(i int) string { return list[i].String() }
+func (list ipList) Len() int            { return len(list) }
+func (list ipList) Addr(i int) net.Addr { return list[i] }
+func (list ipList) IP(i int) net.IP     { return list[i].IP }
 
-func (list unixList) Len() int          { return len(list) }
-func (list unixList) Addr(i int) string { return list[i].String() }
+func (list unixList) Len() int            { return len(list) }
+func (list unixList) Addr(i int) net.Addr { return list[i] }
+func (list unixList) IP(i int) net.IP     { return nil }
 
-type timeoutError struct{}
+type timeoutError struct {
+	op string // the phase that timed out, if known
+}
+
+func (e *timeoutError) Error() string {
+	if e.op == "" {
+		return "i/o timeout"
+	}
+	return e.op + " timeout"
+}
 
-func (e *timeoutError) Error() string   { return "i/o timeout" }
 func (e *timeoutError) Timeout() bool   { return true }
 func (e *timeoutError) Temporary() bool { return true }
+
+// A DialError records why a dial failed. It's returned by
+// the Dialer's methods.
+type DialError struct {
+	Net     string // network type of the dial, such as "tcp"
+	Address string // address given to the dial
+
+	// Attempts records the failures of the dial's phases and
+	// of each of its connection attempts, in the order they
+	// occurred. The last is the dial's error.
+	Attempts []*AttemptError
+}
+
+// An AttemptError records the failure of a phase of a dial.
+type AttemptError struct {
+	// Phase is "proxy" for selecting a proxy, "resolve" for
+	// resolving the address, "connect" for connecting to a
+	// resolved address, or "handshake" for a TLS or proxy
+	// handshake over an established connection.
+	Phase string
+	Addr  net.Addr // resolved address, or nil
+	Err   error
+
+	// Elapsed is how long the phase took before it failed,
+	// or zero if it's unknown, such as for a connection attempt
+	// that wasn't started.
+	Elapsed time.Duration
+}
+
+func newDialError(network, address, phase string, addr net.Addr, err error) *DialError {
+	return &DialError{
+		Net:      network,
+		Address:  address,
+		Attempts: []*AttemptError{{Phase: phase, Addr: addr, Err: err}},
+	}
+}
+
+func (e *DialError) Error() string {
+	s := "dial " + e.Net + " " + e.Address
+	for i, a := range e.Attempts {
+		if i == 0 {
+			s += ": "
+		} else {
+			s += "; "
+		}
+		s += a.Error()
+	}
+	return s
+}
+
+// Unwrap returns the dial's error, which is the error
+// of its last attempt.
+func (e *DialError) Unwrap() error {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+	return e.Attempts[len(e.Attempts)-1].Err
+}
+
+// Timeout reports whether the dial's error is a timeout.
+func (e *DialError) Timeout() bool {
+	return isTimeout(e.Unwrap())
+}
+
+// Temporary reports whether the dial's error is temporary.
+func (e *DialError) Temporary() bool {
+	t, ok := e.Unwrap().(interface{ Temporary() bool })
+	return ok && t.Temporary()
+}
+
+func (e *AttemptError) Error() string {
+	s := e.Phase
+	if e.Addr != nil {
+		s += " " + e.Addr.String()
+	}
+	s += ": " + e.Err.Error()
+	if e.Elapsed > 0 && isTimeout(e.Err) {
+		s += " after " + e.Elapsed.String()
+	}
+	return s
+}
+
+// Unwrap returns the attempt's error.
+func (e *AttemptError) Unwrap() error { return e.Err }
@@ -6,11 +6,22 @@ package nett
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/abursavich/nett/nettest"
 )
 
 func TestDialHTTP(t *testing.T) {
@@ -35,47 +46,547 @@ func TestDialHTTP(t *testing.T) {
 	}
 }
 
+type blockingResolver chan struct{}
+
+func (r blockingResolver) Resolve(string) ([]net.IP, error) {
+	<-r
+	return nil, errors.New("unreachable")
+}
+
+func TestDialContextCanceled(t *testing.T) {
+	defer func(fn func(context.Context, string) ([]net.IP, error)) {
+		lookupIPs = fn
+	}(lookupIPs)
+	lookupIPs = func(ctx context.Context, host string) ([]net.IP, error) {
+		<-ctx.Done()
+		return nil, &net.DNSError{Err: "operation was canceled", Name: host}
+	}
+	block := make(blockingResolver)
+	defer close(block)
+
+	for _, resolver := range []Resolver{nil, block} {
+		d := Dialer{Resolver: resolver}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		_, err := d.DialContext(ctx, "tcp", "foo.com:80")
+		if derr, ok := err.(*DialError); !ok || derr.Unwrap() != context.Canceled {
+			t.Errorf("resolver %T: expected %v; got %v", resolver, context.Canceled, err)
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err = d.DialContext(ctx, "tcp", "foo.com:80")
+		cancel()
+		if derr, ok := err.(*DialError); !ok || derr.Unwrap() != ErrResolveTimeout {
+			t.Errorf("resolver %T: expected %v; got %v", resolver, ErrResolveTimeout, err)
+		}
+
+		d.ResolveTimeout = 10 * time.Millisecond
+		_, err = d.DialContext(context.Background(), "tcp", "foo.com:80")
+		if derr, ok := err.(*DialError); !ok || derr.Unwrap() != ErrResolveTimeout {
+			t.Errorf("resolver %T: expected %v; got %v", resolver, ErrResolveTimeout, err)
+		} else if elapsed := derr.Attempts[0].Elapsed; elapsed < 10*time.Millisecond {
+			t.Errorf("resolver %T: resolve elapsed: expected at least 10ms; got %v", resolver, elapsed)
+		}
+	}
+}
+
 func TestDialMulti(t *testing.T) {
-	ips, err := lookupIPs("localhost")
+	ips, err := lookupIPs(context.Background(), "localhost")
 	if err != nil {
 		t.Fatalf("lookupIPs failed: %v", err)
 	}
-	if len(ips) < 2 || !supportsIPv4 || !supportsIPv6 {
+	if len(ips) < 2 || !SupportsIPv4() || !SupportsIPv6() {
 		t.Skip("localhost doesn't have a pair of different address family IP addresses")
 	}
 
-	touchServer := func(dss *dualStackServer, ln net.Listener) {
-		for {
-			c, err := ln.Accept()
-			if err != nil {
-				return
+	dss, err := nettest.NewDualStackServer([]nettest.StreamListener{
+		{Net: "tcp4", Addr: "127.0.0.1"},
+		{Net: "tcp6", Addr: "::1"},
+	})
+	if err != nil {
+		t.Fatalf("NewDualStackServer failed: %v", err)
+	}
+	defer dss.Teardown()
+	dss.Buildup(nettest.TouchServer)
+
+	d := &Dialer{Filter: FilterFunc(FirstEachFilter)} // dial all addresses
+	for i := 0; i < dss.Len(); i++ {
+		if c, err := d.Dial("tcp", "localhost:"+dss.Port()); err != nil {
+			t.Errorf("Dial failed: %v", err)
+		} else {
+			if network, err := nettest.ConnNetwork(c); err == nil {
+				dss.TeardownNetwork(network)
 			}
 			c.Close()
 		}
 	}
-	dss, err := newDualStackServer([]streamListener{
-		{net: "tcp4", addr: "127.0.0.1"},
-		{net: "tcp6", addr: "[::1]"},
-	})
+}
+
+func TestPreference(t *testing.T) {
+	a4, b4 := net.IP{192, 0, 2, 1}, net.IP{192, 0, 2, 2}
+	a6, b6 := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+	ips := []net.IP{a6, b6, a4, b4}
+	tests := []struct {
+		pref Preference
+		want []net.IP
+		one  net.IP
+	}{
+		{PreferIPv4, []net.IP{a4, a6, b4, b6}, a4},
+		{PreferIPv6, []net.IP{a6, a4, b6, b4}, a6},
+		{PreferSystem, []net.IP{a6, b6, a4, b4}, a6},
+	}
+	for _, tt := range tests {
+		if got := tt.pref.order(ips); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("preference %d: expected order %v; got %v", tt.pref, tt.want, got)
+		}
+		if got := tt.pref.apply(defaultIP)(ips); len(got) != 1 || !got[0].Equal(tt.one) {
+			t.Errorf("preference %d: expected %v; got %v", tt.pref, tt.one, got)
+		}
+	}
+}
+
+func TestDialAddrTimeout(t *testing.T) {
+	// 192.0.2.0/24 is reserved for documentation, so connects to it
+	// should hang until they time out.
+	d := &Dialer{Timeout: time.Minute, AddrTimeout: 50 * time.Millisecond}
+	start := time.Now()
+	c, err := d.Dial("tcp", "192.0.2.1:80")
+	if err == nil {
+		c.Close()
+		t.Skip("unexpectedly connected to 192.0.2.1")
+	}
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Skipf("192.0.2.1 isn't black-holed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("dial took %v", elapsed)
+	}
+	derr, ok := err.(*DialError)
+	if !ok || derr.Unwrap() != ErrConnectTimeout {
+		t.Fatalf("expected %v; got %v", ErrConnectTimeout, err)
+	}
+	if elapsed := derr.Attempts[0].Elapsed; elapsed < 40*time.Millisecond {
+		t.Fatalf("attempt elapsed: expected about 50ms; got %v", elapsed)
+	}
+}
+
+// testDial returns a dial function whose attempts to the destinations
+// fail or succeed after the given delays and which records the order
+// in which they were started.
+func testDial(fail []bool, delays []time.Duration) (func(context.Context, int) (net.Conn, error), func() []int) {
+	var (
+		mu      sync.Mutex
+		started []int
+	)
+	dial := func(ctx context.Context, i int) (net.Conn, error) {
+		mu.Lock()
+		started = append(started, i)
+		mu.Unlock()
+		select {
+		case <-time.After(delays[i]):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if fail[i] {
+			return nil, errors.New("refused")
+		}
+		c1, c2 := net.Pipe()
+		c2.Close()
+		return c1, nil
+	}
+	return dial, func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), started...)
+	}
+}
+
+func TestDialSequential(t *testing.T) {
+	dial, started := testDial([]bool{true, false, false}, []time.Duration{0, 0, 0})
+	c, err := dialSequential(context.Background(), 3, dial)
 	if err != nil {
-		t.Fatalf("newDualStackServer failed: %v", err)
+		t.Fatalf("unexpected error: %v", err)
 	}
-	defer dss.teardown()
-	if err := dss.buildup(touchServer); err != nil {
-		t.Fatalf("dualStackServer.buildup failed: %v", err)
+	c.Close()
+	if got, want := started(), []int{0, 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("attempts: expected %v; got %v", want, got)
 	}
+}
 
-	d := &Dialer{IPFilter: DualStack} // dial all addresses
-	for _ = range dss.lns {
-		if c, err := d.Dial("tcp", "localhost:"+dss.port); err != nil {
-			t.Errorf("Dial failed: %v", err)
-		} else {
-			if addr := c.LocalAddr().(*net.TCPAddr); addr.IP.To4() != nil {
-				dss.teardownNetwork("tcp4")
-			} else if addr.IP.To16() != nil && addr.IP.To4() == nil {
-				dss.teardownNetwork("tcp6")
+func TestDialStaggered(t *testing.T) {
+	// The first attempt fails fast, so the second starts immediately.
+	// The second hangs, so the third starts after the delay and wins.
+	dial, started := testDial([]bool{true, false, false}, []time.Duration{0, time.Minute, 0})
+	start := time.Now()
+	c, err := dialStaggered(context.Background(), []int{0, 1, 2}, 50*time.Millisecond, 0, dial)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Close()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 10*time.Second {
+		t.Fatalf("unexpected dial duration: %v", elapsed)
+	}
+	if got, want := started(), []int{0, 1, 2}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("attempts: expected %v; got %v", want, got)
+	}
+
+	// All attempts fail.
+	dial, _ = testDial([]bool{true, true}, []time.Duration{0, 0})
+	if _, err := dialStaggered(context.Background(), []int{1, 0}, time.Minute, 0, dial); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDialMultiGracePeriod(t *testing.T) {
+	canceled := make(chan time.Time, 1)
+	dial := func(ctx context.Context, i int) (net.Conn, error) {
+		if i == 1 {
+			<-ctx.Done()
+			canceled <- time.Now()
+			return nil, ctx.Err()
+		}
+		c1, c2 := net.Pipe()
+		c2.Close()
+		return c1, nil
+	}
+	for _, grace := range []time.Duration{0, 50 * time.Millisecond} {
+		ctx, cancel := context.WithCancel(context.Background())
+		c, err := dialMulti(ctx, 2, grace, dial)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		c.Close()
+		won := time.Now()
+		// Canceling the dial's context doesn't cut the grace period short.
+		cancel()
+		select {
+		case at := <-canceled:
+			if lingered := at.Sub(won); grace > 0 && lingered < grace/2 || lingered > grace+5*time.Second {
+				t.Fatalf("grace %v: loser canceled after %v", grace, lingered)
 			}
-			c.Close()
+		case <-time.After(10 * time.Second):
+			t.Fatalf("grace %v: loser wasn't canceled", grace)
+		}
+	}
+}
+
+func TestPreferenceIndexes(t *testing.T) {
+	ips := []net.IP{
+		net.ParseIP("192.0.2.1").To4(),
+		net.ParseIP("192.0.2.2").To4(),
+		net.ParseIP("2001:db8::1"),
+	}
+	ip := func(i int) net.IP { return ips[i] }
+	tests := []struct {
+		pref Preference
+		want []int
+	}{
+		{PreferIPv4, []int{0, 2, 1}},
+		{PreferIPv6, []int{2, 0, 1}},
+		{PreferSystem, []int{0, 1, 2}},
+	}
+	for _, tt := range tests {
+		if got := tt.pref.indexes(len(ips), ip); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: expected %v; got %v", tt.pref, tt.want, got)
+		}
+	}
+}
+
+func TestDialUDPFallback(t *testing.T) {
+	c, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+	port := c.LocalAddr().(*net.UDPAddr).Port
+
+	// Connecting from a loopback address to a non-local address fails.
+	d := &Dialer{
+		LocalAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+		Resolver:  StaticResolver{"test": {net.IPv4(192, 0, 2, 1), net.IPv4(127, 0, 0, 1)}},
+		IPFilter:  func(ips []net.IP) []net.IP { return ips },
+	}
+	conn, err := d.Dial("udp4", net.JoinHostPort("test", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	if ip := conn.RemoteAddr().(*net.UDPAddr).IP; !ip.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Fatalf("remote address: expected 127.0.0.1; got %v", ip)
+	}
+}
+
+type countConn struct {
+	net.Conn
+	n *int32
+}
+
+func (c countConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt32(c.n, int32(n))
+	return n, err
+}
+
+func TestDialHooks(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	var (
+		mu      sync.Mutex
+		events  []string
+		written int32
+	)
+	d := &Dialer{
+		DialStrategy: Sequential,
+		LocalAddr:    &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)},
+		Resolver:     StaticResolver{"test": {net.IPv4(192, 0, 2, 1), net.IPv4(127, 0, 0, 1)}},
+		IPFilter:     func(ips []net.IP) []net.IP { return ips },
+		OnDialStart: func(network, address string, attempt int) {
+			mu.Lock()
+			events = append(events, fmt.Sprintf("start %s %s %d", network, address, attempt))
+			mu.Unlock()
+		},
+		OnDialDone: func(network, address string, attempt int, elapsed time.Duration, err error) {
+			mu.Lock()
+			events = append(events, fmt.Sprintf("done %s %s %d %t", network, address, attempt, err == nil))
+			mu.Unlock()
+		},
+		OnConn: func(c net.Conn) net.Conn { return countConn{c, &written} },
+	}
+	c, err := d.Dial("tcp", net.JoinHostPort("test", port))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := atomic.LoadInt32(&written); n != 5 {
+		t.Fatalf("written: expected 5; got %d", n)
+	}
+	want := []string{
+		"start tcp 192.0.2.1:" + port + " 0",
+		"done tcp 192.0.2.1:" + port + " 0 false",
+		"start tcp 127.0.0.1:" + port + " 1",
+		"done tcp 127.0.0.1:" + port + " 1 true",
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("events: expected %q; got %q", want, events)
+	}
+}
+
+func TestDialTyped(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	d := &Dialer{Resolver: StaticResolver{"test": {net.IPv4(127, 0, 0, 1)}}}
+	tc, err := d.DialTCP("tcp", net.JoinHostPort("test", port))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tc.CloseWrite(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tc.Close()
+
+	uc, err := d.DialUDP("udp4", net.JoinHostPort("test", port))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	uc.Close()
+
+	if _, err := d.DialTCP("udp", net.JoinHostPort("test", port)); err == nil {
+		t.Fatal("expected error for mismatched network")
+	}
+}
+
+func TestDialControl(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+
+	var called []string
+	d := &Dialer{
+		Control: func(network, address string, c syscall.RawConn) error {
+			called = append(called, network+" "+address)
+			return nil
+		},
+	}
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Close()
+	if want := []string{"tcp4 " + ln.Addr().String()}; !reflect.DeepEqual(called, want) {
+		t.Fatalf("control: expected %q; got %q", want, called)
+	}
+
+	errControl := errors.New("control failed")
+	d.Control = func(network, address string, c syscall.RawConn) error { return errControl }
+	if _, err := d.Dial("tcp", ln.Addr().String()); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func loopbackInterface(t *testing.T) string {
+	ifts, err := net.Interfaces()
+	if err != nil {
+		t.Skipf("interfaces: %v", err)
+	}
+	for _, ifi := range ifts {
+		if ifi.Flags&net.FlagLoopback != 0 && ifi.Flags&net.FlagUp != 0 {
+			return ifi.Name
 		}
 	}
+	t.Skip("no loopback interface")
+	return ""
+}
+
+func TestDialInterface(t *testing.T) {
+	lo := loopbackInterface(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+
+	d := &Dialer{Interface: lo}
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Close()
+
+	ip, err := interfaceAddr(lo, net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ip.IsLoopback() {
+		t.Fatalf("interface address: expected loopback; got %v", ip)
+	}
+
+	d.Interface = "nett-missing0"
+	if _, err := d.Dial("tcp", ln.Addr().String()); err == nil {
+		t.Fatal("expected error for missing interface")
+	}
+}
+
+func TestLocalAddrFamily(t *testing.T) {
+	ip4, ip6 := net.IPv4(127, 0, 0, 1), net.IPv6loopback
+	local := LocalAddrFamily(ip4, ip6)
+	tests := []struct {
+		remote, want net.Addr
+	}{
+		{&net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 80}, &net.TCPAddr{IP: ip4}},
+		{&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 53}, &net.UDPAddr{IP: ip6}},
+		{&net.IPAddr{IP: net.ParseIP("2001:db8::1")}, &net.IPAddr{IP: ip6}},
+		{&net.UnixAddr{Name: "/tmp/sock", Net: "unix"}, nil},
+	}
+	for _, tt := range tests {
+		if got := local(tt.remote); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: expected %v; got %v", tt.remote, tt.want, got)
+		}
+	}
+	if got := LocalAddrFamily(nil, ip6)(tests[0].remote); got != nil {
+		t.Errorf("expected nil address; got %v", got)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+	d := &Dialer{LocalAddrFunc: local}
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+	if ip := c.LocalAddr().(*net.TCPAddr).IP; !ip.Equal(ip4) {
+		t.Fatalf("local address: expected %v; got %v", ip4, ip)
+	}
+}
+
+func TestDialLinkLocalZones(t *testing.T) {
+	defer func(fn func() []string) { linkLocalZones = fn }(linkLocalZones)
+	linkLocalZones = func() []string { return []string{"eth0", "eth1"} }
+
+	ctx := context.Background()
+	d := &Dialer{Filter: FilterFunc(func(ips []net.IP) []net.IP { return ips })}
+	resolve := func(address string) []string {
+		addrs, err := d.resolve(ctx, "tcp", address, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var a []string
+		for i := 0; i < addrs.Len(); i++ {
+			a = append(a, addrs.Addr(i).String())
+		}
+		return a
+	}
+	tests := []struct {
+		zone, address string
+		want          []string
+	}{
+		{"", "[fe80::1]:80", []string{"[fe80::1%eth0]:80", "[fe80::1%eth1]:80"}},
+		{"", "[fe80::1%eth2]:80", []string{"[fe80::1%eth2]:80"}},
+		{"", "[2001:db8::1]:80", []string{"[2001:db8::1]:80"}},
+		{"wlan0", "[fe80::1]:80", []string{"[fe80::1%wlan0]:80"}},
+	}
+	for _, tt := range tests {
+		d.DefaultZone = tt.zone
+		if got := resolve(tt.address); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("zone %q, %s: expected %v; got %v", tt.zone, tt.address, tt.want, got)
+		}
+	}
+}
+
+func TestDialError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+
+	// Both attempts fail: the first can't bind and the second is refused.
+	d := &Dialer{
+		DialStrategy: Sequential,
+		LocalAddr:    &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)},
+		Resolver:     StaticResolver{"test": {net.IPv4(192, 0, 2, 1), net.IPv4(127, 0, 0, 1)}},
+		IPFilter:     func(ips []net.IP) []net.IP { return ips },
+	}
+	_, err = d.Dial("tcp", net.JoinHostPort("test", port))
+	derr, ok := err.(*DialError)
+	if !ok {
+		t.Fatalf("expected *DialError; got %T: %v", err, err)
+	}
+	if len(derr.Attempts) != 2 {
+		t.Fatalf("attempts: expected 2; got %d: %v", len(derr.Attempts), derr)
+	}
+	for i, ip := range []string{"192.0.2.1", "127.0.0.1"} {
+		a := derr.Attempts[i]
+		if a.Phase != "connect" || a.Addr.String() != net.JoinHostPort(ip, port) || a.Err == nil {
+			t.Errorf("attempt %d: unexpected %v", i, a)
+		}
+	}
+	if derr.Unwrap() != derr.Attempts[1].Err {
+		t.Errorf("unwrap: expected last attempt's error; got %v", derr.Unwrap())
+	}
+
+	_, err = d.Dial("tcp", "missing.test:80")
+	if derr, ok := err.(*DialError); !ok || len(derr.Attempts) != 1 || derr.Attempts[0].Phase != "resolve" {
+		t.Fatalf("expected resolve error; got %v", err)
+	}
 }
@@ -0,0 +1,552 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A DNSResolver looks up the IP addresses of a host by sending
+// queries directly to nameservers, bypassing the system's resolver
+// configuration. Queries are sent over UDP and retried over TCP
+// if the response is truncated.
+type DNSResolver struct {
+	// Servers contains the addresses of the nameservers in the
+	// form "host:port", where host is an IP address literal.
+	// If the port is omitted, 53 is used.
+	//
+	// If a server fails to respond, the next one is tried.
+	Servers []string
+
+	// Timeout is the maximum amount of time a query to a single
+	// server will take.
+	//
+	// If zero, a timeout of 5 seconds is used.
+	Timeout time.Duration
+
+	// Rotate distributes queries among the servers in a
+	// round-robin fashion instead of always starting with
+	// the first.
+	Rotate bool
+
+	next uint32 // accessed atomically
+}
+
+// Resolve looks up the given host and returns its IP addresses.
+func (r *DNSResolver) Resolve(host string) ([]net.IP, error) {
+	return r.ResolveContext(context.Background(), "ip", host)
+}
+
+// ResolveContext looks up the given host using the provided
+// context and returns its IP addresses.
+func (r *DNSResolver) ResolveContext(ctx context.Context, network, host string) ([]net.IP, error) {
+	addrs, err := r.ResolveAddrs(ctx, network, host)
+	return addrs.IPs, err
+}
+
+// ResolveAddrs looks up the given host using the provided context
+// and returns its IP addresses with the TTL of their records.
+func (r *DNSResolver) ResolveAddrs(ctx context.Context, network, host string) (Addrs, error) {
+	return lookupDNS(ctx, r.exchange, randomDNSID, network, host)
+}
+
+func (r *DNSResolver) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	n := len(r.Servers)
+	if n == 0 {
+		return nil, &net.DNSError{Err: "no DNS servers"}
+	}
+	start := 0
+	if r.Rotate {
+		start = int(atomic.AddUint32(&r.next, 1)-1) % n
+	}
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	var lastErr error
+	for i := 0; i < n; i++ {
+		server := r.Servers[(start+i)%n]
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		qctx, cancel := context.WithTimeout(ctx, timeout)
+		resp, err := exchangeServer(qctx, server, query)
+		cancel()
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, contextError(ctx.Err())
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// exchangeServer sends query to server over UDP, falling back
+// to TCP if the response is truncated.
+func exchangeServer(ctx context.Context, server string, query []byte) ([]byte, error) {
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := exchangePacket(ctx, c, query)
+	c.Close()
+	if err != nil || resp[2]&0x02 == 0 { // TC: truncated
+		return resp, err
+	}
+	if c, err = d.DialContext(ctx, "tcp", server); err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return exchangeStream(ctx, c, query)
+}
+
+// exchangePacket sends query over c and returns the response.
+// Responses that don't match the query's ID are ignored.
+func exchangePacket(ctx context.Context, c net.Conn, query []byte) ([]byte, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-done:
+		}
+	}()
+	if _, err := c.Write(query); err != nil {
+		return nil, streamError(ctx, err)
+	}
+	buf := make([]byte, 0xFFFF)
+	for {
+		n, err := c.Read(buf)
+		if err != nil {
+			return nil, streamError(ctx, err)
+		}
+		if n >= dnsHeaderLen && buf[0] == query[0] && buf[1] == query[1] {
+			return buf[:n], nil
+		}
+	}
+}
+
+// A DoTResolver looks up the IP addresses of a host using
+// DNS over TLS, as described in RFC 7858. Queries are pipelined
+// on a connection that's kept open until it's idle for 10 seconds
+// and dialed again if it fails.
+type DoTResolver struct {
+	// Addr is the server's address in the form "host:port".
+	// If the port is omitted, 853 is used.
+	Addr string
+
+	// TLSConfig configures the TLS client. If its ServerName
+	// is empty, the host of Addr is used.
+	//
+	// If nil, the default configuration is used.
+	TLSConfig *tls.Config
+
+	// Bootstrap contains the server's IP addresses. They are
+	// used instead of resolving the host of Addr.
+	//
+	// If empty, the host of Addr is resolved by DefaultResolver.
+	Bootstrap []net.IP
+
+	// Timeout is the maximum amount of time a lookup will take.
+	//
+	// The default is no timeout.
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	dc      *dotConn      // connection kept open for queries
+	dialing chan struct{} // closed when dialing dc is done
+}
+
+// Resolve looks up the given host and returns its IP addresses.
+func (r *DoTResolver) Resolve(host string) ([]net.IP, error) {
+	return r.ResolveContext(context.Background(), "ip", host)
+}
+
+// ResolveContext looks up the given host using the provided
+// context and returns its IP addresses.
+func (r *DoTResolver) ResolveContext(ctx context.Context, network, host string) ([]net.IP, error) {
+	addrs, err := r.ResolveAddrs(ctx, network, host)
+	return addrs.IPs, err
+}
+
+// ResolveAddrs looks up the given host using the provided context
+// and returns its IP addresses with the TTL of their records.
+func (r *DoTResolver) ResolveAddrs(ctx context.Context, network, host string) (Addrs, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	return lookupDNS(ctx, r.exchange, randomDNSID, network, host)
+}
+
+func (r *DoTResolver) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	for i := 0; ; i++ {
+		dc, reused, err := r.conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := dc.exchange(ctx, query)
+		if err == nil || ctx.Err() != nil || !reused || i > 0 {
+			return resp, err
+		}
+		// The server may have closed the connection while it was
+		// idle, so the query is sent again on a new connection.
+	}
+}
+
+// conn returns the open connection to the server, or a new one,
+// and whether it was already open. Only one connection is dialed
+// at a time.
+func (r *DoTResolver) conn(ctx context.Context) (*dotConn, bool, error) {
+	r.mu.Lock()
+	for {
+		if dc := r.dc; dc != nil && !dc.failed() {
+			r.mu.Unlock()
+			return dc, true, nil
+		}
+		dialing := r.dialing
+		if dialing == nil {
+			break
+		}
+		r.mu.Unlock()
+		select {
+		case <-dialing:
+		case <-ctx.Done():
+			return nil, false, contextError(ctx.Err())
+		}
+		r.mu.Lock()
+	}
+	dialing := make(chan struct{})
+	r.dialing = dialing
+	r.mu.Unlock()
+
+	dc, err := r.dial(ctx)
+	r.mu.Lock()
+	if err == nil {
+		r.dc = dc
+	}
+	r.dialing = nil
+	close(dialing)
+	r.mu.Unlock()
+	return dc, false, err
+}
+
+// dial connects to the server.
+func (r *DoTResolver) dial(ctx context.Context) (*dotConn, error) {
+	addr := r.Addr
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, addr = addr, net.JoinHostPort(addr, "853")
+	}
+	c, err := dialBootstrap(ctx, r.Bootstrap, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	cfg := cloneTLSConfig(r.TLSConfig)
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	tc := tls.Client(c, cfg)
+	if err := withConn(ctx, tc, tc.Handshake); err != nil {
+		tc.Close()
+		return nil, err
+	}
+	return newDoTConn(tc), nil
+}
+
+// dotIdleTimeout is how long a connection to a DoT server is kept
+// open without any queries in flight.
+const dotIdleTimeout = 10 * time.Second
+
+// A dotConn is a connection to a DoT server on which queries are
+// pipelined and their responses matched by message ID, as described
+// in RFC 7766. Queries are given IDs that are unique among those in
+// flight, which are replaced by their own in the responses.
+type dotConn struct {
+	c   net.Conn
+	wmu sync.Mutex // serializes writes
+
+	mu      sync.Mutex
+	id      uint16 // next message ID
+	pending map[uint16]chan []byte
+	err     error // set once the connection fails
+}
+
+func newDoTConn(c net.Conn) *dotConn {
+	dc := &dotConn{c: c, pending: make(map[uint16]chan []byte)}
+	go dc.read()
+	return dc
+}
+
+// read delivers responses to the queries in flight until the
+// connection fails or is idle for too long.
+func (dc *dotConn) read() {
+	for {
+		msg, err := readDNSStream(dc.c)
+		dc.mu.Lock()
+		if err != nil {
+			dc.fail(err)
+			dc.mu.Unlock()
+			return
+		}
+		if len(msg) >= dnsHeaderLen {
+			id := uint16(msg[0])<<8 | uint16(msg[1])
+			if ch, ok := dc.pending[id]; ok {
+				ch <- msg
+				dc.done(id)
+			}
+		}
+		dc.mu.Unlock()
+	}
+}
+
+// failed reports whether the connection has failed.
+func (dc *dotConn) failed() bool {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.err != nil
+}
+
+// fail closes the connection and the channels of the queries in
+// flight, which then fail with err. dc.mu must be held.
+func (dc *dotConn) fail(err error) {
+	if dc.err == nil {
+		dc.err = err
+		dc.c.Close()
+	}
+	for id, ch := range dc.pending {
+		delete(dc.pending, id)
+		close(ch)
+	}
+}
+
+// done removes the query with the given ID from those in flight.
+// dc.mu must be held.
+func (dc *dotConn) done(id uint16) {
+	delete(dc.pending, id)
+	if len(dc.pending) == 0 && dc.err == nil {
+		dc.c.SetReadDeadline(time.Now().Add(dotIdleTimeout))
+	}
+}
+
+// exchange sends query over the connection and returns the response.
+func (dc *dotConn) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	ch := make(chan []byte, 1)
+	dc.mu.Lock()
+	if dc.err != nil {
+		err := dc.err
+		dc.mu.Unlock()
+		return nil, err
+	}
+	id := dc.id
+	for dc.pending[id] != nil {
+		id++
+	}
+	dc.id = id + 1
+	dc.pending[id] = ch
+	dc.c.SetReadDeadline(time.Time{})
+	dc.mu.Unlock()
+
+	msg := append([]byte(nil), query...)
+	msg[0], msg[1] = byte(id>>8), byte(id)
+	dc.wmu.Lock()
+	deadline, _ := ctx.Deadline()
+	dc.c.SetWriteDeadline(deadline)
+	err := writeDNSStream(dc.c, msg)
+	dc.wmu.Unlock()
+	if err != nil {
+		// The message may have been partially written.
+		dc.mu.Lock()
+		dc.fail(err)
+		dc.mu.Unlock()
+		return nil, streamError(ctx, err)
+	}
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			dc.mu.Lock()
+			err := dc.err
+			dc.mu.Unlock()
+			return nil, err
+		}
+		resp[0], resp[1] = query[0], query[1]
+		return resp, nil
+	case <-ctx.Done():
+		dc.mu.Lock()
+		if dc.pending[id] == ch {
+			dc.done(id)
+		}
+		dc.mu.Unlock()
+		return nil, contextError(ctx.Err())
+	}
+}
+
+// exchangeStream sends query over c with DNS stream framing and
+// returns the response. c is closed if ctx is done first.
+func exchangeStream(ctx context.Context, c net.Conn, query []byte) ([]byte, error) {
+	var resp []byte
+	err := withConn(ctx, c, func() error {
+		if err := writeDNSStream(c, query); err != nil {
+			return err
+		}
+		var err error
+		resp, err = readDNSStream(c)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// streamError returns the context's error if it's done,
+// since that's what caused err.
+func streamError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return contextError(ctx.Err())
+	}
+	return err
+}
+
+// A DoHResolver looks up the IP addresses of a host using
+// DNS over HTTPS, as described in RFC 8484.
+type DoHResolver struct {
+	// URL is the server's URI template without variables,
+	// such as "https://dns.example.com/dns-query".
+	// Queries are sent using the POST method.
+	URL string
+
+	// Client sends the queries to the server.
+	//
+	// If nil, a client is used which connects to the server
+	// using TLSConfig and Bootstrap.
+	Client *http.Client
+
+	// TLSConfig configures the TLS client if Client is nil.
+	//
+	// If nil, the default configuration is used.
+	TLSConfig *tls.Config
+
+	// Bootstrap contains the server's IP addresses if Client is
+	// nil. They are used instead of resolving the host of URL.
+	//
+	// If empty, the host of URL is resolved by DefaultResolver.
+	Bootstrap []net.IP
+
+	// Timeout is the maximum amount of time a lookup will take.
+	//
+	// The default is no timeout.
+	Timeout time.Duration
+
+	once   sync.Once
+	client *http.Client
+}
+
+// Resolve looks up the given host and returns its IP addresses.
+func (r *DoHResolver) Resolve(host string) ([]net.IP, error) {
+	return r.ResolveContext(context.Background(), "ip", host)
+}
+
+// ResolveContext looks up the given host using the provided
+// context and returns its IP addresses.
+func (r *DoHResolver) ResolveContext(ctx context.Context, network, host string) ([]net.IP, error) {
+	addrs, err := r.ResolveAddrs(ctx, network, host)
+	return addrs.IPs, err
+}
+
+// ResolveAddrs looks up the given host using the provided context
+// and returns its IP addresses with the TTL of their records.
+func (r *DoHResolver) ResolveAddrs(ctx context.Context, network, host string) (Addrs, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	// RFC 8484 recommends an ID of 0 to maximize cache friendliness.
+	zero := func() uint16 { return 0 }
+	return lookupDNS(ctx, r.exchange, zero, network, host)
+}
+
+const dnsMessageType = "application/dns-message"
+
+func (r *DoHResolver) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	req, err := http.NewRequest("POST", r.URL, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dnsMessageType)
+	req.Header.Set("Accept", dnsMessageType)
+	resp, err := r.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, streamError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<10))
+		return nil, &net.DNSError{Err: "unexpected HTTP status: " + resp.Status, Server: r.URL}
+	}
+	msg, err := ioutil.ReadAll(io.LimitReader(resp.Body, 0xFFFF))
+	if err != nil {
+		return nil, streamError(ctx, err)
+	}
+	return msg, nil
+}
+
+func (r *DoHResolver) httpClient() *http.Client {
+	if r.Client != nil {
+		return r.Client
+	}
+	r.once.Do(func() {
+		bootstrap := r.Bootstrap
+		r.client = &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					return dialBootstrap(ctx, bootstrap, network, address)
+				},
+				TLSClientConfig:     r.TLSConfig,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+		}
+	})
+	return r.client
+}
+
+// dialBootstrap connects to the address on the named network. If
+// bootstrap isn't empty, its addresses are dialed instead of
+// resolving the host of address.
+func dialBootstrap(ctx context.Context, bootstrap []net.IP, network, address string) (net.Conn, error) {
+	d := &Dialer{Filter: FilterFunc(FirstEachFilter)}
+	if len(bootstrap) > 0 {
+		d.Resolver = bootstrapResolver(bootstrap)
+	}
+	return d.DialContext(ctx, network, address)
+}
+
+// bootstrapResolver resolves every host to its IP addresses.
+type bootstrapResolver []net.IP
+
+func (r bootstrapResolver) Resolve(string) ([]net.IP, error) {
+	ips := make([]net.IP, len(r))
+	copy(ips, r)
+	return ips, nil
+}
@@ -0,0 +1,276 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testDNSRecords are the records served by testDNSResponse.
+var testDNSRecords = map[string][]net.IP{
+	"example.com": {net.IPv4(192, 0, 2, 1), net.ParseIP("2001:db8::1")},
+}
+
+// testDNSResponse returns a response to the query with the answers
+// for testDNSRecords, using compression pointers to the question.
+func testDNSResponse(query []byte) []byte {
+	var (
+		name string
+		off  = dnsHeaderLen
+	)
+	for query[off] != 0 {
+		n := int(query[off])
+		if name != "" {
+			name += "."
+		}
+		name += string(query[off+1 : off+1+n])
+		off += 1 + n
+	}
+	off++
+	qtype := uint16(query[off])<<8 | uint16(query[off+1])
+	resp := append([]byte(nil), query[:off+4]...)
+	resp[2] |= 0x80 // QR: response
+	ips, ok := testDNSRecords[name]
+	if !ok {
+		resp[3] = dnsRcodeNameError
+		return resp
+	}
+	var ancount int
+	for _, ip := range ips {
+		rdata := []byte(ip.To4())
+		typ := uint16(dnsTypeA)
+		if rdata == nil {
+			rdata, typ = ip, dnsTypeAAAA
+		}
+		if typ != qtype {
+			continue
+		}
+		resp = append(resp, 0xC0, dnsHeaderLen, byte(typ>>8), byte(typ), 0, dnsClassINET, 0, 0, 0, 60, 0, byte(len(rdata)))
+		resp = append(resp, rdata...)
+		ancount++
+	}
+	resp[7] = byte(ancount)
+	return resp
+}
+
+func testDNSLookups(t *testing.T, r Resolver) {
+	ips, err := r.Resolve("example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []net.IP{net.IP{192, 0, 2, 1}.To16(), net.ParseIP("2001:db8::1")}
+	if !reflect.DeepEqual(ips, want) {
+		t.Fatalf("ips: expected %v; got %v", want, ips)
+	}
+	if ra, ok := r.(ResolverAddrs); ok {
+		addrs, err := ra.ResolveAddrs(context.Background(), "ip", "example.com")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if addrs.TTL != time.Minute || addrs.Source != SourceNetwork {
+			t.Fatalf("expected TTL 1m0s from the network; got %v from %q", addrs.TTL, addrs.Source)
+		}
+	}
+	_, err = r.Resolve("nx.example.com")
+	if derr, ok := err.(*net.DNSError); !ok || derr.Err != "no such host" || derr.Name != "nx.example.com" {
+		t.Fatalf("expected no such host error; got %v", err)
+	}
+}
+
+func TestDoHResolver(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != dnsMessageType {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		query, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", dnsMessageType)
+		w.Write(testDNSResponse(query))
+	}))
+	defer srv.Close()
+
+	testDNSLookups(t, &DoHResolver{
+		URL:       srv.URL + "/dns-query",
+		TLSConfig: &tls.Config{InsecureSkipVerify: true},
+		Timeout:   5 * time.Second,
+	})
+}
+
+func TestDoTResolver(t *testing.T) {
+	certs := httptest.NewUnstartedServer(nil)
+	certs.StartTLS()
+	defer certs.Close()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", certs.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- c
+			go func(c net.Conn) {
+				defer c.Close()
+				var mu sync.Mutex
+				for {
+					query, err := readDNSStream(c)
+					if err != nil {
+						return
+					}
+					// Respond concurrently, so that responses
+					// may be out of order.
+					go func() {
+						mu.Lock()
+						defer mu.Unlock()
+						writeDNSStream(c, testDNSResponse(query))
+					}()
+				}
+			}(c)
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	r := &DoTResolver{
+		Addr:      "dns.example:" + port,
+		TLSConfig: &tls.Config{InsecureSkipVerify: true},
+		Bootstrap: []net.IP{net.IPv4(127, 0, 0, 1)},
+		Timeout:   5 * time.Second,
+	}
+	testDNSLookups(t, r)
+	if n := len(conns); n != 1 {
+		t.Fatalf("connections: expected 1; got %d", n)
+	}
+
+	// The server closes the connection, so it's dialed again.
+	c := <-conns
+	c.Close()
+	r.mu.Lock()
+	dc := r.dc
+	r.mu.Unlock()
+	for !dc.failed() {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := r.Resolve("example.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len(conns); n != 1 {
+		t.Fatalf("connections: expected 1 more; got %d", n)
+	}
+}
+
+func TestParseDNSResponse(t *testing.T) {
+	query, err := packDNSQuery(1, "example.com", dnsTypeA)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp := testDNSResponse(query)
+	copy(resp[dnsHeaderLen+1:], "EXAMPLE") // servers may change the case
+	if ips, _, err := parseDNSResponse(resp, query, dnsTypeA); err != nil || len(ips) != 1 {
+		t.Fatalf("unexpected result: %v, %v", ips, err)
+	}
+
+	other, err := packDNSQuery(1, "example.org", dnsTypeA)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, err := parseDNSResponse(resp, other, dnsTypeA); err != errDNSMessage {
+		t.Fatalf("other name: expected %v; got %v", errDNSMessage, err)
+	}
+	other, err = packDNSQuery(1, "example.com", dnsTypeAAAA)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, err := parseDNSResponse(resp, other, dnsTypeAAAA); err != errDNSMessage {
+		t.Fatalf("other type: expected %v; got %v", errDNSMessage, err)
+	}
+	other, err = packDNSQuery(2, "example.com", dnsTypeA)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, err := parseDNSResponse(resp, other, dnsTypeA); err != errDNSMessage {
+		t.Fatalf("other ID: expected %v; got %v", errDNSMessage, err)
+	}
+}
+
+func TestDNSResolver(t *testing.T) {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	ln, err := net.Listen("tcp4", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	tcpQueries := make(chan struct{}, 10)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			resp := testDNSResponse(buf[:n])
+			if resp[dnsHeaderLen+len("example.com")+3] == dnsTypeAAAA {
+				// Truncate AAAA responses to force TCP.
+				resp = resp[:len(buf[:n])]
+				resp[2] |= 0x02
+				resp[7] = 0
+			}
+			pc.WriteTo(resp, addr)
+		}
+	}()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			tcpQueries <- struct{}{}
+			go func(c net.Conn) {
+				defer c.Close()
+				query, err := readDNSStream(c)
+				if err != nil {
+					return
+				}
+				writeDNSStream(c, testDNSResponse(query))
+			}(c)
+		}
+	}()
+
+	// The first server refuses queries, so the second is used.
+	dead, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadAddr := dead.LocalAddr().String()
+	dead.Close()
+
+	testDNSLookups(t, &DNSResolver{
+		Servers: []string{deadAddr, pc.LocalAddr().String()},
+		Timeout: time.Second,
+	})
+	if len(tcpQueries) == 0 {
+		t.Fatal("truncated response wasn't retried over TCP")
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Minimal DNS message packing and parsing for A and AAAA queries.
+// See RFC 1035 and RFC 3596.
+
+package nett
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	dnsTypeA     = 1
+	dnsTypeAAAA  = 28
+	dnsClassINET = 1
+
+	dnsHeaderLen = 12
+
+	dnsRcodeSuccess   = 0
+	dnsRcodeNameError = 3
+)
+
+var errDNSMessage = errors.New("malformed DNS message")
+
+// dnsExchange sends a DNS query message and returns the response.
+type dnsExchange func(ctx context.Context, query []byte) ([]byte, error)
+
+// randomDNSID returns a random DNS message ID.
+func randomDNSID() uint16 {
+	var b [2]byte
+	io.ReadFull(rand.Reader, b[:])
+	return uint16(b[0])<<8 | uint16(b[1])
+}
+
+// lookupDNS looks up the addresses of host with exchange. The
+// network specifies which records are queried: "ip" for A and
+// AAAA, "ip4" for A, or "ip6" for AAAA. Queries use message IDs
+// returned by id. The TTL of the addresses is the shortest TTL
+// of their records.
+func lookupDNS(ctx context.Context, exchange dnsExchange, id func() uint16, network, host string) (Addrs, error) {
+	var qtypes []uint16
+	switch network {
+	case "ip4":
+		qtypes = []uint16{dnsTypeA}
+	case "ip6":
+		qtypes = []uint16{dnsTypeAAAA}
+	default:
+		qtypes = []uint16{dnsTypeA, dnsTypeAAAA}
+	}
+	type res struct {
+		ips []net.IP
+		ttl time.Duration
+		err error
+	}
+	results := make([]res, len(qtypes))
+	var wg sync.WaitGroup
+	for i, qtype := range qtypes {
+		wg.Add(1)
+		go func(i int, qtype uint16) {
+			defer wg.Done()
+			ips, ttl, err := queryDNS(ctx, exchange, id(), host, qtype)
+			results[i] = res{ips, ttl, err}
+		}(i, qtype)
+	}
+	wg.Wait()
+	var (
+		addrs    = Addrs{Source: SourceNetwork}
+		firstErr error
+	)
+	for _, r := range results {
+		addrs.IPs = append(addrs.IPs, r.ips...)
+		if len(r.ips) > 0 && (addrs.TTL == 0 || r.ttl < addrs.TTL) {
+			addrs.TTL = r.ttl
+		}
+		if firstErr == nil {
+			firstErr = r.err
+		}
+	}
+	if len(addrs.IPs) > 0 {
+		return addrs, nil
+	}
+	if firstErr != nil {
+		return Addrs{}, firstErr
+	}
+	return Addrs{}, &net.DNSError{Err: "no such host", Name: host}
+}
+
+// queryDNS sends a query for host's records of qtype with exchange.
+func queryDNS(ctx context.Context, exchange dnsExchange, id uint16, host string, qtype uint16) ([]net.IP, time.Duration, error) {
+	query, err := packDNSQuery(id, host, qtype)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := exchange(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	ips, ttl, err := parseDNSResponse(resp, query, qtype)
+	if err != nil {
+		if derr, ok := err.(*net.DNSError); ok {
+			derr.Name = host
+		}
+		return nil, 0, err
+	}
+	return ips, ttl, nil
+}
+
+// packDNSQuery returns a recursive query message for the records
+// of name with the given type.
+func packDNSQuery(id uint16, name string, qtype uint16) ([]byte, error) {
+	if !isDomainName(name) {
+		return nil, &net.DNSError{Err: "invalid domain name", Name: name}
+	}
+	msg := make([]byte, dnsHeaderLen, dnsHeaderLen+len(name)+6)
+	msg[0], msg[1] = byte(id>>8), byte(id)
+	msg[2] = 0x01 // RD: recursion desired
+	msg[5] = 1    // QDCOUNT
+	for len(name) > 0 {
+		i := byteIndex(name, '.')
+		if i < 0 {
+			i = len(name)
+		}
+		msg = append(msg, byte(i))
+		msg = append(msg, name[:i]...)
+		if i == len(name) {
+			break
+		}
+		name = name[i+1:]
+	}
+	msg = append(msg, 0, byte(qtype>>8), byte(qtype), 0, dnsClassINET)
+	return msg, nil
+}
+
+// parseDNSResponse returns the addresses in the answers of a response
+// to the query for records of the given type and the shortest TTL of
+// their records. The response must have the query's ID and question.
+// CNAME answers are skipped.
+func parseDNSResponse(msg, query []byte, qtype uint16) ([]net.IP, time.Duration, error) {
+	if len(msg) < dnsHeaderLen {
+		return nil, 0, errDNSMessage
+	}
+	if msg[0] != query[0] || msg[1] != query[1] || msg[2]&0x80 == 0 {
+		return nil, 0, errDNSMessage
+	}
+	switch msg[3] & 0x0F {
+	case dnsRcodeSuccess:
+	case dnsRcodeNameError:
+		return nil, 0, &net.DNSError{Err: "no such host"}
+	default:
+		return nil, 0, &net.DNSError{Err: "server misbehaving"}
+	}
+	qdcount := int(msg[4])<<8 | int(msg[5])
+	ancount := int(msg[6])<<8 | int(msg[7])
+	question := query[dnsHeaderLen:]
+	if qdcount != 1 || !equalDNSQuestion(msg[dnsHeaderLen:], question) {
+		return nil, 0, errDNSMessage
+	}
+	off := dnsHeaderLen + len(question)
+	var (
+		ips    []net.IP
+		minTTL uint32
+	)
+	for i := 0; i < ancount; i++ {
+		var ok bool
+		if off, ok = skipDNSName(msg, off); !ok || off+10 > len(msg) {
+			return nil, 0, errDNSMessage
+		}
+		typ := uint16(msg[off])<<8 | uint16(msg[off+1])
+		class := uint16(msg[off+2])<<8 | uint16(msg[off+3])
+		ttl := uint32(msg[off+4])<<24 | uint32(msg[off+5])<<16 | uint32(msg[off+6])<<8 | uint32(msg[off+7])
+		rdlen := int(msg[off+8])<<8 | int(msg[off+9])
+		off += 10
+		if off+rdlen > len(msg) {
+			return nil, 0, errDNSMessage
+		}
+		rdata := msg[off : off+rdlen]
+		off += rdlen
+		if typ != qtype || class != dnsClassINET {
+			continue
+		}
+		switch {
+		case typ == dnsTypeA && rdlen == net.IPv4len:
+			ips = append(ips, net.IPv4(rdata[0], rdata[1], rdata[2], rdata[3]))
+		case typ == dnsTypeAAAA && rdlen == net.IPv6len:
+			ip := make(net.IP, net.IPv6len)
+			copy(ip, rdata)
+			ips = append(ips, ip)
+		default:
+			continue
+		}
+		if len(ips) == 1 || ttl < minTTL {
+			minTTL = ttl
+		}
+	}
+	if len(ips) > 0 && minTTL == 0 {
+		// A TTL of zero means the records aren't to be cached,
+		// but an Addrs TTL of zero means it's unknown.
+		minTTL = 1
+	}
+	return ips, time.Duration(minTTL) * time.Second, nil
+}
+
+// equalDNSQuestion reports whether msg begins with question,
+// ignoring the case of its name, which servers may change.
+func equalDNSQuestion(msg, question []byte) bool {
+	if len(msg) < len(question) {
+		return false
+	}
+	n := len(question) - 4 // QTYPE, QCLASS
+	return lowerASCII(string(msg[:n])) == lowerASCII(string(question[:n])) &&
+		string(msg[n:len(question)]) == string(question[n:])
+}
+
+// skipDNSName returns the offset following the name at off in msg.
+func skipDNSName(msg []byte, off int) (int, bool) {
+	for off < len(msg) {
+		c := int(msg[off])
+		switch c & 0xC0 {
+		case 0x00:
+			if c == 0 {
+				return off + 1, true
+			}
+			off += 1 + c
+		case 0xC0:
+			// Compression pointer; the name ends here.
+			if off+2 > len(msg) {
+				return 0, false
+			}
+			return off + 2, true
+		default:
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// writeDNSStream writes msg to c prefixed by its length, as used by
+// DNS over TCP and TLS.
+func writeDNSStream(c net.Conn, msg []byte) error {
+	if len(msg) > 0xFFFF {
+		return errDNSMessage
+	}
+	b := make([]byte, 2+len(msg))
+	b[0], b[1] = byte(len(msg)>>8), byte(len(msg))
+	copy(b[2:], msg)
+	_, err := c.Write(b)
+	return err
+}
+
+// readDNSStream reads a length prefixed message from c, as used by
+// DNS over TCP and TLS.
+func readDNSStream(c net.Conn) ([]byte, error) {
+	var n [2]byte
+	if _, err := io.ReadFull(c, n[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, int(n[0])<<8|int(n[1]))
+	if _, err := io.ReadFull(c, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// An Endpoint is the unresolved address of a host on a network.
+// It implements net.Addr, and its String method returns an address
+// that can be dialed.
+type Endpoint struct {
+	Net  string // name of the network
+	Host string // domain name or literal IP address
+	Port int
+}
+
+// Network returns the name of the network.
+func (e *Endpoint) Network() string { return e.Net }
+
+// String returns the endpoint in the form "host:port".
+func (e *Endpoint) String() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+// ParseEndpoints parses a comma-separated list of addresses on the
+// named network, such as "a:1,b:2,[::1]:3", into Endpoints. An address
+// without a port, such as "a", "::1" or "[::1]", has defaultPort.
+// The port of an address may be a service name. Spaces around the
+// addresses and empty addresses are ignored.
+func ParseEndpoints(network, list string, defaultPort int) ([]net.Addr, error) {
+	var addrs []net.Addr
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		e := &Endpoint{Net: network, Port: defaultPort}
+		switch {
+		case s[0] == '[' && s[len(s)-1] == ']':
+			e.Host = s[1 : len(s)-1]
+		case strings.IndexByte(s, ':') < 0 || strings.Count(s, ":") > 1 && s[0] != '[':
+			// A host without a port, or a bare IPv6 literal.
+			e.Host = s
+		default:
+			host, port, err := SplitHostPort(network, s)
+			if err != nil {
+				return nil, err
+			}
+			e.Host, e.Port = host, port
+		}
+		addrs = append(addrs, e)
+	}
+	if len(addrs) == 0 {
+		return nil, ErrMissingAddress
+	}
+	return addrs, nil
+}
+
+// DialAny connects to one of the addresses on the named network.
+// The addresses are dialed as specified by DialStrategy, in the
+// order given, and each is dialed as by Dial.
+func (d *Dialer) DialAny(network string, addresses []string) (net.Conn, error) {
+	return d.DialAnyContext(context.Background(), network, addresses)
+}
+
+// DialAnyContext connects to one of the addresses on the named
+// network using the provided context.
+//
+// See func DialAny for a description of the parameters.
+func (d *Dialer) DialAnyContext(ctx context.Context, network string, addresses []string) (net.Conn, error) {
+	if ctx == nil {
+		panic("nil context")
+	}
+	if len(addresses) == 0 {
+		return nil, newDialError(network, "", "resolve", nil, ErrMissingAddress)
+	}
+	ctx, _, cancel := d.withDeadline(ctx)
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		failures []*AttemptError
+	)
+	dial := func(ctx context.Context, i int) (net.Conn, error) {
+		c, err := d.DialContext(ctx, network, addresses[i])
+		if err != nil {
+			mu.Lock()
+			if derr, ok := err.(*DialError); ok {
+				failures = append(failures, derr.Attempts...)
+			} else {
+				failures = append(failures, &AttemptError{Phase: "connect", Err: err})
+			}
+			mu.Unlock()
+		}
+		return c, err
+	}
+	var (
+		c   net.Conn
+		err error
+	)
+	switch n := len(addresses); {
+	case n == 1:
+		c, err = dial(ctx, 0)
+	case d.DialStrategy == Sequential:
+		c, err = dialSequential(ctx, n, dial)
+	case d.DialStrategy == HappyEyeballs:
+		order := make([]int, n)
+		for i := range order {
+			order[i] = i
+		}
+		c, err = dialStaggered(ctx, order, d.fallbackDelay(), d.CancelGracePeriod, dial)
+	default:
+		c, err = dialMulti(ctx, n, d.CancelGracePeriod, dial)
+	}
+	if err != nil {
+		mu.Lock()
+		defer mu.Unlock()
+		return nil, &DialError{Net: network, Address: strings.Join(addresses, ","), Attempts: failures}
+	}
+	return c, nil
+}
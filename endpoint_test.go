@@ -0,0 +1,72 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParseEndpoints(t *testing.T) {
+	addrs, err := ParseEndpoints("tcp", " a:1, b ,[::1]:3,::2,[fe80::1%eth0], c:http,", 6379)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []net.Addr{
+		&Endpoint{"tcp", "a", 1},
+		&Endpoint{"tcp", "b", 6379},
+		&Endpoint{"tcp", "::1", 3},
+		&Endpoint{"tcp", "::2", 6379},
+		&Endpoint{"tcp", "fe80::1%eth0", 6379},
+		&Endpoint{"tcp", "c", 80},
+	}
+	if !reflect.DeepEqual(addrs, want) {
+		t.Fatalf("expected %v; got %v", want, addrs)
+	}
+	if s := addrs[2].String(); s != "[::1]:3" {
+		t.Fatalf("String: expected [::1]:3; got %s", s)
+	}
+	for _, list := range []string{"", " , ", "a:99999"} {
+		if _, err := ParseEndpoints("tcp", list, 1); err == nil {
+			t.Errorf("%q: expected error", list)
+		}
+	}
+}
+
+func TestDialAny(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+	// A closed listener's port refuses connections.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	closed.Close()
+
+	for _, strategy := range []DialStrategy{Race, Sequential, HappyEyeballs} {
+		d := &Dialer{DialStrategy: strategy}
+		c, err := d.DialAny("tcp", []string{closed.Addr().String(), ln.Addr().String()})
+		if err != nil {
+			t.Fatalf("strategy %d: unexpected error: %v", strategy, err)
+		}
+		if c.RemoteAddr().String() != ln.Addr().String() {
+			t.Fatalf("strategy %d: expected %v; got %v", strategy, ln.Addr(), c.RemoteAddr())
+		}
+		c.Close()
+
+		_, err = d.DialAny("tcp", []string{closed.Addr().String(), closed.Addr().String()})
+		derr, ok := err.(*DialError)
+		if !ok || len(derr.Attempts) != 2 {
+			t.Fatalf("strategy %d: expected *DialError with 2 attempts; got %v", strategy, err)
+		}
+	}
+	if _, err := (&Dialer{}).DialAny("tcp", nil); err == nil {
+		t.Fatal("expected error without addresses")
+	}
+}
@@ -7,10 +7,10 @@ package nett_test
 import (
 	"io"
 	"io/ioutil"
-	"net/http"
 	"time"
 
 	"github.com/abursavich/nett"
+	"github.com/abursavich/nett/httputil"
 )
 
 func Example() {
@@ -20,16 +20,12 @@ func Example() {
 		Resolver: &nett.CacheResolver{TTL: 5 * time.Minute},
 		// Concurrently dial an IPv4 and an IPv6 address and
 		// return the connection that is established first.
-		IPFilter: nett.DualStack,
+		Filter: nett.FilterFunc(nett.FirstEachFilter),
 		// Give up after ten seconds including DNS resolution.
 		Timeout: 10 * time.Second,
 	}
-	client := &http.Client{
-		Transport: &http.Transport{
-			// Use the Dialer.
-			Dial: dialer.Dial,
-		},
-	}
+	// Use the Dialer with sane timeouts and connection pools.
+	client := httputil.NewClient(dialer)
 	urls := []string{
 		"https://www.google.com/search?q=golang",      // lookup google.com
 		"https://www.google.com/search?q=godoc",       // cached google.com
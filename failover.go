@@ -0,0 +1,156 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A FailoverDialer connects to the first healthy one of an ordered
+// list of addresses, such as the primary and replicas of a database.
+// It remembers which addresses recently failed and skips them until
+// their RetryInterval has passed, when a dial tries them again, so
+// that it returns to a preferred address once it has recovered.
+//
+// Its methods are safe for concurrent use.
+type FailoverDialer struct {
+	// Dialer dials the addresses.
+	// If nil, a zero Dialer is used.
+	Dialer *Dialer
+
+	// Network is the name of the network of the addresses.
+	Network string
+
+	// Addresses are the addresses to dial, from most to least
+	// preferred. They must not be changed after the FailoverDialer
+	// is first used.
+	Addresses []string
+
+	// RetryInterval is the length of time for which an address
+	// that failed is skipped.
+	//
+	// If zero, a default interval of 30s is used.
+	RetryInterval time.Duration
+
+	// OnFailover, if non-nil, is called when a dial connects to an
+	// address other than the one that the previous dial connected to.
+	OnFailover func(from, to string)
+
+	mu      sync.Mutex
+	retryAt map[string]time.Time // of addresses that failed
+	current string               // the address last connected to
+}
+
+// Dial connects to the first healthy address.
+func (f *FailoverDialer) Dial() (net.Conn, error) {
+	return f.DialContext(context.Background())
+}
+
+// DialContext connects to the first healthy address using the
+// provided context. The addresses are dialed in order, skipping
+// those that recently failed. If all of them are skipped or fail,
+// the skipped ones are dialed in order as a last resort.
+func (f *FailoverDialer) DialContext(ctx context.Context) (net.Conn, error) {
+	if ctx == nil {
+		panic("nil context")
+	}
+	if len(f.Addresses) == 0 {
+		return nil, newDialError(f.Network, "", "resolve", nil, ErrMissingAddress)
+	}
+	d := f.Dialer
+	if d == nil {
+		d = &Dialer{}
+	}
+	var (
+		skipped  []string
+		failures []*AttemptError
+	)
+	dial := func(address string) (net.Conn, bool) {
+		c, err := d.DialContext(ctx, f.Network, address)
+		// Attempts aborted by the caller say nothing about the address.
+		if err == nil || ctx.Err() == nil {
+			f.report(address, err)
+		}
+		if err == nil {
+			return c, true
+		}
+		if derr, ok := err.(*DialError); ok {
+			failures = append(failures, derr.Attempts...)
+		} else {
+			failures = append(failures, &AttemptError{Phase: "connect", Err: err})
+		}
+		return nil, false
+	}
+	now := timeNow()
+	for _, address := range f.Addresses {
+		if !f.healthy(address, now) {
+			skipped = append(skipped, address)
+			continue
+		}
+		if c, ok := dial(address); ok {
+			return c, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	for _, address := range skipped {
+		if ctx.Err() != nil {
+			break
+		}
+		if c, ok := dial(address); ok {
+			return c, nil
+		}
+	}
+	return nil, &DialError{Net: f.Network, Address: strings.Join(f.Addresses, ","), Attempts: failures}
+}
+
+// Current returns the address that the last successful dial
+// connected to, or "" if there hasn't been one.
+func (f *FailoverDialer) Current() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.current
+}
+
+// healthy reports whether the address may be dialed at the given
+// time, because it hasn't failed recently.
+func (f *FailoverDialer) healthy(address string, now time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	retryAt, ok := f.retryAt[address]
+	return !ok || !now.Before(retryAt)
+}
+
+// report records the outcome of dialing the address.
+func (f *FailoverDialer) report(address string, err error) {
+	f.mu.Lock()
+	if err != nil {
+		if f.retryAt == nil {
+			f.retryAt = make(map[string]time.Time)
+		}
+		f.retryAt[address] = timeNow().Add(f.retryInterval())
+		f.mu.Unlock()
+		return
+	}
+	delete(f.retryAt, address)
+	from := f.current
+	f.current = address
+	f.mu.Unlock()
+	if from != "" && from != address && f.OnFailover != nil {
+		f.OnFailover(from, address)
+	}
+}
+
+func (f *FailoverDialer) retryInterval() time.Duration {
+	if f.RetryInterval > 0 {
+		return f.RetryInterval
+	}
+	return 30 * time.Second
+}
@@ -0,0 +1,80 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFailoverDialer(t *testing.T) {
+	defer func(timeFn func() time.Time) { timeNow = timeFn }(timeNow)
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+
+	primary, _ := testAccepter(t)
+	replica, _ := testAccepter(t)
+	defer replica.Close()
+	primaryAddr, replicaAddr := primary.Addr().String(), replica.Addr().String()
+	primary.Close()
+
+	var dialed []string
+	var failovers []string
+	f := &FailoverDialer{
+		Dialer: &Dialer{
+			OnDialStart: func(network, address string, attempt int) {
+				dialed = append(dialed, address)
+			},
+		},
+		Network:       "tcp",
+		Addresses:     []string{primaryAddr, replicaAddr},
+		RetryInterval: time.Minute,
+		OnFailover: func(from, to string) {
+			failovers = append(failovers, from+">"+to)
+		},
+	}
+	dial := func(want string, wantDialed int) {
+		dialed = nil
+		c, err := f.Dial()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		c.Close()
+		if cur := f.Current(); cur != want {
+			t.Fatalf("current: expected %v; got %v", want, cur)
+		}
+		if len(dialed) != wantDialed {
+			t.Fatalf("dialed: expected %d addresses; got %v", wantDialed, dialed)
+		}
+	}
+	dial(replicaAddr, 2) // the primary fails
+	dial(replicaAddr, 1) // the primary is skipped
+
+	// The primary is tried again after the retry interval.
+	ln, err := net.Listen("tcp", primaryAddr)
+	if err != nil {
+		t.Skipf("can't listen on %v again: %v", primaryAddr, err)
+	}
+	defer ln.Close()
+	now = now.Add(time.Minute)
+	dial(primaryAddr, 1)
+	if len(failovers) != 1 || failovers[0] != replicaAddr+">"+primaryAddr {
+		t.Fatalf("failovers: unexpected %v", failovers)
+	}
+
+	// Skipped addresses are dialed as a last resort.
+	ln.Close()
+	replica.Close()
+	if _, err := f.Dial(); err == nil {
+		t.Fatal("expected error with no healthy addresses")
+	}
+	ln, err = net.Listen("tcp", primaryAddr)
+	if err != nil {
+		t.Skipf("can't listen on %v again: %v", primaryAddr, err)
+	}
+	defer ln.Close()
+	dial(primaryAddr, 1)
+}
@@ -0,0 +1,500 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"container/list"
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/abursavich/nett/netaddr"
+)
+
+// A Filter selects the addresses to dial from those that a host
+// resolves to.
+type Filter interface {
+	// Filter returns the addresses selected from ips, which the
+	// host resolved to, for dialing the named network.
+	// It must not modify ips.
+	Filter(network, host string, ips []net.IP) []net.IP
+}
+
+// The FilterFunc type is an adapter to allow the use of ordinary
+// functions, such as the deprecated IPFilter of a Dialer, as Filters.
+// The network and host are ignored.
+type FilterFunc func(ips []net.IP) []net.IP
+
+// Filter returns f(ips).
+func (f FilterFunc) Filter(network, host string, ips []net.IP) []net.IP {
+	return f(ips)
+}
+
+// The HostFilterFunc type is an adapter to allow the use of ordinary
+// functions that make per-destination decisions as Filters.
+type HostFilterFunc func(network, host string, ips []net.IP) []net.IP
+
+// Filter returns f(network, host, ips).
+func (f HostFilterFunc) Filter(network, host string, ips []net.IP) []net.IP {
+	return f(network, host, ips)
+}
+
+// DefaultFilter selects the first IPv4 address in ips, or the
+// first address if there are none. It's the selection made by
+// a Dialer whose Filter and IPFilter are nil and Preference is
+// PreferIPv4.
+func DefaultFilter(ips []net.IP) []net.IP {
+	return firstOfFamily(ips, true)
+}
+
+// PreferIPv6Filter selects the first IPv6 address in ips, or
+// the first address if there are none. It suits IPv6-first
+// networks, where RFC 6724 orders IPv6 destinations first.
+// It's the selection made by a Dialer whose Filter and IPFilter
+// are nil and Preference is PreferIPv6.
+func PreferIPv6Filter(ips []net.IP) []net.IP {
+	return firstOfFamily(ips, false)
+}
+
+// firstOfFamily selects the first address in ips of the IPv4 family
+// if v4 is true or the IPv6 family otherwise, or the first address
+// if there are none.
+func firstOfFamily(ips []net.IP, v4 bool) []net.IP {
+	if len(ips) <= 1 {
+		return ips
+	}
+	for i, ip := range ips {
+		if (ip.To4() != nil) == v4 {
+			return ips[i : i+1 : i+1]
+		}
+	}
+	return ips[:1:1]
+}
+
+// FirstEachFilter selects the first IPv4 address and the first
+// IPv6 address in ips, in the order they're given. IPv4 addresses
+// are recognized in either their 4-byte or 16-byte form.
+func FirstEachFilter(ips []net.IP) []net.IP {
+	if len(ips) <= 1 {
+		return ips
+	}
+	var ipv4, ipv6 bool
+	return selectIPs(ips, func(ip net.IP) bool {
+		if is4 := ip.To4() != nil; is4 && !ipv4 {
+			ipv4 = true
+			return true
+		} else if !is4 && !ipv6 {
+			ipv6 = true
+			return true
+		}
+		return false
+	})
+}
+
+// DualStack selects the first IPv4 address
+// and IPv6 address in ips.
+//
+// Deprecated: Use FirstEachFilter.
+func DualStack(ips []net.IP) []net.IP {
+	return FirstEachFilter(ips)
+}
+
+// defaultIP selects the first address.
+func defaultIP(ips []net.IP) []net.IP {
+	if len(ips) <= 1 {
+		return ips
+	}
+	return ips[:1]
+}
+
+// PreferSubnetFilter returns a filter that orders the addresses
+// within any of nets first. The relative order of the addresses
+// within and outside of them is kept.
+func PreferSubnetFilter(nets ...*net.IPNet) func(ips []net.IP) []net.IP {
+	set := netaddr.NewIPSet(nets...)
+	return func(ips []net.IP) []net.IP {
+		// Only allocate if an address within nets follows one outside.
+		i := 0
+		for i < len(ips) && set.Contains(ips[i]) {
+			i++
+		}
+		j := i
+		for j < len(ips) && !set.Contains(ips[j]) {
+			j++
+		}
+		if j == len(ips) {
+			return ips
+		}
+		a := make([]net.IP, 0, len(ips))
+		a = append(a, ips[:i]...)
+		var rest []net.IP
+		for _, ip := range ips[i:] {
+			if set.Contains(ip) {
+				a = append(a, ip)
+			} else {
+				rest = append(rest, ip)
+			}
+		}
+		return append(a, rest...)
+	}
+}
+
+// ExcludeSubnetFilter returns a filter that removes the addresses
+// within any of nets. For example, excluding the private ranges of
+// RFC 1918 prevents dialing internal hosts given external names.
+func ExcludeSubnetFilter(nets ...*net.IPNet) func(ips []net.IP) []net.IP {
+	return DenySetFilter(netaddr.NewIPSet(nets...))
+}
+
+// AllowSetFilter returns a filter that selects only the addresses in
+// set, such as an allow list. Since set's membership is checked in
+// logarithmic time, large lists don't slow down dialing.
+func AllowSetFilter(set *netaddr.IPSet) func(ips []net.IP) []net.IP {
+	return func(ips []net.IP) []net.IP {
+		return selectIPs(ips, func(ip net.IP) bool { return set.Contains(ip) })
+	}
+}
+
+// DenySetFilter returns a filter that removes the addresses in set,
+// such as a block list. Since set's membership is checked in
+// logarithmic time, large lists don't slow down dialing.
+func DenySetFilter(set *netaddr.IPSet) func(ips []net.IP) []net.IP {
+	return func(ips []net.IP) []net.IP {
+		return selectIPs(ips, func(ip net.IP) bool { return !set.Contains(ip) })
+	}
+}
+
+// MaxFilter returns a filter that selects at most max addresses,
+// split between the address families as evenly as possible. The
+// family of the first address gets the extra address if max is odd.
+// If a family has too few addresses for its share, the other family's
+// addresses fill the remainder. The selected addresses keep the order
+// in which they were given. If max <= 0, all of the addresses are
+// selected.
+func MaxFilter(max int) func(ips []net.IP) []net.IP {
+	return func(ips []net.IP) []net.IP {
+		if max <= 0 || len(ips) <= max {
+			return ips
+		}
+		first := ips[0].To4() != nil
+		var nFirst int
+		for _, ip := range ips {
+			if (ip.To4() != nil) == first {
+				nFirst++
+			}
+		}
+		nOther := len(ips) - nFirst
+		qFirst := minInt(nFirst, (max+1)/2)
+		qOther := minInt(nOther, max-qFirst)
+		qFirst = minInt(nFirst, max-qOther)
+		return selectIPs(ips, func(ip net.IP) bool {
+			if (ip.To4() != nil) == first {
+				if qFirst > 0 {
+					qFirst--
+					return true
+				}
+			} else if qOther > 0 {
+				qOther--
+				return true
+			}
+			return false
+		})
+	}
+}
+
+// selectIPs returns the addresses in ips for which keep returns true,
+// in order. Unlike filterIPs, it doesn't modify ips: if the selected
+// addresses are a prefix of ips, they're sliced from it without
+// allocating, with its capacity limited so that appending to them
+// doesn't overwrite ips. Otherwise, they're copied to a new slice.
+// It calls keep once for each address, in order.
+func selectIPs(ips []net.IP, keep func(ip net.IP) bool) []net.IP {
+	n := 0
+	for n < len(ips) && keep(ips[n]) {
+		n++
+	}
+	if n == len(ips) {
+		return ips
+	}
+	var a []net.IP
+	for _, ip := range ips[n+1:] {
+		if keep(ip) {
+			if a == nil {
+				a = make([]net.IP, n, len(ips)-1)
+				copy(a, ips)
+			}
+			a = append(a, ip)
+		}
+	}
+	if a == nil && n > 0 {
+		return ips[:n:n]
+	}
+	return a
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// ShuffleFilter returns ips in a random order, such as to spread
+// connections across all of a host's addresses. It uses its own
+// source of randomness, so it doesn't perturb the global state of
+// math/rand. See ShuffleFilterSeeded for a deterministic order.
+func ShuffleFilter(ips []net.IP) []net.IP {
+	return shuffleRand.shuffle(ips)
+}
+
+var shuffleRand = &lockedRand{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// ShuffleFilterSeeded returns a filter that returns ips in a random
+// order given by r, such as for deterministic tests. The filter
+// serializes its use of r, but r must not be used elsewhere
+// concurrently.
+func ShuffleFilterSeeded(r *rand.Rand) func(ips []net.IP) []net.IP {
+	return (&lockedRand{r: r}).shuffle
+}
+
+// A lockedRand is a rand.Rand that's safe for concurrent use.
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+// shuffle returns a copy of ips in a random order.
+func (r *lockedRand) shuffle(ips []net.IP) []net.IP {
+	if len(ips) <= 1 {
+		return ips
+	}
+	a := append(make([]net.IP, 0, len(ips)), ips...)
+	r.mu.Lock()
+	r.r.Shuffle(len(a), func(i, j int) { a[i], a[j] = a[j], a[i] })
+	r.mu.Unlock()
+	return a
+}
+
+// AffinityFilter returns a filter that selects the same address
+// for the same key, such as a user ID, given the same addresses.
+// It uses rendezvous hashing, so when addresses are added or
+// removed, only keys whose selected address is affected by the
+// change select a different address.
+func AffinityFilter(key func() uint64) func(ips []net.IP) []net.IP {
+	return func(ips []net.IP) []net.IP {
+		if len(ips) <= 1 {
+			return ips
+		}
+		k := key()
+		best, max := 0, uint64(0)
+		for i, ip := range ips {
+			if w := affinityWeight(k, ip); i == 0 || w > max {
+				best, max = i, w
+			}
+		}
+		return ips[best : best+1]
+	}
+}
+
+// affinityWeight returns the FNV-1a hash of key and ip.
+func affinityWeight(key uint64, ip net.IP) uint64 {
+	h := fnv.New64a()
+	var b [8 + net.IPv6len]byte
+	binary.BigEndian.PutUint64(b[:8], key)
+	copy(b[8:], ip.To16())
+	h.Write(b[:])
+	return h.Sum64()
+}
+
+// nonPublicNets are the ranges of addresses that aren't publicly
+// routable. IPv4-mapped IPv6 addresses are matched as IPv4.
+var nonPublicNets = netaddr.NewIPSet(parseCIDRs(
+	"0.0.0.0/8",       // this network, RFC 1122
+	"10.0.0.0/8",      // private, RFC 1918
+	"100.64.0.0/10",   // shared address space (CGNAT), RFC 6598
+	"127.0.0.0/8",     // loopback, RFC 1122
+	"169.254.0.0/16",  // link-local, RFC 3927
+	"172.16.0.0/12",   // private, RFC 1918
+	"192.0.0.0/24",    // IETF protocol assignments, RFC 6890
+	"192.0.2.0/24",    // documentation (TEST-NET-1), RFC 5737
+	"192.168.0.0/16",  // private, RFC 1918
+	"198.18.0.0/15",   // benchmarking, RFC 2544
+	"198.51.100.0/24", // documentation (TEST-NET-2), RFC 5737
+	"203.0.113.0/24",  // documentation (TEST-NET-3), RFC 5737
+	"224.0.0.0/4",     // multicast, RFC 5771
+	"240.0.0.0/4",     // reserved and broadcast, RFC 1112
+	"::/128",          // unspecified, RFC 4291
+	"::1/128",         // loopback, RFC 4291
+	"64:ff9b::/96",    // NAT64, which may embed a private IPv4 address, RFC 6052
+	"64:ff9b:1::/48",  // local-use NAT64, RFC 8215
+	"100::/64",        // discard-only, RFC 6666
+	"2001:db8::/32",   // documentation, RFC 3849
+	"2002::/16",       // 6to4, which may embed a private IPv4 address, RFC 3056
+	"fc00::/7",        // unique local, RFC 4193
+	"fe80::/10",       // link-local, RFC 4291
+	"ff00::/8",        // multicast, RFC 4291
+)...)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
+
+// PublicOnlyFilter removes the addresses that aren't publicly routable:
+// unspecified, loopback, private (RFC 1918), shared (CGNAT), link-local,
+// unique local, multicast, documentation, and other reserved addresses,
+// and the NAT64 and 6to4 addresses that could embed any of them. It protects
+// services that dial user-provided addresses, such as webhooks, from
+// being directed at internal hosts (SSRF). See Dialer.PublicOnly.
+func PublicOnlyFilter(ips []net.IP) []net.IP {
+	return selectIPs(ips, isPublicIP)
+}
+
+func isPublicIP(ip net.IP) bool {
+	return len(ip) > 0 && !nonPublicNets.Contains(ip)
+}
+
+// A LatencyFilter orders addresses by their observed connect latency,
+// fastest first. Its Filter method is used as a Dialer's IPFilter and
+// its OnDialDone method as the Dialer's OnDialDone to record latencies.
+//
+// Addresses without a recent observation come first, in the order
+// given, so that new addresses are tried and the latencies of the
+// others are periodically measured again.
+//
+// Its methods are safe for concurrent use.
+type LatencyFilter struct {
+	// Max is the maximum number of addresses selected.
+	// If zero, all of the addresses are selected.
+	Max int
+
+	// Reexplore is the age after which an address's latency is
+	// no longer considered observed.
+	//
+	// If zero, a default of one minute is used.
+	Reexplore time.Duration
+
+	mu    sync.Mutex
+	stats map[string]*latencyStat
+	order *list.List // of addresses, least recently observed first
+}
+
+type latencyStat struct {
+	avg  time.Duration // exponentially weighted moving average
+	last time.Time
+	elem *list.Element // position of the address in order
+}
+
+const (
+	// latencyFailure is added to the latency of a failed attempt.
+	latencyFailure = time.Second
+
+	// maxLatencyStats is the maximum number of addresses whose
+	// observations are kept. The least recently observed are
+	// discarded first.
+	maxLatencyStats = 1024
+)
+
+// Filter returns ips ordered by latency.
+func (f *LatencyFilter) Filter(ips []net.IP) []net.IP {
+	type entry struct {
+		ip  net.IP
+		avg time.Duration
+		new bool
+	}
+	entries := make([]entry, len(ips))
+	cutoff := timeNow().Add(-f.reexplore())
+	f.mu.Lock()
+	for i, ip := range ips {
+		entries[i] = entry{ip: ip, new: true}
+		if s := f.stats[ip.String()]; s != nil && s.last.After(cutoff) {
+			entries[i] = entry{ip: ip, avg: s.avg}
+		}
+	}
+	f.mu.Unlock()
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.new != b.new {
+			return a.new
+		}
+		return a.avg < b.avg
+	})
+	n := len(entries)
+	if f.Max > 0 && f.Max < n {
+		n = f.Max
+	}
+	a := make([]net.IP, n)
+	for i := range a {
+		a[i] = entries[i].ip
+	}
+	return a
+}
+
+// Observe records that an attempt to connect to ip took elapsed
+// and failed with err, if it's non-nil. Failures are recorded as
+// taking an additional second.
+func (f *LatencyFilter) Observe(ip net.IP, elapsed time.Duration, err error) {
+	if err != nil {
+		elapsed += latencyFailure
+	}
+	now := timeNow()
+	key := ip.String()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.stats[key]
+	if s == nil {
+		if f.stats == nil {
+			f.stats = make(map[string]*latencyStat)
+			f.order = list.New()
+		}
+		if len(f.stats) >= maxLatencyStats {
+			oldest := f.order.Front()
+			f.order.Remove(oldest)
+			delete(f.stats, oldest.Value.(string))
+		}
+		f.stats[key] = &latencyStat{avg: elapsed, last: now, elem: f.order.PushBack(key)}
+		return
+	}
+	if now.Sub(s.last) > f.reexplore() {
+		s.avg = elapsed
+	} else {
+		s.avg += (elapsed - s.avg) / 4
+	}
+	s.last = now
+	f.order.MoveToBack(s.elem)
+}
+
+// OnDialDone records the latency of a connection attempt.
+// It has the signature of a Dialer's OnDialDone.
+func (f *LatencyFilter) OnDialDone(network, address string, attempt int, elapsed time.Duration, err error) {
+	host, _, splitErr := net.SplitHostPort(address)
+	if splitErr != nil {
+		host = address
+	}
+	if i := last(host, '%'); i >= 0 {
+		host = host[:i]
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		f.Observe(ip, elapsed, err)
+	}
+}
+
+func (f *LatencyFilter) reexplore() time.Duration {
+	if f.Reexplore > 0 {
+		return f.Reexplore
+	}
+	return time.Minute
+}
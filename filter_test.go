@@ -0,0 +1,421 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/abursavich/nett/netaddr"
+)
+
+var (
+	testIPv4a = net.ParseIP("192.0.2.1").To4()
+	testIPv4b = net.ParseIP("192.0.2.2").To4()
+	testIPv6a = net.ParseIP("2001:db8::1")
+	testIPv6b = net.ParseIP("2001:db8::2")
+)
+
+func TestPreferFilters(t *testing.T) {
+	tests := []struct {
+		ips, ipv4, ipv6 []net.IP
+	}{
+		{nil, nil, nil},
+		{[]net.IP{testIPv4a, testIPv4b}, []net.IP{testIPv4a}, []net.IP{testIPv4a}},
+		{[]net.IP{testIPv6a, testIPv6b}, []net.IP{testIPv6a}, []net.IP{testIPv6a}},
+		{[]net.IP{testIPv6a, testIPv4a, testIPv6b}, []net.IP{testIPv4a}, []net.IP{testIPv6a}},
+		{[]net.IP{testIPv4b, testIPv4a, testIPv6b}, []net.IP{testIPv4b}, []net.IP{testIPv6b}},
+	}
+	for _, tt := range tests {
+		if got := DefaultFilter(tt.ips); !reflect.DeepEqual(got, tt.ipv4) {
+			t.Errorf("DefaultFilter(%v): expected %v; got %v", tt.ips, tt.ipv4, got)
+		}
+		if got := PreferIPv6Filter(tt.ips); !reflect.DeepEqual(got, tt.ipv6) {
+			t.Errorf("PreferIPv6Filter(%v): expected %v; got %v", tt.ips, tt.ipv6, got)
+		}
+	}
+}
+
+func TestLatencyFilter(t *testing.T) {
+	defer func(timeFn func() time.Time) { timeNow = timeFn }(timeNow)
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+
+	f := &LatencyFilter{Reexplore: time.Minute}
+	ips := []net.IP{testIPv4a, testIPv4b, testIPv6a, testIPv6b}
+	f.OnDialDone("tcp", "192.0.2.1:80", 0, 30*time.Millisecond, nil)
+	f.OnDialDone("tcp", "192.0.2.2:80", 1, 10*time.Millisecond, nil)
+	f.OnDialDone("tcp", "[2001:db8::1]:80", 2, 5*time.Millisecond, errors.New("refused"))
+
+	// The unobserved address comes first, then the fastest.
+	want := []net.IP{testIPv6b, testIPv4b, testIPv4a, testIPv6a}
+	if got := f.Filter(ips); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v; got %v", want, got)
+	}
+	f.Max = 2
+	if got := f.Filter(ips); !reflect.DeepEqual(got, want[:2]) {
+		t.Fatalf("max: expected %v; got %v", want[:2], got)
+	}
+	f.Max = 0
+
+	// The average moves toward new observations.
+	for i := 0; i < 10; i++ {
+		f.Observe(testIPv4b, 50*time.Millisecond, nil)
+	}
+	want = []net.IP{testIPv6b, testIPv4a, testIPv4b, testIPv6a}
+	if got := f.Filter(ips); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v; got %v", want, got)
+	}
+
+	// Stale observations are explored again.
+	now = now.Add(2 * time.Minute)
+	f.Observe(testIPv6a, time.Millisecond, nil)
+	want = []net.IP{testIPv4a, testIPv4b, testIPv6b, testIPv6a}
+	if got := f.Filter(ips); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v; got %v", want, got)
+	}
+
+	// The least recently observed addresses are discarded.
+	f.Observe(testIPv4a, time.Millisecond, nil)
+	for i := 0; len(f.stats) < maxLatencyStats; i++ {
+		f.Observe(net.IPv4(10, 0, byte(i>>8), byte(i)), time.Millisecond, nil)
+	}
+	f.Observe(net.IPv4(10, 1, 0, 0), time.Millisecond, nil)
+	if n := len(f.stats); n != maxLatencyStats {
+		t.Fatalf("stats: expected %d; got %d", maxLatencyStats, n)
+	}
+	if f.stats[testIPv4b.String()] != nil || f.stats[testIPv4a.String()] == nil {
+		t.Fatal("expected the least recently observed address to be discarded")
+	}
+}
+
+func TestSubnetFilters(t *testing.T) {
+	_, lo, _ := net.ParseCIDR("192.0.2.2/32")
+	_, doc6, _ := net.ParseCIDR("2001:db8::/32")
+	ips := []net.IP{testIPv4a, testIPv6a, testIPv4b, testIPv6b}
+
+	want := []net.IP{testIPv6a, testIPv4b, testIPv6b, testIPv4a}
+	if got := PreferSubnetFilter(lo, doc6)(ips); !reflect.DeepEqual(got, want) {
+		t.Errorf("prefer: expected %v; got %v", want, got)
+	}
+	want = []net.IP{testIPv4a}
+	if got := ExcludeSubnetFilter(lo, doc6)(ips); !reflect.DeepEqual(got, want) {
+		t.Errorf("exclude: expected %v; got %v", want, got)
+	}
+	if got := ExcludeSubnetFilter()(ips); !reflect.DeepEqual(got, ips) {
+		t.Errorf("exclude nothing: expected %v; got %v", ips, got)
+	}
+
+	var b netaddr.IPSetBuilder
+	b.AddIP(testIPv4b)
+	b.AddRange(netaddr.IPRange{First: testIPv6a, Last: testIPv6a})
+	set := b.IPSet()
+	want = []net.IP{testIPv6a, testIPv4b}
+	if got := AllowSetFilter(set)(ips); !reflect.DeepEqual(got, want) {
+		t.Errorf("allow set: expected %v; got %v", want, got)
+	}
+	want = []net.IP{testIPv4a, testIPv6b}
+	if got := DenySetFilter(set)(ips); !reflect.DeepEqual(got, want) {
+		t.Errorf("deny set: expected %v; got %v", want, got)
+	}
+}
+
+func TestPublicOnlyFilter(t *testing.T) {
+	public := []string{"8.8.8.8", "1.1.1.1", "2606:4700::1111", "::ffff:8.8.8.8"}
+	private := []string{
+		"0.0.0.0", "10.1.2.3", "100.64.0.1", "127.0.0.1", "169.254.169.254",
+		"172.16.0.1", "192.168.1.1", "224.0.0.1", "255.255.255.255",
+		"::", "::1", "fd00::1", "fe80::1", "ff02::1", "::ffff:127.0.0.1",
+		"192.0.2.1", "198.51.100.1", "203.0.113.1", "2001:db8::1",
+		"64:ff9b::a00:1", "64:ff9b::7f00:1", "64:ff9b:1::1", "2002:a00:1::1", "2002:7f00:1::1",
+	}
+	for _, s := range public {
+		if ips := PublicOnlyFilter([]net.IP{net.ParseIP(s)}); len(ips) != 1 {
+			t.Errorf("%s: expected public", s)
+		}
+	}
+	for _, s := range private {
+		if ips := PublicOnlyFilter([]net.IP{net.ParseIP(s)}); len(ips) != 0 {
+			t.Errorf("%s: expected non-public", s)
+		}
+	}
+}
+
+func TestDialPublicOnly(t *testing.T) {
+	d := &Dialer{
+		PublicOnly: true,
+		Resolver:   StaticResolver{"internal.test": {net.IPv4(10, 0, 0, 1), net.IPv4(127, 0, 0, 1)}},
+	}
+	for _, addr := range []string{"internal.test:80", "127.0.0.1:80", "[::1]:80", ":80"} {
+		_, err := d.Dial("tcp", addr)
+		if derr, ok := err.(*DialError); !ok || derr.Unwrap() != ErrNonPublicAddress {
+			t.Errorf("%s: expected ErrNonPublicAddress; got %v", addr, err)
+		}
+	}
+}
+
+func TestAffinityFilter(t *testing.T) {
+	ips := []net.IP{testIPv4a, testIPv4b, testIPv6a, testIPv6b}
+	selected := make(map[uint64]string)
+	counts := make(map[string]int)
+	for key := uint64(0); key < 1000; key++ {
+		k := key
+		got := AffinityFilter(func() uint64 { return k })(ips)
+		if len(got) != 1 {
+			t.Fatalf("key %d: expected 1 address; got %v", key, got)
+		}
+		selected[key] = got[0].String()
+		counts[got[0].String()]++
+	}
+	for _, ip := range ips {
+		if n := counts[ip.String()]; n < 150 {
+			t.Errorf("%v: selected for only %d of 1000 keys", ip, n)
+		}
+	}
+
+	// Removing an address only moves the keys that selected it,
+	// and the order of the addresses doesn't matter.
+	rest := []net.IP{testIPv6b, testIPv6a, testIPv4a}
+	for key := uint64(0); key < 1000; key++ {
+		k := key
+		got := AffinityFilter(func() uint64 { return k })(rest)[0].String()
+		if prev := selected[key]; prev != testIPv4b.String() && got != prev {
+			t.Fatalf("key %d: moved from %s to %s", key, prev, got)
+		}
+	}
+}
+
+func TestDialHostFilter(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	// Only hosts in .internal may dial loopback addresses.
+	filter := HostFilterFunc(func(network, host string, ips []net.IP) []net.IP {
+		if strings.HasSuffix(host, ".internal") {
+			return ips
+		}
+		return ExcludeSubnetFilter(&net.IPNet{IP: net.IPv4(127, 0, 0, 0), Mask: net.CIDRMask(8, 32)})(ips)
+	})
+	d, err := NewDialer(
+		WithResolver(StaticResolver{
+			"db.internal": {net.IPv4(127, 0, 0, 1)},
+			"evil.test":   {net.IPv4(127, 0, 0, 1)},
+		}),
+		WithHostFilter(filter),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c, err := d.Dial("tcp", net.JoinHostPort("db.internal", port))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Close()
+	if _, err := d.Dial("tcp", net.JoinHostPort("evil.test", port)); err == nil {
+		t.Fatal("expected error for filtered host")
+	}
+
+	if got := FilterFunc(DefaultFilter).Filter("tcp", "test", []net.IP{testIPv6a, testIPv4a}); !reflect.DeepEqual(got, []net.IP{testIPv4a}) {
+		t.Fatalf("FilterFunc: expected %v; got %v", testIPv4a, got)
+	}
+	if _, err := NewDialer(WithFilter(FirstEachFilter), WithHostFilter(filter)); err == nil {
+		t.Fatal("expected error for conflicting filters")
+	}
+}
+
+func TestMaxFilter(t *testing.T) {
+	v4 := []net.IP{testIPv4a, testIPv4b, net.IPv4(192, 0, 2, 3).To4()}
+	v6 := []net.IP{testIPv6a, testIPv6b}
+	tests := []struct {
+		max       int
+		ips, want []net.IP
+	}{
+		{0, v4, v4},
+		{-1, v4, v4},
+		{5, v4, v4},
+		{2, v4, v4[:2]},
+		{2, []net.IP{v6[0], v4[0], v4[1], v6[1]}, []net.IP{v6[0], v4[0]}},
+		{3, []net.IP{v6[0], v4[0], v4[1], v6[1]}, []net.IP{v6[0], v4[0], v6[1]}},
+		{3, []net.IP{v4[0], v4[1], v4[2], v6[0]}, []net.IP{v4[0], v4[1], v6[0]}},
+		// IPv6 is short of its share, so IPv4 fills the remainder.
+		{4, []net.IP{v4[0], v4[1], v4[2], v6[0], v6[1]}[:4], []net.IP{v4[0], v4[1], v4[2], v6[0]}},
+	}
+	for _, tt := range tests {
+		if got := MaxFilter(tt.max)(tt.ips); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("MaxFilter(%d)(%v): expected %v; got %v", tt.max, tt.ips, tt.want, got)
+		}
+	}
+}
+
+func TestMaxFilterProperties(t *testing.T) {
+	// families encodes a list of addresses as bits: 1 for IPv6.
+	f := func(families uint16, n, max uint8) bool {
+		ips := make([]net.IP, int(n%16))
+		var n4, n6 int
+		for i := range ips {
+			if families&(1<<uint(i)) != 0 {
+				ips[i] = net.ParseIP(fmt.Sprintf("2001:db8::%x", i+1))
+				n6++
+			} else {
+				ips[i] = net.IPv4(192, 0, 2, byte(i+1)).To4()
+				n4++
+			}
+		}
+		m := int(max % 8)
+		got := MaxFilter(m)(ips)
+
+		// The size is limited by max.
+		want := len(ips)
+		if m > 0 && m < want {
+			want = m
+		}
+		if len(got) != want {
+			return false
+		}
+		// The addresses keep their order.
+		j := 0
+		for _, ip := range got {
+			for j < len(ips) && !ips[j].Equal(ip) {
+				j++
+			}
+			if j == len(ips) {
+				return false
+			}
+			j++
+		}
+		// The families are balanced unless one is exhausted.
+		var c4, c6 int
+		for _, ip := range got {
+			if ip.To4() != nil {
+				c4++
+			} else {
+				c6++
+			}
+		}
+		if c4-c6 > 1 && c6 < n6 || c6-c4 > 1 && c4 < n4 {
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFirstEachFilter(t *testing.T) {
+	v4in6 := net.IPv4(192, 0, 2, 1) // 16-byte form
+	tests := []struct {
+		ips, want []net.IP
+	}{
+		{nil, nil},
+		{[]net.IP{testIPv6a}, []net.IP{testIPv6a}},
+		{[]net.IP{testIPv4a, testIPv4b}, []net.IP{testIPv4a}},
+		{[]net.IP{testIPv6a, testIPv4a, testIPv6b, testIPv4b}, []net.IP{testIPv6a, testIPv4a}},
+		{[]net.IP{v4in6, testIPv4a, testIPv6a}, []net.IP{v4in6, testIPv6a}},
+	}
+	for _, tt := range tests {
+		if got := FirstEachFilter(tt.ips); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("FirstEachFilter(%v): expected %v; got %v", tt.ips, tt.want, got)
+		}
+		// The deprecated DualStack makes the same selection.
+		if got := DualStack(tt.ips); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("DualStack(%v): expected %v; got %v", tt.ips, tt.want, got)
+		}
+	}
+}
+
+func TestShuffleFilter(t *testing.T) {
+	ips := []net.IP{testIPv4a, testIPv6a, testIPv4b, testIPv6b}
+	orig := append([]net.IP(nil), ips...)
+	f1 := ShuffleFilterSeeded(rand.New(rand.NewSource(1)))
+	f2 := ShuffleFilterSeeded(rand.New(rand.NewSource(1)))
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		a, b := f1(ips), f2(ips)
+		if !reflect.DeepEqual(a, b) {
+			t.Fatalf("expected the same order given the same seed; got %v and %v", a, b)
+		}
+		seen[fmt.Sprint(a)] = true
+	}
+	if len(seen) < 2 {
+		t.Fatal("expected different orders")
+	}
+	if !reflect.DeepEqual(ips, orig) {
+		t.Fatalf("input modified: expected %v; got %v", orig, ips)
+	}
+	got := ShuffleFilter(ips)
+	if len(got) != len(ips) {
+		t.Fatalf("expected %d addresses; got %v", len(ips), got)
+	}
+	for _, ip := range ips {
+		var found bool
+		for _, g := range got {
+			found = found || g.Equal(ip)
+		}
+		if !found {
+			t.Fatalf("expected %v in %v", ip, got)
+		}
+	}
+}
+
+func TestSelectIPs(t *testing.T) {
+	ips := []net.IP{testIPv4a, testIPv6a, testIPv4b, testIPv6b}
+	is4 := func(ip net.IP) bool { return ip.To4() != nil }
+	prefix := []net.IP{testIPv4a, testIPv4b, testIPv6a}
+	got := selectIPs(prefix, is4)
+	if !reflect.DeepEqual(got, prefix[:2]) {
+		t.Fatalf("expected %v; got %v", prefix[:2], got)
+	}
+	// Appending to a selected prefix doesn't overwrite ips.
+	got = append(got, testIPv6b)
+	if !prefix[2].Equal(testIPv6a) {
+		t.Fatal("appending to the selected prefix overwrote ips")
+	}
+	want := []net.IP{testIPv4a, testIPv4b}
+	if got := selectIPs(ips, is4); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v; got %v", want, got)
+	}
+	if got := selectIPs(ips, func(net.IP) bool { return false }); got != nil {
+		t.Fatalf("expected nil; got %v", got)
+	}
+}
+
+func BenchmarkFilters(b *testing.B) {
+	ips := []net.IP{
+		testIPv4a, testIPv4b, testIPv6a, testIPv6b,
+		net.ParseIP("192.0.2.3").To4(), net.ParseIP("2001:db8::3"),
+	}
+	filters := []struct {
+		name   string
+		filter func([]net.IP) []net.IP
+	}{
+		{"Default", DefaultFilter},
+		{"PreferIPv6", PreferIPv6Filter},
+		{"FirstEach", FirstEachFilter},
+		{"Max", MaxFilter(2)},
+		{"PublicOnly", PublicOnlyFilter},
+		{"ExcludeSubnet", ExcludeSubnetFilter(nonPublicNets.Prefixes()...)},
+		{"PreferSubnet", PreferSubnetFilter(nonPublicNets.Prefixes()...)},
+	}
+	for _, f := range filters {
+		b.Run(f.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				f.filter(ips)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"net"
+	"sort"
+)
+
+// A RegionProvider locates addresses, such as by their country or
+// autonomous system number (ASN). It's typically implemented by
+// wrapping a geolocation database, such as MaxMind's, so that filters
+// can prefer or exclude addresses by geography without this package
+// depending on one.
+type RegionProvider interface {
+	// Region returns the region of ip, or "" if it's unknown.
+	// It must be safe for concurrent use.
+	Region(ip net.IP) string
+}
+
+// The RegionFunc type is an adapter to allow the use of ordinary
+// functions as RegionProviders.
+type RegionFunc func(ip net.IP) string
+
+// Region returns f(ip).
+func (f RegionFunc) Region(ip net.IP) string {
+	return f(ip)
+}
+
+// GeoFilter returns a filter that selects the addresses whose regions,
+// as returned by lookup, are among allowed. For example, it can keep
+// connections to a service within the jurisdictions it's allowed to
+// send data to.
+func GeoFilter(lookup func(net.IP) (region string), allowed ...string) func(ips []net.IP) []net.IP {
+	return AllowRegionFilter(RegionFunc(lookup), allowed...)
+}
+
+// AllowRegionFilter returns a filter that selects the addresses whose
+// regions, as returned by p, are among allowed.
+func AllowRegionFilter(p RegionProvider, allowed ...string) func(ips []net.IP) []net.IP {
+	set := regionSet(allowed)
+	return func(ips []net.IP) []net.IP {
+		return selectIPs(ips, func(ip net.IP) bool {
+			_, ok := set[p.Region(ip)]
+			return ok
+		})
+	}
+}
+
+// ExcludeRegionFilter returns a filter that removes the addresses
+// whose regions, as returned by p, are among excluded.
+func ExcludeRegionFilter(p RegionProvider, excluded ...string) func(ips []net.IP) []net.IP {
+	set := regionSet(excluded)
+	return func(ips []net.IP) []net.IP {
+		return selectIPs(ips, func(ip net.IP) bool {
+			_, ok := set[p.Region(ip)]
+			return !ok
+		})
+	}
+}
+
+// PreferRegionFilter returns a filter that orders the addresses by
+// the position of their regions, as returned by p, in preferred. The
+// addresses in other regions come last. The relative order of the
+// addresses within the same region is kept.
+func PreferRegionFilter(p RegionProvider, preferred ...string) func(ips []net.IP) []net.IP {
+	rank := make(map[string]int, len(preferred))
+	for i := len(preferred) - 1; i >= 0; i-- {
+		rank[preferred[i]] = i
+	}
+	return func(ips []net.IP) []net.IP {
+		type entry struct {
+			ip   net.IP
+			rank int
+		}
+		entries := make([]entry, len(ips))
+		for i, ip := range ips {
+			entries[i] = entry{ip: ip, rank: len(preferred)}
+			if r, ok := rank[p.Region(ip)]; ok {
+				entries[i].rank = r
+			}
+		}
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].rank < entries[j].rank
+		})
+		a := make([]net.IP, len(entries))
+		for i := range a {
+			a[i] = entries[i].ip
+		}
+		return a
+	}
+}
+
+func regionSet(regions []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(regions))
+	for _, r := range regions {
+		set[r] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,37 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestRegionFilters(t *testing.T) {
+	regions := map[string]string{
+		testIPv4a.String(): "US",
+		testIPv4b.String(): "DE",
+		testIPv6a.String(): "FR",
+	}
+	lookup := func(ip net.IP) string { return regions[ip.String()] }
+	ips := []net.IP{testIPv4a, testIPv6a, testIPv4b, testIPv6b}
+
+	want := []net.IP{testIPv6a, testIPv4b}
+	if got := GeoFilter(lookup, "DE", "FR")(ips); !reflect.DeepEqual(got, want) {
+		t.Errorf("allow: expected %v; got %v", want, got)
+	}
+	want = []net.IP{testIPv4a, testIPv6b}
+	if got := ExcludeRegionFilter(RegionFunc(lookup), "DE", "FR")(ips); !reflect.DeepEqual(got, want) {
+		t.Errorf("exclude: expected %v; got %v", want, got)
+	}
+	want = []net.IP{testIPv4b, testIPv6a, testIPv4a, testIPv6b}
+	if got := PreferRegionFilter(RegionFunc(lookup), "DE", "FR", "DE")(ips); !reflect.DeepEqual(got, want) {
+		t.Errorf("prefer: expected %v; got %v", want, got)
+	}
+	if got := GeoFilter(lookup)(ips); len(got) != 0 {
+		t.Errorf("allow nothing: expected none; got %v", got)
+	}
+}
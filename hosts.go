@@ -0,0 +1,200 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// errNoSuchHost returns the error reported for an unknown host.
+func errNoSuchHost(host string) error {
+	return &net.DNSError{Err: "no such host", Name: host}
+}
+
+// lowerASCII returns s with its ASCII letters in lower case.
+func lowerASCII(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; 'A' <= c && c <= 'Z' {
+			b := []byte(s)
+			for j := i; j < len(b); j++ {
+				if c := b[j]; 'A' <= c && c <= 'Z' {
+					b[j] += 'a' - 'A'
+				}
+			}
+			return string(b)
+		}
+	}
+	return s
+}
+
+// A StaticResolver resolves hosts from a map of lower case
+// host names to their IP addresses. Unknown hosts fail to
+// resolve. It must not be modified while it's in use.
+type StaticResolver map[string][]net.IP
+
+// Resolve returns the given host's IP addresses.
+func (r StaticResolver) Resolve(host string) ([]net.IP, error) {
+	ips, ok := r[lowerASCII(host)]
+	if !ok {
+		return nil, errNoSuchHost(host)
+	}
+	clone := make([]net.IP, len(ips))
+	copy(clone, ips)
+	return clone, nil
+}
+
+// ResolveAddrs returns the given host's IP addresses. Their
+// source is SourceStatic and their TTL is unknown.
+func (r StaticResolver) ResolveAddrs(ctx context.Context, network, host string) (Addrs, error) {
+	ips, err := r.Resolve(host)
+	if err != nil {
+		return Addrs{}, err
+	}
+	return Addrs{IPs: ips, Source: SourceStatic}, nil
+}
+
+// A HostsResolver resolves hosts from a file in the format of
+// /etc/hosts. Unknown hosts fail to resolve.
+type HostsResolver struct {
+	// Path is the path of the hosts file.
+	// If empty, "/etc/hosts" is used.
+	Path string
+
+	// ReloadInterval is the minimum amount of time between
+	// checks for modifications of the file, which is read
+	// again if it has been modified.
+	//
+	// If zero, the file is only read once.
+	ReloadInterval time.Duration
+
+	mu      sync.Mutex
+	hosts   map[string][]net.IP
+	modTime time.Time
+	checked time.Time
+}
+
+// Resolve looks up the given host in the hosts file
+// and returns its IP addresses.
+func (r *HostsResolver) Resolve(host string) ([]net.IP, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return StaticResolver(r.hosts).Resolve(host)
+}
+
+// ResolveAddrs looks up the given host in the hosts file and
+// returns its IP addresses. Their source is SourceHosts and
+// their TTL is unknown.
+func (r *HostsResolver) ResolveAddrs(ctx context.Context, network, host string) (Addrs, error) {
+	ips, err := r.Resolve(host)
+	if err != nil {
+		return Addrs{}, err
+	}
+	return Addrs{IPs: ips, Source: SourceHosts}, nil
+}
+
+// load reads the hosts file if it hasn't been read or it has been
+// modified since the last check. It must be called with r.mu held.
+func (r *HostsResolver) load() error {
+	now := timeNow()
+	if r.hosts != nil && (r.ReloadInterval == 0 || now.Sub(r.checked) < r.ReloadInterval) {
+		return nil
+	}
+	r.checked = now
+	path := r.Path
+	if path == "" {
+		path = "/etc/hosts"
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		if r.hosts != nil {
+			return nil // keep the last good hosts
+		}
+		return err
+	}
+	if r.hosts != nil && fi.ModTime().Equal(r.modTime) {
+		return nil
+	}
+	hosts, err := readHosts(path)
+	if err != nil {
+		if r.hosts != nil {
+			return nil
+		}
+		return err
+	}
+	r.hosts, r.modTime = hosts, fi.ModTime()
+	return nil
+}
+
+// readHosts reads a hosts file and returns a map of lower case
+// host names to their IP addresses.
+func readHosts(path string) (map[string][]net.IP, error) {
+	f, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.close()
+	hosts := make(map[string][]net.IP)
+	for line, ok := f.readLine(); ok; line, ok = f.readLine() {
+		if i := byteIndex(line, '#'); i >= 0 {
+			line = line[:i] // discard comments
+		}
+		fields := getFields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		ip := parseIPv4(fields[0])
+		if ip == nil {
+			if ip, _ = parseIPv6(fields[0], true); ip == nil {
+				continue
+			}
+		}
+		for _, name := range fields[1:] {
+			name = lowerASCII(name)
+			hosts[name] = append(hosts[name], ip)
+		}
+	}
+	return hosts, nil
+}
+
+// A ChainResolver resolves hosts with each of its Resolvers in
+// order until one succeeds. If all of them fail, the last error
+// is returned.
+type ChainResolver []Resolver
+
+// Resolve looks up the given host and returns its IP addresses.
+func (r ChainResolver) Resolve(host string) ([]net.IP, error) {
+	return r.ResolveContext(context.Background(), "ip", host)
+}
+
+// ResolveContext looks up the given host using the provided
+// context and returns its IP addresses.
+func (r ChainResolver) ResolveContext(ctx context.Context, network, host string) ([]net.IP, error) {
+	addrs, err := r.ResolveAddrs(ctx, network, host)
+	return addrs.IPs, err
+}
+
+// ResolveAddrs looks up the given host using the provided context
+// and returns its IP addresses with the metadata reported by the
+// Resolver that resolved it.
+func (r ChainResolver) ResolveAddrs(ctx context.Context, network, host string) (Addrs, error) {
+	err := errNoSuchHost(host)
+	for _, resolver := range r {
+		var addrs Addrs
+		if addrs, err = resolveAddrs(ctx, resolver, network, host, nil); err == nil {
+			return addrs, nil
+		}
+		if ctx.Err() != nil {
+			return Addrs{}, err
+		}
+	}
+	return Addrs{}, err
+}
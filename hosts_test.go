@@ -0,0 +1,78 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHostsResolver(t *testing.T) {
+	defer func(fn func() time.Time) { timeNow = fn }(timeNow)
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+
+	dir, err := ioutil.TempDir("", "nett")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hosts")
+	write := func(data string, mtime time.Time) {
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("# comment\n127.0.0.1 localhost Foo.local # alias\n::1 localhost\n", now)
+
+	r := &HostsResolver{Path: path, ReloadInterval: time.Minute}
+	ips, err := r.Resolve("LOCALHOST")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}; !reflect.DeepEqual(ips, want) {
+		t.Fatalf("ips: expected %v; got %v", want, ips)
+	}
+	if _, err := r.Resolve("foo.local"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := r.Resolve("bar.local"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	write("192.0.2.1 bar.local\n", now.Add(time.Second))
+	if _, err := r.Resolve("bar.local"); err == nil {
+		t.Fatal("expected error before reload interval")
+	}
+	now = now.Add(time.Minute)
+	if _, err := r.Resolve("bar.local"); err != nil {
+		t.Fatalf("unexpected error after reload: %v", err)
+	}
+}
+
+func TestChainResolver(t *testing.T) {
+	ip := net.IP{192, 0, 2, 1}
+	r := ChainResolver{
+		StaticResolver{"foo.com": {ip}},
+		StaticResolver{"foo.com": {net.IPv6loopback}, "bar.net": {net.IPv6loopback}},
+	}
+	if ips, err := r.Resolve("foo.com"); err != nil || !reflect.DeepEqual(ips, []net.IP{ip}) {
+		t.Errorf("foo.com: expected %v; got %v, %v", ip, ips, err)
+	}
+	if ips, err := r.Resolve("bar.net"); err != nil || !reflect.DeepEqual(ips, []net.IP{net.IPv6loopback}) {
+		t.Errorf("bar.net: expected %v; got %v, %v", net.IPv6loopback, ips, err)
+	}
+	if _, err := r.Resolve("baz.org"); err == nil {
+		t.Error("baz.org: expected error")
+	}
+}
@@ -0,0 +1,14 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build go1.13
+
+package httputil
+
+import "net/http"
+
+// forceHTTP2 enables HTTP/2 on t despite its custom dialer.
+func forceHTTP2(t *http.Transport) {
+	t.ForceAttemptHTTP2 = true
+}
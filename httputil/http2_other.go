@@ -0,0 +1,13 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !go1.13
+
+package httputil
+
+import "net/http"
+
+// forceHTTP2 does nothing, since HTTP/2 can't be enabled
+// with a custom dialer before Go 1.13.
+func forceHTTP2(t *http.Transport) {}
@@ -0,0 +1,101 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package httputil provides HTTP clients and transports
+// that dial with a nett.Dialer.
+package httputil
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/abursavich/nett"
+)
+
+// Defaults of the Transport returned by NewTransport,
+// which match those of http.DefaultTransport except
+// for the number of idle connections kept per host.
+const (
+	DefaultTLSHandshakeTimeout   = 10 * time.Second
+	DefaultIdleConnTimeout       = 90 * time.Second
+	DefaultExpectContinueTimeout = 1 * time.Second
+	DefaultMaxIdleConns          = 100
+	DefaultMaxIdleConnsPerHost   = 10
+)
+
+// An Option configures a Transport created by NewTransport or NewClient.
+type Option func(*http.Transport)
+
+// NewTransport returns an *http.Transport that dials with d, with
+// the defaults above and HTTP/2 enabled where Go supports it with
+// a custom dialer. If d's Proxy is nil, the proxy is configured by
+// the environment, as by http.ProxyFromEnvironment; otherwise, d
+// dials through its proxy and the Transport doesn't use one.
+func NewTransport(d *nett.Dialer, opts ...Option) *http.Transport {
+	t := &http.Transport{
+		DialContext:           d.DialContext,
+		TLSHandshakeTimeout:   DefaultTLSHandshakeTimeout,
+		IdleConnTimeout:       DefaultIdleConnTimeout,
+		ExpectContinueTimeout: DefaultExpectContinueTimeout,
+		MaxIdleConns:          DefaultMaxIdleConns,
+		MaxIdleConnsPerHost:   DefaultMaxIdleConnsPerHost,
+	}
+	if d.Proxy == nil {
+		t.Proxy = http.ProxyFromEnvironment
+	}
+	forceHTTP2(t)
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// NewClient returns an *http.Client whose Transport is
+// created by NewTransport with d and opts.
+func NewClient(d *nett.Dialer, opts ...Option) *http.Client {
+	return &http.Client{Transport: NewTransport(d, opts...)}
+}
+
+// WithTLSHandshakeTimeout sets the Transport's TLSHandshakeTimeout.
+// If zero, there's no timeout.
+func WithTLSHandshakeTimeout(timeout time.Duration) Option {
+	return func(t *http.Transport) {
+		t.TLSHandshakeTimeout = timeout
+	}
+}
+
+// WithIdleConnTimeout sets the Transport's IdleConnTimeout.
+// If zero, there's no limit.
+func WithIdleConnTimeout(timeout time.Duration) Option {
+	return func(t *http.Transport) {
+		t.IdleConnTimeout = timeout
+	}
+}
+
+// WithMaxIdleConns sets the Transport's MaxIdleConns and
+// MaxIdleConnsPerHost. If zero, there's no limit in total
+// and http.DefaultMaxIdleConnsPerHost are kept per host.
+func WithMaxIdleConns(total, perHost int) Option {
+	return func(t *http.Transport) {
+		t.MaxIdleConns = total
+		t.MaxIdleConnsPerHost = perHost
+	}
+}
+
+// WithProxy sets the Transport's Proxy.
+// If nil, no proxy is used.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(t *http.Transport) {
+		t.Proxy = proxy
+	}
+}
+
+// WithTLSConfig sets the Transport's TLSClientConfig.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(t *http.Transport) {
+		t.TLSClientConfig = config
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputil
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/abursavich/nett"
+)
+
+func TestNewClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	var dialed int
+	d := &nett.Dialer{
+		OnDialDone: func(network, address string, attempt int, elapsed time.Duration, err error) {
+			dialed++
+		},
+	}
+	c := NewClient(d, WithMaxIdleConns(10, 2), WithProxy(nil))
+	tr := c.Transport.(*http.Transport)
+	if tr.MaxIdleConns != 10 || tr.MaxIdleConnsPerHost != 2 || tr.Proxy != nil {
+		t.Fatalf("unexpected transport: %+v", tr)
+	}
+	if tr.TLSHandshakeTimeout != DefaultTLSHandshakeTimeout {
+		t.Fatalf("expected TLS handshake timeout %v; got %v", DefaultTLSHandshakeTimeout, tr.TLSHandshakeTimeout)
+	}
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || string(b) != "hello" {
+			t.Fatalf("unexpected response: %q, %v", b, err)
+		}
+	}
+	if dialed != 1 {
+		t.Fatalf("expected 1 dial; got %d", dialed)
+	}
+}
+
+func TestNewTransportProxy(t *testing.T) {
+	if tr := NewTransport(&nett.Dialer{}); tr.Proxy == nil {
+		t.Fatal("expected proxy from the environment")
+	}
+	d := &nett.Dialer{Proxy: func(network, address string) (*url.URL, error) { return nil, nil }}
+	if tr := NewTransport(d); tr.Proxy != nil {
+		t.Fatal("expected no proxy when dialing through the Dialer's proxy")
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !windows
+
+package nett
+
+import "net"
+
+// interfaceByName returns the interface specified by name,
+// which may also be its numeric index.
+func interfaceByName(name string) (*net.Interface, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err == nil {
+		return ifi, nil
+	}
+	if n, i, ok := dtoi(name, 0); ok && i == len(name) {
+		return net.InterfaceByIndex(n)
+	}
+	return nil, err
+}
+
+// ipv6Bound reports whether IPv6 is bound to any of the interfaces.
+// It's only refined on Windows, where IPv6 may be unbound from each
+// network adapter while the stack still works.
+func ipv6Bound() bool {
+	return true
+}
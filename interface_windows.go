@@ -0,0 +1,57 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import "net"
+
+// interfaceByName returns the interface specified by name, which may
+// be its numeric index, as in Windows zone IDs such as "fe80::1%12",
+// or its friendly name, such as "Ethernet 2", in any case.
+func interfaceByName(name string) (*net.Interface, error) {
+	if n, i, ok := dtoi(name, 0); ok && i == len(name) {
+		return net.InterfaceByIndex(n)
+	}
+	ifi, err := net.InterfaceByName(name)
+	if err == nil {
+		return ifi, nil
+	}
+	ifts, ierr := net.Interfaces()
+	if ierr != nil {
+		return nil, err
+	}
+	name = lowerASCII(name)
+	for i := range ifts {
+		if lowerASCII(ifts[i].Name) == name {
+			return &ifts[i], nil
+		}
+	}
+	return nil, err
+}
+
+// ipv6Bound reports whether IPv6 is bound to any of the interfaces
+// that are up, other than loopback. On Windows, IPv6 may be unbound
+// from each network adapter while the stack, and so the probe of the
+// loopback address, still works.
+func ipv6Bound() bool {
+	ifts, err := net.Interfaces()
+	if err != nil {
+		return true
+	}
+	for _, ifi := range ifts {
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
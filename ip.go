@@ -0,0 +1,29 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import "net"
+
+// ParseIPv4 parses s as a literal IPv4 address in dotted decimal
+// form, such as "192.0.2.1". It returns nil if s isn't one.
+// The address is returned in its 16-byte form.
+func ParseIPv4(s string) net.IP {
+	return parseIPv4(s)
+}
+
+// ParseIPv6 parses s as a literal IPv6 address, such as "2001:db8::1",
+// with an optional zone, such as "fe80::1%eth0", and returns the
+// address and its zone. Unlike net.ParseIP, it keeps the zone.
+// It returns a nil address if s isn't one.
+func ParseIPv6(s string) (ip net.IP, zone string) {
+	return parseIPv6(s, true)
+}
+
+// SplitHostZone splits s, such as "fe80::1%eth0", into a host and
+// the zone that follows its last percent sign. If s doesn't have
+// a zone, the zone is empty.
+func SplitHostZone(s string) (host, zone string) {
+	return splitHostZone(s)
+}
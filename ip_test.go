@@ -0,0 +1,41 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseIP(t *testing.T) {
+	tests := []struct {
+		s    string
+		ip   net.IP
+		zone string
+	}{
+		{"192.0.2.1", net.IPv4(192, 0, 2, 1), ""},
+		{"2001:db8::1", net.ParseIP("2001:db8::1"), ""},
+		{"fe80::1%eth0", net.ParseIP("fe80::1"), "eth0"},
+		{"::ffff:192.0.2.1", net.IPv4(192, 0, 2, 1), ""},
+		{"192.0.2", nil, ""},
+		{"2001:db8::g", nil, ""},
+		{"foo.test", nil, ""},
+	}
+	for _, tt := range tests {
+		ip, zone := ParseIPv4(tt.s), ""
+		if ip == nil {
+			ip, zone = ParseIPv6(tt.s)
+		}
+		if !ip.Equal(tt.ip) || zone != tt.zone {
+			t.Errorf("%q: expected %v, %q; got %v, %q", tt.s, tt.ip, tt.zone, ip, zone)
+		}
+	}
+	if host, zone := SplitHostZone("fe80::1%eth0"); host != "fe80::1" || zone != "eth0" {
+		t.Errorf("SplitHostZone: unexpected %q, %q", host, zone)
+	}
+	if host, zone := SplitHostZone("foo.test"); host != "foo.test" || zone != "" {
+		t.Errorf("SplitHostZone: unexpected %q, %q", host, zone)
+	}
+}
@@ -6,38 +6,142 @@
 
 package nett
 
-import "net"
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
 
-var (
-	// supportsIPv4 reports whether the platform supports IPv4
+// ipStackCaps is a set of the capabilities of the platform's IP
+// stack. It's loaded once and then consulted for every address
+// that's filtered.
+type ipStackCaps uint32
+
+const (
+	// stackIPv4 reports whether the platform supports IPv4
 	// networking functionality.
-	supportsIPv4 bool
+	stackIPv4 ipStackCaps = 1 << iota
 
-	// supportsIPv6 reports whether the platform supports IPv6
+	// stackIPv6 reports whether the platform supports IPv6
 	// networking functionality.
-	supportsIPv6 bool
+	stackIPv6
 
-	// supportsIPv4map reports whether the platform supports
+	// stackIPv4map reports whether the platform supports
 	// mapping an IPv4 address inside an IPv6 address at transport
 	// layer protocols.  See RFC 4291, RFC 4038 and RFC 3493.
-	supportsIPv4map bool
+	stackIPv4map
 )
 
-func init() {
-	supportsIPv4 = probeIPv4Stack()
-	supportsIPv6, supportsIPv4map = probeIPv6Stack()
+func makeIPStackCaps(ipv4, ipv6, ipv4map bool) ipStackCaps {
+	var s ipStackCaps
+	if ipv4 {
+		s |= stackIPv4
+	}
+	if ipv6 {
+		s |= stackIPv6
+	}
+	if ipv4map {
+		s |= stackIPv4map
+	}
+	return s
+}
+
+// The platform's IP stack is probed when it's first needed
+// rather than at init, which would open sockets in programs
+// that never use them.
+var (
+	stackOnce sync.Once
+	stack     uint32 // ipStackCaps
+)
+
+// loadIPStack returns the capabilities of the platform's IP stack,
+// probing it if it hasn't been probed or set.
+func loadIPStack() ipStackCaps {
+	stackOnce.Do(func() {
+		ipv4 := probeIPv4Stack()
+		ipv6, ipv4map := probeIPv6Stack()
+		atomic.StoreUint32(&stack, uint32(makeIPStackCaps(ipv4, ipv6, ipv4map)))
+	})
+	return ipStackCaps(atomic.LoadUint32(&stack))
+}
+
+// SupportsIPv4 reports whether the platform supports IPv4
+// networking functionality.
+func SupportsIPv4() bool {
+	return loadIPStack()&stackIPv4 != 0
+}
+
+// SupportsIPv6 reports whether the platform supports IPv6
+// networking functionality.
+func SupportsIPv6() bool {
+	return loadIPStack()&stackIPv6 != 0
+}
+
+// SupportsIPv4Mapped reports whether the platform supports
+// mapping an IPv4 address inside an IPv6 address at transport
+// layer protocols. See RFC 4291, RFC 4038 and RFC 3493.
+func SupportsIPv4Mapped() bool {
+	return loadIPStack()&stackIPv4map != 0
+}
+
+// Reprobe probes the platform's IP stack again, such as after its
+// network configuration has changed when a VPN is brought up or
+// down. It discards the capabilities given to SetIPStack.
+// Addresses of unsupported families are not dialed.
+func Reprobe() {
+	ipv4 := probeIPv4Stack()
+	ipv6, ipv4map := probeIPv6Stack()
+	SetIPStack(ipv4, ipv6, ipv4map)
+}
+
+// SetIPStack overrides the capabilities of the platform's IP stack
+// without probing it, such as in tests or in containers where
+// probing is misleading or not allowed. They're kept until the
+// next call to SetIPStack or Reprobe.
+func SetIPStack(ipv4, ipv6, ipv4map bool) {
+	stackOnce.Do(func() {}) // don't probe over them
+	atomic.StoreUint32(&stack, uint32(makeIPStackCaps(ipv4, ipv6, ipv4map)))
 }
 
 // supportedIP returns a version of the IP that the platform
 // supports. If it is not supported it returns nil.
-func supportedIP(ip net.IP) net.IP {
-	if supportsIPv4 {
+func (s ipStackCaps) supportedIP(ip net.IP) net.IP {
+	if s&stackIPv4 != 0 {
 		if v4 := ip.To4(); v4 != nil {
 			return v4
 		}
 	}
-	if supportsIPv6 && len(ip) == net.IPv6len {
+	if s&stackIPv6 != 0 && len(ip) == net.IPv6len {
 		return ip
 	}
 	return nil
 }
+
+// ipv4only returns IPv4 addresses that we can use with the kernel's
+// IPv4 addressing modes. If ip is an IPv4 address, ipv4only returns ip.
+// Otherwise it returns nil.
+func (s ipStackCaps) ipv4only(ip net.IP) net.IP {
+	if s&stackIPv4 != 0 {
+		return ip.To4()
+	}
+	return nil
+}
+
+// ipv6only returns IPv6 addresses that we can use with the kernel's
+// IPv6 addressing modes.  It returns IPv4-mapped IPv6 addresses as
+// nils and returns other IPv6 address types as IPv6 addresses.
+func (s ipStackCaps) ipv6only(ip net.IP) net.IP {
+	if s&stackIPv6 != 0 && len(ip) == net.IPv6len && ip.To4() == nil {
+		return ip
+	}
+	return nil
+}
+
+// ipv6orMapped is like ipv6only, but it also returns IPv4-mapped
+// IPv6 addresses if the platform supports them.
+func (s ipStackCaps) ipv6orMapped(ip net.IP) net.IP {
+	if ip.To4() != nil && len(ip) == net.IPv6len && s&stackIPv4map != 0 {
+		return ip
+	}
+	return s.ipv6only(ip)
+}
@@ -66,7 +66,7 @@ func probeIPv6Stack() (supportsIPv6, supportsIPv4map bool) {
 		probes[i].ok = true
 	}
 
-	return probes[0].ok, probes[1].ok
+	return probes[0].ok && ipv6Bound(), probes[1].ok
 }
 
 func tcpSockaddr(a net.TCPAddr, family int) (syscall.Sockaddr, error) {
@@ -116,7 +116,7 @@ func zoneToInt(zone string) int {
 	if zone == "" {
 		return 0
 	}
-	if ifi, err := net.InterfaceByName(zone); err == nil {
+	if ifi, err := interfaceByName(zone); err == nil {
 		return ifi.Index
 	}
 	n, _, _ := dtoi(zone, 0)
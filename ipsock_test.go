@@ -0,0 +1,83 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestReprobe(t *testing.T) {
+	ipv4 := probeIPv4Stack()
+	ipv6, ipv4map := probeIPv6Stack()
+	SetIPStack(!ipv4, !ipv6, !ipv4map)
+	if SupportsIPv4() == ipv4 || SupportsIPv6() == ipv6 || SupportsIPv4Mapped() == ipv4map {
+		t.Fatal("expected the set capabilities")
+	}
+	Reprobe()
+	if SupportsIPv4() != ipv4 || SupportsIPv6() != ipv6 || SupportsIPv4Mapped() != ipv4map {
+		t.Fatalf("expected (%v, %v, %v); got (%v, %v, %v)", ipv4, ipv6, ipv4map,
+			SupportsIPv4(), SupportsIPv6(), SupportsIPv4Mapped())
+	}
+}
+
+func TestSetIPStack(t *testing.T) {
+	defer Reprobe()
+	SetIPStack(false, false, false)
+	_, err := resolveAddrList(context.Background(), nil, nil, false, "tcp", "127.0.0.1:80")
+	if err != ErrNoSuitableAddress {
+		t.Fatalf("expected ErrNoSuitableAddress without IP support; got %v", err)
+	}
+}
+
+func TestIPv4Mapped(t *testing.T) {
+	defer Reprobe()
+	SetIPStack(true, true, true)
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	address := net.JoinHostPort("mapped.test", port)
+
+	d := &Dialer{Resolver: StaticResolver{"mapped.test": {net.ParseIP("::ffff:127.0.0.1")}}}
+	if _, err := d.Dial("tcp6", address); err == nil {
+		t.Fatal("expected error without IPv4Mapped")
+	}
+	d.IPv4Mapped = true
+	c, err := d.Dial("tcp6", address)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Close()
+
+	SetIPStack(true, true, false)
+	if _, err := d.Dial("tcp6", address); err == nil {
+		t.Fatal("expected error without IPv4-mapped address support")
+	}
+}
+
+func TestInterfaceByName(t *testing.T) {
+	ifts, err := net.Interfaces()
+	if err != nil || len(ifts) == 0 {
+		t.Skipf("no interfaces: %v", err)
+	}
+	want := ifts[0]
+	for _, name := range []string{want.Name, fmt.Sprint(want.Index)} {
+		ifi, err := interfaceByName(name)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", name, err)
+		}
+		if ifi.Index != want.Index {
+			t.Fatalf("%q: expected index %d; got %d", name, want.Index, ifi.Index)
+		}
+	}
+	if _, err := interfaceByName("nett-no-such-interface"); err == nil {
+		t.Fatal("expected error")
+	}
+}
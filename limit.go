@@ -0,0 +1,225 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var errBurst = errors.New("exceeds burst size")
+
+// A Limiter limits the rate of connection attempts.
+// It's satisfied by *rate.Limiter of golang.org/x/time/rate.
+type Limiter interface {
+	// Wait blocks until an attempt is allowed. It returns an
+	// error if ctx is done first or the attempt can't be allowed
+	// before ctx's deadline.
+	Wait(ctx context.Context) error
+}
+
+// A ByteLimiter limits the rate at which bytes are transferred.
+// It's satisfied by *rate.Limiter of golang.org/x/time/rate.
+type ByteLimiter interface {
+	// WaitN blocks until n bytes may be transferred. It returns
+	// an error if ctx is done first or n exceeds Burst.
+	WaitN(ctx context.Context, n int) error
+
+	// Burst returns the maximum number of bytes
+	// that may be transferred at once.
+	Burst() int
+}
+
+// A TokenBucket is a Limiter that allows attempts at a steady
+// rate with bursts. It's also a ByteLimiter whose tokens are bytes.
+// Its methods are safe for concurrent use.
+type TokenBucket struct {
+	rate  float64 // tokens per nanosecond, or zero if unlimited
+	burst int
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a TokenBucket that allows an attempt
+// every interval on average and bursts of up to burst attempts.
+func NewTokenBucket(interval time.Duration, burst int) *TokenBucket {
+	var rate float64
+	if interval > 0 {
+		rate = 1 / float64(interval)
+	}
+	return newTokenBucket(rate, burst)
+}
+
+// NewByteRate returns a TokenBucket, for use as a ByteLimiter,
+// that allows bytesPerSecond bytes every second on average and
+// bursts of up to burst bytes.
+func NewByteRate(bytesPerSecond, burst int) *TokenBucket {
+	var rate float64
+	if bytesPerSecond > 0 {
+		rate = float64(bytesPerSecond) / float64(time.Second)
+	}
+	return newTokenBucket(rate, burst)
+}
+
+func newTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{rate: rate, burst: burst, tokens: float64(burst)}
+}
+
+// Wait blocks until an attempt is allowed.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	return b.WaitN(ctx, 1)
+}
+
+// WaitN blocks until n tokens are available. It returns an error
+// if n exceeds the bucket's burst size.
+func (b *TokenBucket) WaitN(ctx context.Context, n int) error {
+	if n > b.burst {
+		return errBurst
+	}
+	b.mu.Lock()
+	now := timeNow()
+	if !b.last.IsZero() && b.rate > 0 {
+		b.tokens += float64(now.Sub(b.last)) * b.rate
+		if b.tokens > float64(b.burst) {
+			b.tokens = float64(b.burst)
+		}
+	} else if b.rate <= 0 {
+		b.tokens = float64(b.burst)
+	}
+	b.last = now
+	var wait time.Duration
+	if b.tokens < float64(n) {
+		wait = time.Duration((float64(n) - b.tokens) / b.rate)
+		if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(wait)) {
+			b.mu.Unlock()
+			return errTimeout
+		}
+	}
+	// Reserve the tokens now so that waiters are served in order.
+	b.tokens -= float64(n)
+	b.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens += float64(n)
+		b.mu.Unlock()
+		return contextError(ctx.Err())
+	}
+}
+
+// Burst returns the maximum number of tokens that may be
+// taken at once.
+func (b *TokenBucket) Burst() int { return b.burst }
+
+// PerHost returns a function, for use as a Dialer's HostLimiter,
+// that returns a Limiter created by newLimiter for each host.
+// The Limiters are kept for the lifetime of the function.
+func PerHost(newLimiter func() Limiter) func(host string) Limiter {
+	var (
+		mu       sync.Mutex
+		limiters = make(map[string]Limiter)
+	)
+	return func(host string) Limiter {
+		mu.Lock()
+		defer mu.Unlock()
+		l, ok := limiters[host]
+		if !ok {
+			l = newLimiter()
+			limiters[host] = l
+		}
+		return l
+	}
+}
+
+// dialSlots limits the number of connection attempts in progress.
+type dialSlots struct {
+	mu    sync.Mutex
+	all   chan struct{}
+	hosts map[string]*hostSlots
+}
+
+// hostSlots limits the number of connection attempts in progress
+// to a host.
+type hostSlots struct {
+	slots chan struct{}
+	refs  int // attempts holding or waiting for a slot
+}
+
+// acquire waits for a slot for an attempt to dial the host, allowing
+// at most max attempts in total and perHost attempts to the host if
+// they're positive. It returns a function that releases the slot.
+func (s *dialSlots) acquire(ctx context.Context, host string, max, perHost int) (release func(), err error) {
+	s.mu.Lock()
+	if max > 0 && s.all == nil {
+		s.all = make(chan struct{}, max)
+	}
+	var h *hostSlots
+	if perHost > 0 {
+		h = s.hosts[host]
+		if h == nil {
+			h = &hostSlots{slots: make(chan struct{}, perHost)}
+			if s.hosts == nil {
+				s.hosts = make(map[string]*hostSlots)
+			}
+			s.hosts[host] = h
+		}
+		h.refs++
+	}
+	all := s.all
+	s.mu.Unlock()
+
+	unref := func() {
+		if h == nil {
+			return
+		}
+		s.mu.Lock()
+		if h.refs--; h.refs == 0 {
+			delete(s.hosts, host)
+		}
+		s.mu.Unlock()
+	}
+	if h != nil {
+		select {
+		case h.slots <- struct{}{}:
+		case <-ctx.Done():
+			unref()
+			return nil, contextError(ctx.Err())
+		}
+	}
+	if max > 0 {
+		select {
+		case all <- struct{}{}:
+		case <-ctx.Done():
+			if h != nil {
+				<-h.slots
+			}
+			unref()
+			return nil, contextError(ctx.Err())
+		}
+	}
+	return func() {
+		if max > 0 {
+			<-all
+		}
+		if h != nil {
+			<-h.slots
+		}
+		unref()
+	}, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	defer func(timeFn func() time.Time) { timeNow = timeFn }(timeNow)
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+
+	b := NewTokenBucket(time.Minute, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		if err := b.Wait(ctx); err != nil {
+			t.Fatalf("burst %d: unexpected error: %v", i, err)
+		}
+	}
+	// The next token is a minute away, past the deadline.
+	if err := b.Wait(ctx); err == nil {
+		t.Fatal("expected error past the deadline")
+	}
+	now = now.Add(time.Minute)
+	if err := b.Wait(ctx); err != nil {
+		t.Fatalf("unexpected error after refill: %v", err)
+	}
+}
+
+type countLimiter struct{ n int }
+
+func (l *countLimiter) Wait(ctx context.Context) error {
+	l.n++
+	return nil
+}
+
+func TestDialLimiter(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	global := &countLimiter{}
+	hosts := make(map[string]*countLimiter)
+	d := &Dialer{
+		Resolver: StaticResolver{"a.test": {net.IPv4(127, 0, 0, 1)}, "b.test": {net.IPv4(127, 0, 0, 1)}},
+		Limiter:  global,
+		HostLimiter: PerHost(func() Limiter {
+			return &countLimiter{}
+		}),
+	}
+	for _, host := range []string{"a.test", "a.test", "b.test"} {
+		c, err := d.Dial("tcp", net.JoinHostPort(host, port))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		c.Close()
+		hosts[host] = d.HostLimiter(host).(*countLimiter)
+	}
+	if global.n != 3 || hosts["a.test"].n != 2 || hosts["b.test"].n != 1 {
+		t.Fatalf("attempts: expected 3 total, 2 to a.test and 1 to b.test; got %d, %d and %d",
+			global.n, hosts["a.test"].n, hosts["b.test"].n)
+	}
+
+	// A limiter that can't allow the attempt in time fails the dial.
+	d.Limiter = NewTokenBucket(time.Hour, 1)
+	d.Timeout = time.Second
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Close()
+	_, err = d.Dial("tcp", ln.Addr().String())
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Fatalf("expected timeout error; got %v", err)
+	}
+}
+
+func TestDialSlots(t *testing.T) {
+	var s dialSlots
+	ctx := context.Background()
+	release, err := s.acquire(ctx, "a.test", 2, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The host's only slot is taken.
+	tctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.acquire(tctx, "a.test", 2, 1); err == nil {
+		t.Fatal("expected error waiting for host slot")
+	}
+	releaseB, err := s.acquire(ctx, "b.test", 2, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// All of the slots are taken.
+	tctx, cancel = context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.acquire(tctx, "c.test", 2, 1); err == nil {
+		t.Fatal("expected error waiting for slot")
+	}
+	release()
+	releaseB()
+	release, err = s.acquire(ctx, "a.test", 2, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	release()
+	if n := len(s.hosts); n != 0 {
+		t.Fatalf("hosts: expected 0; got %d", n)
+	}
+}
@@ -0,0 +1,446 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrSocketInUse is returned by ListenUnix if a listener is
+	// active on the socket file.
+	ErrSocketInUse = errors.New("socket in use")
+
+	errListenerClosed = errors.New("use of closed network connection")
+	errNotSocket      = errors.New("file exists and is not a socket")
+)
+
+// A ListenConfig contains options for listening to an address.
+//
+// The zero value for each field is equivalent to listening
+// without that option.
+type ListenConfig struct {
+	// Resolver is used to resolve IP addresses from domain names.
+	//
+	// If nil, DefaultResolver will be used.
+	Resolver Resolver
+
+	// Filter selects the addresses to listen on from those
+	// available after resolving a host to a set of supported IPs.
+	//
+	// If nil, a single address is selected as by DefaultFilter.
+	Filter Filter
+
+	// Control, if non-nil, is called after creating each socket
+	// and before binding it.
+	Control func(network, address string, c syscall.RawConn) error
+
+	// KeepAlive specifies the keep-alive period for accepted TCP
+	// connections.
+	//
+	// If zero, keep-alives are not enabled.
+	KeepAlive time.Duration
+}
+
+// Listen announces on the local network address. The address's
+// host may be a domain name, which is resolved to the addresses
+// selected by the Filter. If multiple addresses are selected,
+// the returned listener accepts connections on all of them and
+// is a *MultiListener. If the port is "0", the addresses
+// share the port chosen for the first.
+func (lc *ListenConfig) Listen(ctx context.Context, network, address string) (net.Listener, error) {
+	addrs, err := lc.resolve(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	lns := make([]net.Listener, 0, addrs.Len())
+	for i := 0; i < addrs.Len(); i++ {
+		addr := addrs.Addr(i)
+		if i > 0 {
+			addr = samePort(addr, lns[0].Addr())
+		}
+		ln, err := lc.config().Listen(ctx, network, addr.String())
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return nil, err
+		}
+		if lc.KeepAlive > 0 {
+			if _, ok := ln.(*net.TCPListener); ok {
+				ln = &KeepAliveListener{Listener: ln, KeepAlive: lc.KeepAlive}
+			}
+		}
+		lns = append(lns, ln)
+	}
+	if len(lns) == 1 {
+		return lns[0], nil
+	}
+	return NewMultiListener(lns...), nil
+}
+
+// ListenPacket announces on the local network address. The address's
+// host may be a domain name, which is resolved to the addresses
+// selected by the Filter. A packet connection is bound to a single
+// address, so only the first selected address is used.
+func (lc *ListenConfig) ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error) {
+	addrs, err := lc.resolve(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return lc.config().ListenPacket(ctx, network, addrs.Addr(0).String())
+}
+
+func (lc *ListenConfig) config() *net.ListenConfig {
+	return &net.ListenConfig{Control: lc.Control}
+}
+
+// resolve returns the addresses to listen on.
+func (lc *ListenConfig) resolve(ctx context.Context, network, address string) (addrList, error) {
+	f := lc.Filter
+	if f == nil {
+		f = FilterFunc(DefaultFilter)
+	}
+	host := hostOf(address)
+	filter := func(ips []net.IP) []net.IP {
+		return f.Filter(network, host, ips)
+	}
+	addrs, err := resolveAddrList(ctx, lc.Resolver, filter, false, network, address)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: network, Err: err}
+	}
+	return addrs, nil
+}
+
+// samePort returns addr with the port of first if addr's port is 0.
+func samePort(addr, first net.Addr) net.Addr {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		if a.Port == 0 {
+			if f, ok := first.(*net.TCPAddr); ok {
+				return &net.TCPAddr{IP: a.IP, Port: f.Port, Zone: a.Zone}
+			}
+		}
+	case *net.UDPAddr:
+		if a.Port == 0 {
+			if f, ok := first.(*net.UDPAddr); ok {
+				return &net.UDPAddr{IP: a.IP, Port: f.Port, Zone: a.Zone}
+			}
+		}
+	}
+	return addr
+}
+
+// A KeepAliveListener sets options on the TCP connections accepted
+// by its Listener, as net/http does for its servers. Connections
+// of other types are returned as is.
+type KeepAliveListener struct {
+	net.Listener
+
+	// KeepAlive specifies the keep-alive period of accepted
+	// connections. If negative, keep-alives are disabled.
+	//
+	// If zero, a default period of 3 minutes is used.
+	KeepAlive time.Duration
+
+	// NoDelay, if non-nil, specifies whether the operating system
+	// should delay packet transmission on accepted connections in
+	// hopes of sending fewer packets (Nagle's algorithm).
+	//
+	// If nil, the operating system's default is used, which is
+	// no delay in Go.
+	NoDelay *bool
+
+	// Timeout, if positive, is the length of time after which
+	// an accepted connection's deadline is set, bounding the time
+	// for the peer to send its first request, for example. The
+	// deadline can be extended or cleared by the server.
+	Timeout time.Duration
+}
+
+// Accept waits for and returns the next connection with its
+// options set. Failures to set the options are ignored.
+func (ln *KeepAliveListener) Accept() (net.Conn, error) {
+	c, err := ln.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tc, ok := c.(*net.TCPConn)
+	if !ok {
+		return c, nil
+	}
+	switch {
+	case ln.KeepAlive < 0:
+		tc.SetKeepAlive(false)
+	case ln.KeepAlive == 0:
+		tc.SetKeepAlive(true)
+		tc.SetKeepAlivePeriod(3 * time.Minute)
+	default:
+		tc.SetKeepAlive(true)
+		tc.SetKeepAlivePeriod(ln.KeepAlive)
+	}
+	if ln.NoDelay != nil {
+		tc.SetNoDelay(*ln.NoDelay)
+	}
+	if ln.Timeout > 0 {
+		tc.SetDeadline(timeNow().Add(ln.Timeout))
+	}
+	return tc, nil
+}
+
+// A MultiListener accepts connections on several listeners, such
+// as those of an IPv4 and an IPv6 address or of several ports,
+// as a single net.Listener. Connections are accepted from the
+// listeners in the order they become ready, so a busy listener
+// doesn't starve the others. Its methods are safe for concurrent
+// use.
+type MultiListener struct {
+	lns   []net.Listener
+	conns chan acceptResult
+	done  chan struct{}
+	once  sync.Once
+}
+
+type acceptResult struct {
+	c   net.Conn
+	err error
+}
+
+// NewMultiListener returns a MultiListener that accepts connections
+// on lns. It panics if lns is empty.
+func NewMultiListener(lns ...net.Listener) *MultiListener {
+	if len(lns) == 0 {
+		panic("nett: NewMultiListener with no listeners")
+	}
+	ln := &MultiListener{
+		lns:   append([]net.Listener(nil), lns...),
+		conns: make(chan acceptResult),
+		done:  make(chan struct{}),
+	}
+	for _, l := range ln.lns {
+		go ln.accept(l)
+	}
+	return ln
+}
+
+// accept accepts connections on l until it fails permanently.
+// Each listener waits its turn to deliver a connection, so they're
+// served in turn.
+func (ln *MultiListener) accept(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		select {
+		case ln.conns <- acceptResult{c, err}:
+		case <-ln.done:
+			if c != nil {
+				c.Close()
+			}
+			return
+		}
+		if nerr, ok := err.(net.Error); err != nil && (!ok || !nerr.Temporary()) {
+			return
+		}
+	}
+}
+
+// Accept waits for and returns the next connection accepted
+// on any of the listeners. An error returned by a listener is
+// returned as is; a listener that fails permanently is no longer
+// accepted on.
+func (ln *MultiListener) Accept() (net.Conn, error) {
+	select {
+	case r := <-ln.conns:
+		return r.c, r.err
+	case <-ln.done:
+		return nil, &net.OpError{Op: "accept", Net: ln.Addr().Network(), Addr: ln.Addr(), Err: errListenerClosed}
+	}
+}
+
+// Close closes all of the listeners. It returns the first error
+// returned by closing them.
+func (ln *MultiListener) Close() error {
+	var err error
+	ln.once.Do(func() {
+		close(ln.done)
+		for _, l := range ln.lns {
+			if cerr := l.Close(); err == nil {
+				err = cerr
+			}
+		}
+	})
+	return err
+}
+
+// Addr returns the address of the first listener.
+func (ln *MultiListener) Addr() net.Addr {
+	return ln.lns[0].Addr()
+}
+
+// Addrs returns the addresses of all of the listeners.
+func (ln *MultiListener) Addrs() []net.Addr {
+	addrs := make([]net.Addr, len(ln.lns))
+	for i, l := range ln.lns {
+		addrs[i] = l.Addr()
+	}
+	return addrs
+}
+
+// A TrackingListener tracks the connections accepted by its
+// Listener until they're closed, so that a server can be shut
+// down gracefully. Accepted connections are wrapped, so their
+// concrete types aren't exposed. Its methods are safe for
+// concurrent use.
+type TrackingListener struct {
+	net.Listener
+
+	mu       sync.Mutex
+	active   int
+	shutdown bool
+	idle     chan struct{} // closed when shut down with no active connections
+}
+
+// Accept waits for and returns the next connection, which is
+// tracked until it's closed.
+func (ln *TrackingListener) Accept() (net.Conn, error) {
+	c, err := ln.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	ln.mu.Lock()
+	if ln.shutdown {
+		ln.mu.Unlock()
+		c.Close()
+		return nil, &net.OpError{Op: "accept", Net: ln.Addr().Network(), Addr: ln.Addr(), Err: errListenerClosed}
+	}
+	ln.active++
+	ln.mu.Unlock()
+	return &trackedConn{Conn: c, ln: ln}, nil
+}
+
+// Active returns the number of accepted connections that
+// haven't been closed.
+func (ln *TrackingListener) Active() int {
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+	return ln.active
+}
+
+// Shutdown closes the listener and waits for the accepted
+// connections to be closed. If ctx is done first, Shutdown
+// returns its error and the connections are left open.
+func (ln *TrackingListener) Shutdown(ctx context.Context) error {
+	var err error
+	ln.mu.Lock()
+	if !ln.shutdown {
+		ln.shutdown = true
+		ln.idle = make(chan struct{})
+		if ln.active == 0 {
+			close(ln.idle)
+		}
+		err = ln.Listener.Close()
+	}
+	idle := ln.idle
+	ln.mu.Unlock()
+	select {
+	case <-idle:
+		return err
+	case <-ctx.Done():
+		return contextError(ctx.Err())
+	}
+}
+
+// closed untracks a closed connection.
+func (ln *TrackingListener) closed() {
+	ln.mu.Lock()
+	if ln.active--; ln.active == 0 && ln.shutdown {
+		close(ln.idle)
+	}
+	ln.mu.Unlock()
+}
+
+// trackedConn is a connection of a TrackingListener.
+type trackedConn struct {
+	net.Conn
+	ln   *TrackingListener
+	once sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.ln.closed)
+	return err
+}
+
+// ListenUnix announces on the unix socket file at path and sets its
+// permissions to mode. A stale socket file left by a listener that
+// is no longer active is removed first, and missing parent
+// directories are created. The socket file is removed when the
+// listener is closed.
+//
+// On Unix, the socket file is created without any permissions and
+// only then given mode, so it can't be connected to in the meantime.
+func ListenUnix(path string, mode os.FileMode) (*net.UnixListener, error) {
+	return ListenUnixOwner(path, mode, -1, -1)
+}
+
+// ListenUnixOwner acts like ListenUnix and also changes the owner
+// and group of the socket file to uid and gid before giving it mode.
+// A uid or gid of -1 isn't changed.
+func ListenUnixOwner(path string, mode os.FileMode, uid, gid int) (*net.UnixListener, error) {
+	addr := &net.UnixAddr{Name: path, Net: "unix"}
+	if err := removeStaleSocket(path); err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "unix", Addr: addr, Err: err}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	ln, err := listenUnixPrivate(addr)
+	if err != nil {
+		return nil, err
+	}
+	// The listener removes the socket file it created when closed.
+	if uid != -1 || gid != -1 {
+		if err := os.Chown(path, uid, gid); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// removeStaleSocket removes the socket file at path if there
+// isn't a listener active on it.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return errNotSocket
+	}
+	c, err := net.Dial("unix", path)
+	if err == nil {
+		c.Close()
+		return ErrSocketInUse
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
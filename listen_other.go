@@ -0,0 +1,15 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package nett
+
+import "net"
+
+// listenUnixPrivate announces on the unix socket file addr.
+// There's no umask on this platform to create it privately.
+func listenUnixPrivate(addr *net.UnixAddr) (*net.UnixListener, error) {
+	return net.ListenUnix("unix", addr)
+}
@@ -0,0 +1,264 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListenMulti(t *testing.T) {
+	lc := &ListenConfig{
+		Resolver: StaticResolver{"multi.test": {net.IPv4(127, 0, 0, 1), net.IPv4(127, 0, 0, 2)}},
+		Filter:   FilterFunc(func(ips []net.IP) []net.IP { return ips }),
+	}
+	ln, err := lc.Listen(context.Background(), "tcp4", "multi.test:0")
+	if err != nil {
+		t.Skipf("listen failed: %v", err)
+	}
+	defer ln.Close()
+	addrs := ln.(*MultiListener).Addrs()
+	if len(addrs) != 2 {
+		t.Fatalf("addrs: expected 2; got %v", addrs)
+	}
+	_, port, _ := net.SplitHostPort(addrs[0].String())
+	for _, addr := range addrs {
+		if _, p, _ := net.SplitHostPort(addr.String()); p != port {
+			t.Fatalf("addrs: expected a shared port; got %v", addrs)
+		}
+		c, err := net.Dial("tcp", addr.String())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s, err := ln.Accept()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if s.LocalAddr().String() != addr.String() {
+			t.Errorf("accepted on %v; expected %v", s.LocalAddr(), addr)
+		}
+		s.Close()
+		c.Close()
+	}
+	ln.Close()
+	if _, err := ln.Accept(); err == nil {
+		t.Fatal("expected error accepting after close")
+	}
+}
+
+func TestListenSingle(t *testing.T) {
+	lc := &ListenConfig{Resolver: StaticResolver{"single.test": {net.IPv4(127, 0, 0, 1), net.IPv4(127, 0, 0, 2)}}}
+	ln, err := lc.Listen(context.Background(), "tcp", "single.test:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+	if ip := ln.Addr().(*net.TCPAddr).IP; !ip.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Fatalf("addr: expected 127.0.0.1; got %v", ip)
+	}
+
+	pc, err := lc.ListenPacket(context.Background(), "udp", "single.test:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Close()
+	if ip := pc.LocalAddr().(*net.UDPAddr).IP; !ip.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Fatalf("addr: expected 127.0.0.1; got %v", ip)
+	}
+
+	if _, err := lc.Listen(context.Background(), "tcp", "unknown.test:0"); err == nil {
+		t.Fatal("expected error resolving unknown host")
+	}
+}
+
+func TestMultiListenerFair(t *testing.T) {
+	var lns []net.Listener
+	for i := 0; i < 2; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		lns = append(lns, ln)
+	}
+	ml := NewMultiListener(lns...)
+	defer ml.Close()
+
+	// Queue connections on both listeners, many more on the first.
+	var conns []net.Conn
+	defer func() {
+		for _, c := range conns {
+			c.Close()
+		}
+	}()
+	for i, n := range []int{8, 2} {
+		for j := 0; j < n; j++ {
+			c, err := net.Dial("tcp", lns[i].Addr().String())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			conns = append(conns, c)
+		}
+	}
+	// The second listener's connections aren't starved.
+	seen := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		// Give both listeners time to accept a connection
+		// and wait their turn to deliver it.
+		time.Sleep(5 * time.Millisecond)
+		c, err := ml.Accept()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		seen[c.LocalAddr().String()]++
+		c.Close()
+	}
+	if n := seen[lns[1].Addr().String()]; n != 2 {
+		t.Fatalf("accepted on second listener: expected 2; got %d", n)
+	}
+}
+
+func TestKeepAliveListener(t *testing.T) {
+	defer func(timeFn func() time.Time) { timeNow = timeFn }(timeNow)
+	past := time.Now().Add(-time.Hour)
+	timeNow = func() time.Time { return past }
+
+	tln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ln := &KeepAliveListener{Listener: tln, Timeout: time.Minute}
+	defer ln.Close()
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+	s, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer s.Close()
+	if _, ok := s.(*net.TCPConn); !ok {
+		t.Fatalf("expected *net.TCPConn; got %T", s)
+	}
+	// The deadline set at accept time has already passed.
+	var buf [1]byte
+	if _, err := s.Read(buf[:]); err == nil {
+		t.Fatal("expected error reading past the deadline")
+	} else if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Fatalf("expected timeout error; got %v", err)
+	}
+}
+
+func TestTrackingListener(t *testing.T) {
+	tln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ln := &TrackingListener{Listener: tln}
+	var conns []net.Conn
+	for i := 0; i < 2; i++ {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer c.Close()
+		s, err := ln.Accept()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		conns = append(conns, s)
+	}
+	conns[0].Close()
+	conns[0].Close() // closing twice is counted once
+	if n := ln.Active(); n != 1 {
+		t.Fatalf("active: expected 1; got %d", n)
+	}
+
+	// The remaining connection keeps the shutdown waiting.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := ln.Shutdown(ctx); err == nil {
+		t.Fatal("expected error shutting down with an active connection")
+	}
+	if _, err := ln.Accept(); err == nil {
+		t.Fatal("expected error accepting after shutdown")
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		conns[1].Close()
+	}()
+	if err := ln.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := ln.Active(); n != 0 {
+		t.Fatalf("active: expected 0; got %d", n)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nett")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sub", "test.sock")
+
+	ln, err := ListenUnix(path, 0600)
+	if err != nil {
+		t.Skipf("unix sockets not supported: %v", err)
+	}
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Fatalf("mode: expected 0600; got %v", perm)
+	}
+	if _, err := ListenUnix(path, 0600); err == nil {
+		t.Fatal("expected error listening on an active socket")
+	}
+
+	ln.Close()
+
+	// Leave a stale socket file behind.
+	c, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Close()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected stale socket file; got %v", err)
+	}
+	ln, err = ListenUnix(path, 0666)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ln.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected socket file to be removed; got %v", err)
+	}
+
+	ln, err = ListenUnixOwner(path, 0660, -1, os.Getgid())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if perm := fi.Mode().Perm(); perm != 0660 {
+		t.Fatalf("mode: expected 0660; got %v", perm)
+	}
+	ln.Close()
+
+	if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ListenUnix(path, 0600); err == nil {
+		t.Fatal("expected error listening on a regular file")
+	}
+}
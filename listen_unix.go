@@ -0,0 +1,27 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package nett
+
+import (
+	"net"
+	"sync"
+	"syscall"
+)
+
+// umaskMu serializes changes to the process's umask.
+var umaskMu sync.Mutex
+
+// listenUnixPrivate announces on the unix socket file addr, which
+// is created without any permissions so that it can't be connected
+// to until it's given them.
+func listenUnixPrivate(addr *net.UnixAddr) (*net.UnixListener, error) {
+	umaskMu.Lock()
+	defer umaskMu.Unlock()
+	old := syscall.Umask(0777)
+	defer syscall.Umask(old)
+	return net.ListenUnix("unix", addr)
+}
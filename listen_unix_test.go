@@ -0,0 +1,41 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package nett
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestListenUnixPrivate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nett")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.sock")
+
+	old := syscall.Umask(0)
+	defer syscall.Umask(old)
+	ln, err := listenUnixPrivate(&net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if perm := fi.Mode().Perm(); perm != 0 {
+		t.Fatalf("mode: expected no permissions; got %v", perm)
+	}
+	if mask := syscall.Umask(0); mask != 0 {
+		t.Fatalf("umask: expected 0 to be restored; got %#o", mask)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Metered is implemented by connections that account for their
+// traffic, such as a MeteredConn, so that pools and load balancers
+// can make informed decisions.
+type Metered interface {
+	// BytesRead returns the number of bytes read.
+	BytesRead() int64
+
+	// BytesWritten returns the number of bytes written.
+	BytesWritten() int64
+
+	// FirstByteLatency returns the time from the first write, or
+	// from the connection's creation if it read before writing, to
+	// the first byte read, or zero if nothing has been read.
+	FirstByteLatency() time.Duration
+}
+
+// A MeteredConn is a connection that counts the bytes read from
+// and written to it and records its first-byte latency. It
+// implements Metered. Its methods are safe for concurrent use.
+type MeteredConn struct {
+	// Accessed atomically; first for alignment.
+	read       int64
+	written    int64
+	firstWrite int64 // in Unix nanoseconds, or zero
+	firstByte  int64 // latency in nanoseconds, or zero
+
+	net.Conn
+	created time.Time
+}
+
+// NewMeteredConn returns a MeteredConn that wraps c.
+func NewMeteredConn(c net.Conn) *MeteredConn {
+	return &MeteredConn{Conn: c, created: time.Now()}
+}
+
+// Read reads data from the connection.
+func (c *MeteredConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		if atomic.AddInt64(&c.read, int64(n)) == int64(n) {
+			start := c.created
+			if ns := atomic.LoadInt64(&c.firstWrite); ns != 0 {
+				start = time.Unix(0, ns)
+			}
+			latency := time.Since(start)
+			if latency <= 0 {
+				latency = 1
+			}
+			atomic.StoreInt64(&c.firstByte, int64(latency))
+		}
+	}
+	return n, err
+}
+
+// Write writes data to the connection.
+func (c *MeteredConn) Write(b []byte) (int, error) {
+	if atomic.LoadInt64(&c.firstWrite) == 0 {
+		atomic.CompareAndSwapInt64(&c.firstWrite, 0, time.Now().UnixNano())
+	}
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		atomic.AddInt64(&c.written, int64(n))
+	}
+	return n, err
+}
+
+// BytesRead returns the number of bytes read.
+func (c *MeteredConn) BytesRead() int64 {
+	return atomic.LoadInt64(&c.read)
+}
+
+// BytesWritten returns the number of bytes written.
+func (c *MeteredConn) BytesWritten() int64 {
+	return atomic.LoadInt64(&c.written)
+}
+
+// FirstByteLatency returns the time from the first write, or from
+// the creation of the MeteredConn if it read before writing, to the
+// first byte read, or zero if nothing has been read.
+func (c *MeteredConn) FirstByteLatency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.firstByte))
+}
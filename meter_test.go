@@ -0,0 +1,63 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMeteredConn(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		b := make([]byte, 5)
+		if _, err := c.Read(b); err != nil {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		c.Write([]byte("pong!!"))
+	}()
+
+	d := &Dialer{Metered: true}
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+	m, ok := c.(Metered)
+	if !ok {
+		t.Fatalf("expected Metered conn; got %T", c)
+	}
+	if l := m.FirstByteLatency(); l != 0 {
+		t.Fatalf("first-byte latency: expected 0 before reading; got %v", l)
+	}
+	if _, err := c.Write([]byte("ping!")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b := make([]byte, 6)
+	for n := 0; n < len(b); {
+		nn, err := c.Read(b[n:])
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		n += nn
+	}
+	if r, w := m.BytesRead(), m.BytesWritten(); r != 6 || w != 5 {
+		t.Fatalf("bytes: expected 6 read and 5 written; got %d and %d", r, w)
+	}
+	if l := m.FirstByteLatency(); l < 20*time.Millisecond {
+		t.Fatalf("first-byte latency: expected at least 20ms; got %v", l)
+	}
+}
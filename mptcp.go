@@ -0,0 +1,15 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build go1.21
+
+package nett
+
+import "net"
+
+// setMultipathTCP sets whether d uses Multipath TCP. Where the
+// kernel doesn't support it, d falls back to TCP.
+func setMultipathTCP(d *net.Dialer, use bool) {
+	d.SetMultipathTCP(use)
+}
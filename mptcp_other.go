@@ -0,0 +1,12 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !go1.21
+
+package nett
+
+import "net"
+
+// setMultipathTCP does nothing, since Multipath TCP requires Go 1.21.
+func setMultipathTCP(d *net.Dialer, use bool) {}
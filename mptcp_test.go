@@ -0,0 +1,35 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build go1.21
+
+package nett
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMultipathTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+
+	d, err := NewDialer(WithMultipathTCP(true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if nd := d.netDialer(time.Time{}); !nd.MultipathTCP() {
+		t.Fatal("expected MPTCP to be used")
+	}
+	// Without kernel support, it falls back to TCP.
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Close()
+}
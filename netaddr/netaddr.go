@@ -0,0 +1,214 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package netaddr provides utilities for ranges, subnets, and sets
+// of IP addresses, such as for building allow and deny lists.
+//
+// As with net.IPNet, IPv4 addresses, including IPv4-mapped IPv6
+// addresses, are only matched by IPv4 subnets and ranges.
+package netaddr
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+)
+
+// maxSplit is the maximum number of bits by which Split
+// lengthens a prefix, limiting it to about a million subnets.
+const maxSplit = 20
+
+var (
+	errPrefixLen = errors.New("netaddr: invalid prefix length")
+	errTooMany   = errors.New("netaddr: too many subnets")
+	errRange     = errors.New("netaddr: invalid range")
+)
+
+// An IPRange is an inclusive range of IP addresses of the same family.
+type IPRange struct {
+	First net.IP
+	Last  net.IP
+}
+
+// RangeOf returns the range of addresses within n.
+func RangeOf(n *net.IPNet) IPRange {
+	ip, ones, bits := prefix(n)
+	if ip == nil {
+		return IPRange{}
+	}
+	return IPRange{First: ip, Last: lastIP(ip, ones, bits)}
+}
+
+// ParseRange parses s as an IP address range of the form
+// "192.0.2.1-192.0.2.9" or a CIDR subnet of the form "192.0.2.0/24".
+func ParseRange(s string) (IPRange, error) {
+	if strings.IndexByte(s, '/') >= 0 {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return IPRange{}, err
+		}
+		return RangeOf(n), nil
+	}
+	i := strings.IndexByte(s, '-')
+	if i < 0 {
+		return IPRange{}, &net.ParseError{Type: "IP range", Text: s}
+	}
+	r := IPRange{First: net.ParseIP(s[:i]), Last: net.ParseIP(s[i+1:])}
+	if !r.Valid() {
+		return IPRange{}, &net.ParseError{Type: "IP range", Text: s}
+	}
+	return r, nil
+}
+
+// Valid reports whether r's addresses are of the same family
+// and its first address isn't after its last.
+func (r IPRange) Valid() bool {
+	first, last := norm(r.First), norm(r.Last)
+	return first != nil && len(first) == len(last) && bytes.Compare(first, last) <= 0
+}
+
+// Contains reports whether r contains ip.
+func (r IPRange) Contains(ip net.IP) bool {
+	first, last, x := norm(r.First), norm(r.Last), norm(ip)
+	if x == nil || len(x) != len(first) || len(x) != len(last) {
+		return false
+	}
+	return bytes.Compare(first, x) <= 0 && bytes.Compare(x, last) <= 0
+}
+
+// Prefixes returns the smallest list of subnets that exactly
+// covers r, in order, or nil if r isn't valid.
+func (r IPRange) Prefixes() []*net.IPNet {
+	if !r.Valid() {
+		return nil
+	}
+	first, last := clone(norm(r.First)), norm(r.Last)
+	bits := len(first) * 8
+	var nets []*net.IPNet
+	for {
+		// Find the largest subnet starting at first within r.
+		ones := bits
+		for ones > 0 && bit(first, ones-1) == 0 && bytes.Compare(lastIP(first, ones-1, bits), last) <= 0 {
+			ones--
+		}
+		nets = append(nets, &net.IPNet{IP: clone(first), Mask: net.CIDRMask(ones, bits)})
+		end := lastIP(first, ones, bits)
+		if bytes.Equal(end, last) {
+			return nets
+		}
+		first = end
+		addBit(first, bits-1)
+	}
+}
+
+// String returns the string form of r, such as "192.0.2.1-192.0.2.9".
+func (r IPRange) String() string {
+	return r.First.String() + "-" + r.Last.String()
+}
+
+// ContainsAny reports whether any of nets contains ip.
+func ContainsAny(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Split returns the subnets of n with the prefix length ones, in order.
+// For example, splitting 192.0.2.0/24 to 26 returns its four quarters.
+// It returns an error if ones is shorter than n's prefix length, longer
+// than its address length, or would result in too many subnets.
+func Split(n *net.IPNet, ones int) ([]*net.IPNet, error) {
+	ip, nOnes, bits := prefix(n)
+	if ip == nil || ones < nOnes || ones > bits {
+		return nil, errPrefixLen
+	}
+	if ones-nOnes > maxSplit {
+		return nil, errTooMany
+	}
+	mask := net.CIDRMask(ones, bits)
+	nets := make([]*net.IPNet, 1<<uint(ones-nOnes))
+	for i := range nets {
+		nets[i] = &net.IPNet{IP: clone(ip), Mask: mask}
+		if ones > 0 {
+			addBit(ip, ones-1)
+		}
+	}
+	return nets, nil
+}
+
+// Summarize returns the smallest list of subnets that covers exactly
+// the addresses within nets, merging those that overlap or are adjacent.
+// The IPv4 subnets come first and each family's subnets are in order.
+func Summarize(nets ...*net.IPNet) []*net.IPNet {
+	return NewIPSet(nets...).Prefixes()
+}
+
+// prefix returns n's masked address in its normalized form,
+// its prefix length, and its address length in bits.
+// It returns a nil address if n isn't a valid subnet.
+func prefix(n *net.IPNet) (ip net.IP, ones, bits int) {
+	if n == nil {
+		return nil, 0, 0
+	}
+	ones, bits = n.Mask.Size()
+	switch bits {
+	case 8 * net.IPv4len:
+		ip = n.IP.To4()
+	case 8 * net.IPv6len:
+		ip = n.IP.To16()
+	}
+	if ip == nil {
+		return nil, 0, 0
+	}
+	return ip.Mask(net.CIDRMask(ones, bits)), ones, bits
+}
+
+// norm returns ip as 4 bytes if it's an IPv4 address,
+// including an IPv4-mapped IPv6 address, or else as 16 bytes.
+func norm(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip.To16()
+}
+
+func clone(ip net.IP) net.IP {
+	return append(net.IP(nil), ip...)
+}
+
+// bit returns the bit of ip at position i, where 0 is the most significant.
+func bit(ip []byte, i int) int {
+	return int(ip[i/8]>>uint(7-i%8)) & 1
+}
+
+// lastIP returns the last address of the subnet of
+// first with the prefix length ones.
+func lastIP(first net.IP, ones, bits int) net.IP {
+	mask := net.CIDRMask(ones, bits)
+	ip := make(net.IP, len(first))
+	for i := range ip {
+		ip[i] = first[i] | ^mask[i]
+	}
+	return ip
+}
+
+// addBit adds one to ip at bit position i, where 0 is the most
+// significant, and reports whether the addition overflowed.
+func addBit(ip []byte, i int) bool {
+	j := i / 8
+	c := uint(ip[j]) + 1<<uint(7-i%8)
+	ip[j] = byte(c)
+	for c > 0xff {
+		if j--; j < 0 {
+			return true
+		}
+		c = uint(ip[j]) + 1
+		ip[j] = byte(c)
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netaddr
+
+import (
+	"net"
+	"testing"
+)
+
+func parseCIDRs(t *testing.T, cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
+
+func cidrStrings(nets []*net.IPNet) []string {
+	a := make([]string, len(nets))
+	for i, n := range nets {
+		a[i] = n.String()
+	}
+	return a
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIPRange(t *testing.T) {
+	tests := []struct {
+		s        string
+		in, out  []string
+		prefixes []string
+	}{
+		{
+			s:        "192.0.2.0/24",
+			in:       []string{"192.0.2.0", "192.0.2.255", "::ffff:192.0.2.1"},
+			out:      []string{"192.0.1.255", "192.0.3.0", "2001:db8::1"},
+			prefixes: []string{"192.0.2.0/24"},
+		},
+		{
+			s:        "192.0.2.1-192.0.2.9",
+			in:       []string{"192.0.2.1", "192.0.2.9"},
+			out:      []string{"192.0.2.0", "192.0.2.10"},
+			prefixes: []string{"192.0.2.1/32", "192.0.2.2/31", "192.0.2.4/30", "192.0.2.8/31"},
+		},
+		{
+			s:        "0.0.0.0-255.255.255.255",
+			in:       []string{"0.0.0.0", "255.255.255.255"},
+			out:      []string{"::1"},
+			prefixes: []string{"0.0.0.0/0"},
+		},
+		{
+			s:        "2001:db8::-2001:db8::1:0",
+			in:       []string{"2001:db8::", "2001:db8::ffff", "2001:db8::1:0"},
+			out:      []string{"2001:db8::1:1", "192.0.2.1"},
+			prefixes: []string{"2001:db8::/112", "2001:db8::1:0/128"},
+		},
+	}
+	for _, tt := range tests {
+		r, err := ParseRange(tt.s)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.s, err)
+		}
+		for _, s := range tt.in {
+			if !r.Contains(net.ParseIP(s)) {
+				t.Errorf("%s: expected to contain %s", tt.s, s)
+			}
+		}
+		for _, s := range tt.out {
+			if r.Contains(net.ParseIP(s)) {
+				t.Errorf("%s: expected not to contain %s", tt.s, s)
+			}
+		}
+		if got := cidrStrings(r.Prefixes()); !equalStrings(got, tt.prefixes) {
+			t.Errorf("%s: prefixes: expected %v; got %v", tt.s, tt.prefixes, got)
+		}
+	}
+
+	for _, s := range []string{"192.0.2.9-192.0.2.1", "192.0.2.1-2001:db8::1", "192.0.2.1", "x-y"} {
+		if _, err := ParseRange(s); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	n := parseCIDRs(t, "192.0.2.0/24")[0]
+	nets, err := Split(n, 26)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"192.0.2.0/26", "192.0.2.64/26", "192.0.2.128/26", "192.0.2.192/26"}
+	if got := cidrStrings(nets); !equalStrings(got, want) {
+		t.Fatalf("expected %v; got %v", want, got)
+	}
+	if nets, err := Split(n, 24); err != nil || len(nets) != 1 || nets[0].String() != n.String() {
+		t.Fatalf("unexpected result: %v, %v", nets, err)
+	}
+	for _, ones := range []int{23, 33} {
+		if _, err := Split(n, ones); err != errPrefixLen {
+			t.Errorf("split to %d: expected %v; got %v", ones, errPrefixLen, err)
+		}
+	}
+	v6 := parseCIDRs(t, "2001:db8::/32")[0]
+	if _, err := Split(v6, 64); err != errTooMany {
+		t.Errorf("expected %v; got %v", errTooMany, err)
+	}
+	if nets, err := Split(v6, 34); err != nil || len(nets) != 4 || nets[3].String() != "2001:db8:c000::/34" {
+		t.Errorf("unexpected result: %v, %v", nets, err)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	nets := parseCIDRs(t,
+		"2001:db8::/33",
+		"192.0.2.0/25",
+		"192.0.2.128/25",
+		"192.0.3.0/24",
+		"10.1.2.0/24",
+		"10.0.0.0/8",
+		"2001:db8:8000::/33",
+		"198.51.100.7/32",
+	)
+	want := []string{"10.0.0.0/8", "192.0.2.0/23", "198.51.100.7/32", "2001:db8::/32"}
+	if got := cidrStrings(Summarize(nets...)); !equalStrings(got, want) {
+		t.Fatalf("expected %v; got %v", want, got)
+	}
+}
+
+func TestIPSet(t *testing.T) {
+	var b IPSetBuilder
+	for _, n := range parseCIDRs(t, "10.0.0.0/8", "fc00::/7", "192.0.2.21/32") {
+		b.Add(n)
+	}
+	b.AddRange(IPRange{First: net.ParseIP("192.0.2.10"), Last: net.ParseIP("192.0.2.20")})
+	b.AddIP(net.ParseIP("192.0.2.23"))
+	s := b.IPSet()
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.0.0.1", true},
+		{"10.255.255.255", true},
+		{"11.0.0.0", false},
+		{"::ffff:10.0.0.1", true},
+		{"192.0.2.9", false},
+		{"192.0.2.10", true},
+		{"192.0.2.20", true},
+		{"192.0.2.21", true},
+		{"192.0.2.22", false},
+		{"192.0.2.23", true},
+		{"192.0.2.24", false},
+		{"fd00::1", true},
+		{"fe80::1", false},
+	}
+	for _, tt := range tests {
+		ip := net.ParseIP(tt.ip)
+		if got := s.Contains(ip); got != tt.want {
+			t.Errorf("%s: expected %v; got %v", tt.ip, tt.want, got)
+		}
+	}
+	want := []string{
+		"10.0.0.0-10.255.255.255",
+		"192.0.2.10-192.0.2.21",
+		"192.0.2.23-192.0.2.23",
+		"fc00::-fdff:ffff:ffff:ffff:ffff:ffff:ffff:ffff",
+	}
+	var got []string
+	for _, r := range s.Ranges() {
+		got = append(got, r.String())
+	}
+	if !equalStrings(got, want) {
+		t.Errorf("ranges: expected %v; got %v", want, got)
+	}
+
+	if (&IPSet{}).Contains(net.ParseIP("10.0.0.1")) {
+		t.Error("expected empty set not to contain address")
+	}
+	if s.Contains(nil) {
+		t.Error("expected set not to contain nil address")
+	}
+}
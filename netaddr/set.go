@@ -0,0 +1,169 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netaddr
+
+import (
+	"bytes"
+	"net"
+	"sort"
+)
+
+// An IPSet is an immutable set of IP addresses, such as an allow or
+// deny list. It's stored as sorted, disjoint ranges of addresses, so
+// membership is checked in time logarithmic in the number of ranges
+// rather than linear in the number of subnets it was built from.
+// Its methods are safe for concurrent use.
+type IPSet struct {
+	v4, v6 []ipRange
+}
+
+// An ipRange is an inclusive range of normalized addresses.
+type ipRange struct {
+	first, last net.IP
+}
+
+// NewIPSet returns a set of the addresses within nets.
+func NewIPSet(nets ...*net.IPNet) *IPSet {
+	var b IPSetBuilder
+	for _, n := range nets {
+		b.Add(n)
+	}
+	return b.IPSet()
+}
+
+// Contains reports whether s contains ip.
+func (s *IPSet) Contains(ip net.IP) bool {
+	rs := s.v6
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, rs = ip4, s.v4
+	} else if ip = ip.To16(); ip == nil {
+		return false
+	}
+	i := sort.Search(len(rs), func(i int) bool {
+		return bytes.Compare(rs[i].last, ip) >= 0
+	})
+	return i < len(rs) && bytes.Compare(rs[i].first, ip) <= 0
+}
+
+// Ranges returns the smallest list of ranges that covers exactly
+// the addresses in s. The IPv4 ranges come first and each family's
+// ranges are in order.
+func (s *IPSet) Ranges() []IPRange {
+	a := make([]IPRange, 0, len(s.v4)+len(s.v6))
+	for _, rs := range [][]ipRange{s.v4, s.v6} {
+		for _, r := range rs {
+			a = append(a, IPRange{First: clone(r.first), Last: clone(r.last)})
+		}
+	}
+	return a
+}
+
+// Prefixes returns the smallest list of subnets that covers exactly
+// the addresses in s. The IPv4 subnets come first and each family's
+// subnets are in order.
+func (s *IPSet) Prefixes() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, r := range s.Ranges() {
+		nets = append(nets, r.Prefixes()...)
+	}
+	return nets
+}
+
+// An IPSetBuilder builds an IPSet from subnets, addresses, and ranges.
+// It's stored as a binary trie of prefixes, in which overlapping and
+// adjacent subnets are merged. The zero value is ready to use.
+type IPSetBuilder struct {
+	v4, v6 *node
+}
+
+// A node is a prefix in an IPSetBuilder's trie.
+type node struct {
+	child [2]*node
+	full  bool // all addresses with the prefix are in the set
+}
+
+// Add adds the addresses within n to the set.
+// It does nothing if n isn't a valid subnet.
+func (b *IPSetBuilder) Add(n *net.IPNet) {
+	ip, ones, bits := prefix(n)
+	switch {
+	case ip == nil:
+	case bits == 8*net.IPv4len:
+		b.v4 = b.v4.insert(ip, ones, 0)
+	default:
+		b.v6 = b.v6.insert(ip, ones, 0)
+	}
+}
+
+// AddIP adds ip to the set.
+// It does nothing if ip isn't a valid address.
+func (b *IPSetBuilder) AddIP(ip net.IP) {
+	if ip = norm(ip); ip != nil {
+		bits := len(ip) * 8
+		b.Add(&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+}
+
+// AddRange adds the addresses within r to the set.
+// It does nothing if r isn't valid.
+func (b *IPSetBuilder) AddRange(r IPRange) {
+	for _, n := range r.Prefixes() {
+		b.Add(n)
+	}
+}
+
+// IPSet returns the set of the addresses added so far.
+// The builder may continue to be used afterward.
+func (b *IPSetBuilder) IPSet() *IPSet {
+	return &IPSet{
+		v4: b.v4.ranges(nil, make(net.IP, net.IPv4len), 0),
+		v6: b.v6.ranges(nil, make(net.IP, net.IPv6len), 0),
+	}
+}
+
+// insert adds the prefix of ip with length ones to the trie rooted
+// at x, which is at depth i, and returns the trie's new root.
+func (x *node) insert(ip net.IP, ones, i int) *node {
+	if x == nil {
+		x = &node{}
+	}
+	if x.full {
+		return x
+	}
+	if i == ones {
+		return &node{full: true}
+	}
+	b := bit(ip, i)
+	x.child[b] = x.child[b].insert(ip, ones, i+1)
+	if l, r := x.child[0], x.child[1]; l != nil && l.full && r != nil && r.full {
+		return &node{full: true}
+	}
+	return x
+}
+
+// ranges appends the ranges of the trie rooted at x, whose prefix
+// of length i is in ip, to rs, merging those that are adjacent.
+func (x *node) ranges(rs []ipRange, ip net.IP, i int) []ipRange {
+	if x == nil {
+		return rs
+	}
+	if x.full {
+		bits := len(ip) * 8
+		first, last := clone(ip), lastIP(ip, i, bits)
+		if n := len(rs); n > 0 {
+			next := clone(rs[n-1].last)
+			if !addBit(next, bits-1) && bytes.Equal(next, first) {
+				rs[n-1].last = last
+				return rs
+			}
+		}
+		return append(rs, ipRange{first, last})
+	}
+	rs = x.child[0].ranges(rs, ip, i+1)
+	ip[i/8] |= 1 << uint(7-i%8)
+	rs = x.child[1].ranges(rs, ip, i+1)
+	ip[i/8] &^= 1 << uint(7-i%8)
+	return rs
+}
@@ -0,0 +1,159 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// interfaceState returns a description of the system's network
+// interfaces and their addresses that changes when they change.
+// It's a variable for testing.
+var interfaceState = func() (string, error) {
+	ifs, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, ifi := range ifs {
+		b.WriteString(ifi.Name)
+		b.WriteByte(' ')
+		b.WriteString(ifi.Flags.String())
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			return "", err
+		}
+		for _, addr := range addrs {
+			b.WriteByte(' ')
+			b.WriteString(addr.String())
+		}
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// A Monitor watches the system's network interfaces and addresses
+// for changes, such as a VPN being brought up or down. When they
+// change, it probes the IP stack again, as by Reprobe, and calls its
+// subscribers. For example, a CacheResolver's entries can be
+// invalidated when the network changes:
+//
+//	m := nett.NewMonitor(0)
+//	m.Subscribe(resolver.InvalidateAll)
+//
+// A CacheResolver created with the WithMonitor option is subscribed
+// in the same way.
+//
+// Changes are noticed as they happen on Linux, using netlink, and
+// on BSD and macOS, using routing sockets. The interfaces are also
+// polled, which is the only way changes are noticed elsewhere.
+//
+// Its methods are safe for concurrent use.
+type Monitor struct {
+	interval time.Duration
+	changed  chan struct{}
+	done     chan struct{} // closed by Close
+	stopped  chan struct{} // closed when run returns
+	once     sync.Once
+
+	mu    sync.Mutex
+	subs  map[int]func()
+	next  int
+	state string
+}
+
+// NewMonitor returns a Monitor that polls the interfaces every
+// interval. If interval is zero, they're polled every 30s.
+// The Monitor must be closed when it's no longer needed.
+func NewMonitor(interval time.Duration) *Monitor {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	m := &Monitor{
+		interval: interval,
+		changed:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		subs:     make(map[int]func()),
+	}
+	m.state, _ = interfaceState()
+	watchInterfaces(m.changed, m.done)
+	go m.run()
+	return m
+}
+
+// Subscribe arranges for f to be called when the interfaces or
+// their addresses change. It returns a function that cancels the
+// subscription. The calls are made sequentially by the Monitor.
+func (m *Monitor) Subscribe(f func()) (cancel func()) {
+	m.mu.Lock()
+	id := m.next
+	m.next++
+	m.subs[id] = f
+	m.mu.Unlock()
+	return func() {
+		m.mu.Lock()
+		delete(m.subs, id)
+		m.mu.Unlock()
+	}
+}
+
+// Close stops the Monitor. It waits for any calls to the subscribers
+// to return, after which there are no more, so it must not be called
+// by a subscriber.
+func (m *Monitor) Close() error {
+	m.once.Do(func() { close(m.done) })
+	<-m.stopped
+	return nil
+}
+
+func (m *Monitor) run() {
+	defer close(m.stopped)
+	t := time.NewTicker(m.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-m.changed:
+		case <-t.C:
+		}
+		m.check()
+	}
+}
+
+// check calls the subscribers if the interfaces have changed.
+func (m *Monitor) check() {
+	state, err := interfaceState()
+	if err != nil {
+		return
+	}
+	m.mu.Lock()
+	if state == m.state {
+		m.mu.Unlock()
+		return
+	}
+	m.state = state
+	subs := make([]func(), 0, len(m.subs))
+	for _, f := range m.subs {
+		subs = append(subs, f)
+	}
+	m.mu.Unlock()
+	Reprobe()
+	for _, f := range subs {
+		f()
+	}
+}
+
+// notify signals a possible change without blocking.
+func notify(changed chan<- struct{}) {
+	select {
+	case changed <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,11 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package nett
+
+// Changes to the interfaces aren't reported on this platform,
+// so they're only noticed by polling.
+func watchInterfaces(changed chan<- struct{}, done <-chan struct{}) {}
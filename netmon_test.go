@@ -0,0 +1,117 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMonitor(t *testing.T) {
+	defer func(fn func() (string, error)) { interfaceState = fn }(interfaceState)
+	var (
+		mu    sync.Mutex
+		state = "eth0 up 192.0.2.1/24\n"
+	)
+	interfaceState = func() (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return state, nil
+	}
+
+	m := NewMonitor(5 * time.Millisecond)
+	defer m.Close()
+	calls := make(chan struct{}, 10)
+	m.Subscribe(func() { calls <- struct{}{} })
+	cancel := m.Subscribe(func() { t.Error("unexpected call after cancel") })
+	cancel()
+
+	// Nothing has changed.
+	select {
+	case <-calls:
+		t.Fatal("unexpected call without a change")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	mu.Lock()
+	state = "eth0 up 192.0.2.2/24\n"
+	mu.Unlock()
+	select {
+	case <-calls:
+	case <-time.After(time.Second):
+		t.Fatal("expected call after a change")
+	}
+}
+
+func TestMonitorClose(t *testing.T) {
+	defer func(fn func() (string, error)) { interfaceState = fn }(interfaceState)
+	var (
+		mu    sync.Mutex
+		state int
+	)
+	interfaceState = func() (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		state++ // always changed
+		return string(rune('a' + state%26)), nil
+	}
+
+	m := NewMonitor(time.Millisecond)
+	var closed bool
+	m.Subscribe(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			t.Error("unexpected call after Close")
+		}
+	})
+	time.Sleep(10 * time.Millisecond)
+	m.Close()
+	mu.Lock()
+	closed = true
+	mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+}
+
+func TestWithMonitor(t *testing.T) {
+	defer func(fn func() (string, error)) { interfaceState = fn }(interfaceState)
+	var (
+		mu    sync.Mutex
+		state = "eth0 up 192.0.2.1/24\n"
+	)
+	interfaceState = func() (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return state, nil
+	}
+
+	m := NewMonitor(time.Millisecond)
+	defer m.Close()
+	r, err := NewCacheResolver(WithMonitor(m), WithResolver(bootstrapResolver{net.IPv4(192, 0, 2, 1)}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r.Set("foo.com", []net.IP{net.IPv4(192, 0, 2, 2)}, time.Hour)
+
+	mu.Lock()
+	state = "eth0 up 192.0.2.2/24\n"
+	mu.Unlock()
+	deadline := time.Now().Add(time.Second)
+	for {
+		ips, err := r.Resolve("foo.com")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ips[0].Equal(net.IPv4(192, 0, 2, 1)) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected hosts to be invalidated after a change")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package nett
+
+import "syscall"
+
+// watchInterfaces signals changed when the system reports a change
+// to its interfaces or addresses until done is closed. If the
+// reports can't be watched, only polling notices changes.
+func watchInterfaces(changed chan<- struct{}, done <-chan struct{}) {
+	fd, err := openWatchSocket()
+	if err != nil {
+		return
+	}
+	// Time out reads so that done is noticed.
+	tv := syscall.Timeval{Sec: 1}
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return
+	}
+	go func() {
+		defer syscall.Close(fd)
+		buf := make([]byte, 1<<16)
+		for {
+			n, err := syscall.Read(fd, buf)
+			select {
+			case <-done:
+				return
+			default:
+			}
+			switch {
+			case err == nil && n > 0:
+				notify(changed)
+			case err == syscall.EAGAIN || err == syscall.EINTR:
+			case err == syscall.ENOBUFS:
+				// Messages were dropped, so assume a change.
+				notify(changed)
+			default:
+				return
+			}
+		}
+	}()
+}
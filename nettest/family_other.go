@@ -0,0 +1,14 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package nettest
+
+// isIPv6Socket reports whether c's socket is of the IPv6 family.
+// The second result reports whether the family could be inspected,
+// which it can't be on this platform.
+func isIPv6Socket(c interface{}) (v6, ok bool) {
+	return false, false
+}
@@ -0,0 +1,36 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package nettest
+
+import "syscall"
+
+// isIPv6Socket reports whether c's socket is of the IPv6 family.
+// The second result reports whether the family could be inspected.
+func isIPv6Socket(c interface{}) (v6, ok bool) {
+	sc, ok := c.(syscall.Conn)
+	if !ok {
+		return false, false
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return false, false
+	}
+	var sa syscall.Sockaddr
+	err = rc.Control(func(fd uintptr) {
+		sa, err = syscall.Getsockname(int(fd))
+	})
+	if err != nil {
+		return false, false
+	}
+	switch sa.(type) {
+	case *syscall.SockaddrInet4:
+		return false, true
+	case *syscall.SockaddrInet6:
+		return true, true
+	}
+	return false, false
+}
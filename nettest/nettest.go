@@ -0,0 +1,214 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package nettest provides utilities for testing dialers
+// against real sockets.
+package nettest
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// A StreamListener describes a listener of a DualStackServer.
+type StreamListener struct {
+	Net, Addr string
+	ln        net.Listener
+}
+
+// A DualStackServer listens on the same port of several
+// stream networks, such as "tcp4" and "tcp6".
+type DualStackServer struct {
+	lnmu sync.Mutex
+	lns  []StreamListener
+	port string
+
+	cmu sync.Mutex
+	cs  []net.Conn // established connections at the passive open side
+}
+
+// NewDualStackServer returns a server listening on an ephemeral
+// port shared by each of the listeners.
+func NewDualStackServer(lns []StreamListener) (*DualStackServer, error) {
+	dss := &DualStackServer{lns: make([]StreamListener, len(lns)), port: "0"}
+	copy(dss.lns, lns)
+	for i := range dss.lns {
+		ln, err := net.Listen(dss.lns[i].Net, net.JoinHostPort(dss.lns[i].Addr, dss.port))
+		if err != nil {
+			dss.Teardown()
+			return nil, err
+		}
+		dss.lns[i].ln = ln
+		if dss.port == "0" {
+			if dss.port, err = Port(ln.Addr()); err != nil {
+				dss.Teardown()
+				return nil, err
+			}
+		}
+	}
+	return dss, nil
+}
+
+// Port returns the port shared by the server's listeners.
+func (dss *DualStackServer) Port() string { return dss.port }
+
+// Len returns the number of the server's listeners.
+func (dss *DualStackServer) Len() int { return len(dss.lns) }
+
+// Buildup starts a goroutine running server for each of the listeners.
+func (dss *DualStackServer) Buildup(server func(*DualStackServer, net.Listener)) {
+	for i := range dss.lns {
+		go server(dss, dss.lns[i].ln)
+	}
+}
+
+// PutConn registers an accepted connection to be closed on Teardown.
+func (dss *DualStackServer) PutConn(c net.Conn) {
+	dss.cmu.Lock()
+	dss.cs = append(dss.cs, c)
+	dss.cmu.Unlock()
+}
+
+// TeardownNetwork closes the listeners of the named network.
+func (dss *DualStackServer) TeardownNetwork(network string) {
+	dss.lnmu.Lock()
+	for i := range dss.lns {
+		if network == dss.lns[i].Net && dss.lns[i].ln != nil {
+			dss.lns[i].ln.Close()
+			dss.lns[i].ln = nil
+		}
+	}
+	dss.lnmu.Unlock()
+}
+
+// Teardown closes all of the listeners and registered connections.
+func (dss *DualStackServer) Teardown() {
+	dss.lnmu.Lock()
+	for i := range dss.lns {
+		if dss.lns[i].ln != nil {
+			dss.lns[i].ln.Close()
+		}
+	}
+	dss.lnmu.Unlock()
+	dss.cmu.Lock()
+	for _, c := range dss.cs {
+		c.Close()
+	}
+	dss.cmu.Unlock()
+}
+
+// TouchServer accepts connections from ln and immediately closes them.
+func TouchServer(dss *DualStackServer, ln net.Listener) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		c.Close()
+	}
+}
+
+// EchoServer accepts connections from ln and writes back
+// everything that is read from them.
+func EchoServer(dss *DualStackServer, ln net.Listener) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		dss.PutConn(c)
+		go func(c net.Conn) {
+			buf := make([]byte, 512)
+			for {
+				n, err := c.Read(buf)
+				if n > 0 {
+					if _, err := c.Write(buf[:n]); err != nil {
+						return
+					}
+				}
+				if err != nil {
+					return
+				}
+			}
+		}(c)
+	}
+}
+
+// NewLocalListener returns a listener on an ephemeral port of
+// the loopback address of the named network: "tcp", "tcp4",
+// or "tcp6".
+func NewLocalListener(network string) (net.Listener, error) {
+	switch network {
+	case "tcp":
+		if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err == nil {
+			return ln, nil
+		}
+		return net.Listen("tcp6", "[::1]:0")
+	case "tcp4":
+		return net.Listen("tcp4", "127.0.0.1:0")
+	case "tcp6":
+		return net.Listen("tcp6", "[::1]:0")
+	}
+	return nil, net.UnknownNetworkError(network)
+}
+
+// Port returns the port of a TCP or UDP address.
+func Port(addr net.Addr) (string, error) {
+	_, port, err := net.SplitHostPort(addr.String())
+	return port, err
+}
+
+// ErrUnexpectedAddr is returned by ConnNetwork when the connection's
+// local address is not a TCP or UDP address.
+var ErrUnexpectedAddr = errors.New("unexpected address type")
+
+// ConnNetwork returns the address family specific network of c's
+// local socket, such as "tcp4" or "udp6". An IPv4-mapped address
+// of an IPv6 socket is reported as IPv6 where the socket's family
+// can be inspected.
+func ConnNetwork(c net.Conn) (string, error) {
+	var (
+		network string
+		ip      net.IP
+	)
+	switch addr := c.LocalAddr().(type) {
+	case *net.TCPAddr:
+		network, ip = "tcp", addr.IP
+	case *net.UDPAddr:
+		network, ip = "udp", addr.IP
+	default:
+		return "", ErrUnexpectedAddr
+	}
+	if v6, ok := isIPv6Socket(c); ok {
+		if v6 {
+			return network + "6", nil
+		}
+		return network + "4", nil
+	}
+	if ip.To4() != nil {
+		return network + "4", nil
+	}
+	return network + "6", nil
+}
+
+// CheckEcho writes msg to c and verifies that it is read back,
+// as when c is connected to an EchoServer.
+func CheckEcho(c net.Conn, msg []byte) error {
+	if _, err := c.Write(msg); err != nil {
+		return err
+	}
+	buf := make([]byte, len(msg))
+	for n := 0; n < len(buf); {
+		m, err := c.Read(buf[n:])
+		n += m
+		if err != nil && n < len(buf) {
+			return err
+		}
+	}
+	if string(buf) != string(msg) {
+		return errors.New("echo mismatch")
+	}
+	return nil
+}
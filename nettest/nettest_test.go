@@ -0,0 +1,85 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nettest
+
+import (
+	"net"
+	"testing"
+)
+
+func TestDualStackServer(t *testing.T) {
+	lns := []StreamListener{
+		{Net: "tcp4", Addr: "127.0.0.1"},
+		{Net: "tcp6", Addr: "::1"},
+	}
+	dss, err := NewDualStackServer(lns)
+	if err != nil {
+		t.Skipf("NewDualStackServer failed: %v", err)
+	}
+	defer dss.Teardown()
+	for _, ln := range lns {
+		if ln.ln != nil {
+			t.Fatal("caller's listeners were modified")
+		}
+	}
+	dss.Buildup(EchoServer)
+
+	for _, ln := range lns {
+		c, err := net.Dial(ln.Net, net.JoinHostPort(ln.Addr, dss.Port()))
+		if err != nil {
+			t.Fatalf("Dial %s failed: %v", ln.Net, err)
+		}
+		if network, err := ConnNetwork(c); err != nil || network != ln.Net {
+			t.Errorf("ConnNetwork: expected %s; got %q, %v", ln.Net, network, err)
+		}
+		if err := CheckEcho(c, []byte("hello")); err != nil {
+			t.Errorf("CheckEcho %s failed: %v", ln.Net, err)
+		}
+		c.Close()
+	}
+
+	dss.TeardownNetwork("tcp6")
+	if c, err := net.Dial("tcp6", net.JoinHostPort("::1", dss.Port())); err == nil {
+		c.Close()
+		t.Error("Dial tcp6: expected error after TeardownNetwork")
+	}
+	c, err := net.Dial("tcp4", net.JoinHostPort("127.0.0.1", dss.Port()))
+	if err != nil {
+		t.Fatalf("Dial tcp4 failed: %v", err)
+	}
+	c.Close()
+}
+
+func TestConnNetworkMapped(t *testing.T) {
+	ln, err := net.Listen("tcp", "[::]:0")
+	if err != nil {
+		t.Skipf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+	port, err := Port(ln.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := net.Dial("tcp4", "127.0.0.1:"+port)
+	if err != nil {
+		t.Skipf("Dial failed: %v", err)
+	}
+	defer c.Close()
+	// The accepted conn has an IPv4-mapped address on an IPv6 socket.
+	sc, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	defer sc.Close()
+	if _, ok := isIPv6Socket(sc); !ok {
+		t.Skip("socket family can't be inspected")
+	}
+	if network, err := ConnNetwork(sc); err != nil || network != "tcp6" {
+		t.Errorf("ConnNetwork: expected tcp6; got %q, %v", network, err)
+	}
+	if network, err := ConnNetwork(c); err != nil || network != "tcp4" {
+		t.Errorf("ConnNetwork: expected tcp4; got %q, %v", network, err)
+	}
+}
@@ -0,0 +1,670 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// An Option configures a Dialer or a CacheResolver
+// created by New, NewDialer or NewCacheResolver.
+type Option func(*options) error
+
+// An OptionError reports an invalid Option.
+type OptionError struct {
+	Option string
+	Err    string
+}
+
+func (e *OptionError) Error() string { return e.Option + ": " + e.Err }
+
+type options struct {
+	dialer     *Dialer
+	dialerOpts []string // names of options that only apply to a Dialer
+
+	resolver   Resolver
+	search     *SearchResolver
+	ttl        time.Duration
+	negTTL     time.Duration
+	maxEntries int
+	monitor    *Monitor
+	cacheOpts  []string // names of options that only apply to a CacheResolver
+
+	defaults bool // options override the defaults of New
+}
+
+func (o *options) apply(opts []Option) error {
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return err
+		}
+	}
+	if o.search != nil {
+		o.search.Resolver = o.resolver
+		o.resolver = o.search
+	}
+	return nil
+}
+
+// NewDialer returns a Dialer configured by opts.
+// It returns an error if an option is invalid or conflicts
+// with another option.
+//
+// If WithTTL or WithMaxEntries is given, the Dialer's Resolver is
+// a CacheResolver configured by them which resolves hosts that are
+// not cached with the Resolver given by WithResolver.
+func NewDialer(opts ...Option) (*Dialer, error) {
+	return newDialer(options{dialer: new(Dialer)}, opts)
+}
+
+// The defaults of Dialers returned by New and DefaultDialer.
+const (
+	defaultTimeout   = 30 * time.Second
+	defaultKeepAlive = 30 * time.Second
+	defaultTTL       = time.Minute
+)
+
+// New returns a Dialer with production-ready defaults, as returned
+// by DefaultDialer, that are overridden by opts. It returns an error
+// if an option is invalid or conflicts with another option.
+//
+// WithDeadline overrides the default timeout. WithResolver given
+// a CacheResolver overrides the default caching resolver.
+func New(opts ...Option) (*Dialer, error) {
+	o := options{
+		dialer: &Dialer{
+			Timeout:      defaultTimeout,
+			KeepAlive:    defaultKeepAlive,
+			DialStrategy: HappyEyeballs,
+		},
+		ttl:      defaultTTL,
+		defaults: true,
+	}
+	return newDialer(o, opts)
+}
+
+// DefaultDialer returns a Dialer with production-ready defaults:
+// a 30s timeout, 30s keep-alives, the HappyEyeballs strategy, and
+// a CacheResolver with a 1m TTL.
+func DefaultDialer() *Dialer {
+	d, err := New()
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func newDialer(o options, opts []Option) (*Dialer, error) {
+	if err := o.apply(opts); err != nil {
+		return nil, err
+	}
+	d := o.dialer
+	if o.defaults && !d.Deadline.IsZero() && !o.given("WithTimeout") {
+		d.Timeout = 0
+	}
+	if d.Filter != nil && d.IPFilter != nil {
+		return nil, &OptionError{"WithHostFilter", "conflicts with WithFilter"}
+	}
+	d.Resolver = o.resolver
+	_, cached := o.resolver.(*CacheResolver)
+	if len(o.cacheOpts) > 0 {
+		if cached {
+			return nil, &OptionError{o.cacheOpts[0], "resolver is already a CacheResolver"}
+		}
+		d.Resolver = o.cacheResolver()
+	} else if o.defaults && !cached {
+		d.Resolver = o.cacheResolver()
+	}
+	return d, nil
+}
+
+// given reports whether the named Dialer option was given.
+func (o *options) given(name string) bool {
+	for _, opt := range o.dialerOpts {
+		if opt == name {
+			return true
+		}
+	}
+	return false
+}
+
+// A ContextDialer connects to addresses. It's implemented by *Dialer
+// and by the standard library's *net.Dialer, so code that accepts a
+// ContextDialer doesn't depend on the fields of either.
+type ContextDialer interface {
+	Dial(network, address string) (net.Conn, error)
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// NewCachingDialer returns a ContextDialer configured by opts whose
+// Resolver is a CacheResolver that caches resolved hosts for ttl.
+// The CacheResolver may be further configured by WithNegativeTTL
+// and WithMaxEntries.
+func NewCachingDialer(ttl time.Duration, opts ...Option) (ContextDialer, error) {
+	d, err := NewDialer(append(opts[:len(opts):len(opts)], WithTTL(ttl))...)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// NewCacheResolver returns a CacheResolver configured by opts.
+// It returns an error if given an option that only applies to
+// a Dialer.
+func NewCacheResolver(opts ...Option) (*CacheResolver, error) {
+	o := options{dialer: new(Dialer)}
+	if err := o.apply(opts); err != nil {
+		return nil, err
+	}
+	if len(o.dialerOpts) > 0 {
+		return nil, &OptionError{o.dialerOpts[0], "not applicable to a CacheResolver"}
+	}
+	return o.cacheResolver(), nil
+}
+
+func (o *options) cacheResolver() *CacheResolver {
+	r := &CacheResolver{
+		Resolver:    o.resolver,
+		TTL:         o.ttl,
+		NegativeTTL: o.negTTL,
+		MaxEntries:  o.maxEntries,
+	}
+	if o.monitor != nil {
+		o.monitor.Subscribe(r.InvalidateAll)
+	}
+	return r
+}
+
+// WithTimeout sets the Dialer's Timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) error {
+		if timeout < 0 {
+			return &OptionError{"WithTimeout", "negative duration"}
+		}
+		o.dialer.Timeout = timeout
+		o.dialerOpts = append(o.dialerOpts, "WithTimeout")
+		return nil
+	}
+}
+
+// WithResolveTimeout sets the Dialer's ResolveTimeout.
+func WithResolveTimeout(timeout time.Duration) Option {
+	return func(o *options) error {
+		if timeout < 0 {
+			return &OptionError{"WithResolveTimeout", "negative duration"}
+		}
+		o.dialer.ResolveTimeout = timeout
+		o.dialerOpts = append(o.dialerOpts, "WithResolveTimeout")
+		return nil
+	}
+}
+
+// WithAddrTimeout sets the Dialer's AddrTimeout.
+func WithAddrTimeout(timeout time.Duration) Option {
+	return func(o *options) error {
+		if timeout < 0 {
+			return &OptionError{"WithAddrTimeout", "negative duration"}
+		}
+		o.dialer.AddrTimeout = timeout
+		o.dialerOpts = append(o.dialerOpts, "WithAddrTimeout")
+		return nil
+	}
+}
+
+// WithDeadline sets the Dialer's Deadline.
+func WithDeadline(deadline time.Time) Option {
+	return func(o *options) error {
+		o.dialer.Deadline = deadline
+		o.dialerOpts = append(o.dialerOpts, "WithDeadline")
+		return nil
+	}
+}
+
+// WithLocalAddr sets the Dialer's LocalAddr.
+func WithLocalAddr(addr net.Addr) Option {
+	return func(o *options) error {
+		o.dialer.LocalAddr = addr
+		o.dialerOpts = append(o.dialerOpts, "WithLocalAddr")
+		return nil
+	}
+}
+
+// WithResolver sets the Resolver of a Dialer, or the Resolver
+// used by a CacheResolver to resolve hosts that are not cached.
+func WithResolver(resolver Resolver) Option {
+	return func(o *options) error {
+		if resolver == nil {
+			return &OptionError{"WithResolver", "nil resolver"}
+		}
+		o.resolver = resolver
+		return nil
+	}
+}
+
+// WithSearchDomains resolves short host names with a SearchResolver
+// that appends the given search domains to them, wrapping the
+// Resolver given by WithResolver. If no domains are given, the
+// search domains of /etc/resolv.conf are used.
+func WithSearchDomains(domains ...string) Option {
+	return func(o *options) error {
+		o.search = &SearchResolver{Domains: domains}
+		return nil
+	}
+}
+
+// WithFilter sets the Dialer's IPFilter. It conflicts with
+// WithHostFilter; a filter that ignores the network and host
+// can be given to either.
+func WithFilter(filter func(ips []net.IP) []net.IP) Option {
+	return func(o *options) error {
+		if filter == nil {
+			return &OptionError{"WithFilter", "nil filter"}
+		}
+		o.dialer.IPFilter = filter
+		o.dialerOpts = append(o.dialerOpts, "WithFilter")
+		return nil
+	}
+}
+
+// WithPublicOnly sets the Dialer's PublicOnly.
+func WithPublicOnly(publicOnly bool) Option {
+	return func(o *options) error {
+		o.dialer.PublicOnly = publicOnly
+		o.dialerOpts = append(o.dialerOpts, "WithPublicOnly")
+		return nil
+	}
+}
+
+// WithHostFilter sets the Dialer's Filter.
+// It conflicts with WithFilter.
+func WithHostFilter(filter Filter) Option {
+	return func(o *options) error {
+		if filter == nil {
+			return &OptionError{"WithHostFilter", "nil filter"}
+		}
+		o.dialer.Filter = filter
+		o.dialerOpts = append(o.dialerOpts, "WithHostFilter")
+		return nil
+	}
+}
+
+// WithPreference sets the Dialer's Preference.
+func WithPreference(pref Preference) Option {
+	return func(o *options) error {
+		switch pref {
+		case PreferIPv4, PreferIPv6, PreferSystem:
+		default:
+			return &OptionError{"WithPreference", "unknown preference"}
+		}
+		o.dialer.Preference = pref
+		o.dialerOpts = append(o.dialerOpts, "WithPreference")
+		return nil
+	}
+}
+
+// WithDialStrategy sets the Dialer's DialStrategy.
+func WithDialStrategy(strategy DialStrategy) Option {
+	return func(o *options) error {
+		switch strategy {
+		case Race, Sequential, HappyEyeballs:
+		default:
+			return &OptionError{"WithDialStrategy", "unknown strategy"}
+		}
+		o.dialer.DialStrategy = strategy
+		o.dialerOpts = append(o.dialerOpts, "WithDialStrategy")
+		return nil
+	}
+}
+
+// WithFallbackDelay sets the Dialer's FallbackDelay.
+func WithFallbackDelay(delay time.Duration) Option {
+	return func(o *options) error {
+		if delay < 0 {
+			return &OptionError{"WithFallbackDelay", "negative duration"}
+		}
+		o.dialer.FallbackDelay = delay
+		o.dialerOpts = append(o.dialerOpts, "WithFallbackDelay")
+		return nil
+	}
+}
+
+// WithCancelGracePeriod sets the Dialer's CancelGracePeriod.
+func WithCancelGracePeriod(grace time.Duration) Option {
+	return func(o *options) error {
+		if grace < 0 {
+			return &OptionError{"WithCancelGracePeriod", "negative duration"}
+		}
+		o.dialer.CancelGracePeriod = grace
+		o.dialerOpts = append(o.dialerOpts, "WithCancelGracePeriod")
+		return nil
+	}
+}
+
+// WithProxy sets the Dialer's Proxy.
+func WithProxy(proxy func(network, address string) (*url.URL, error)) Option {
+	return func(o *options) error {
+		o.dialer.Proxy = proxy
+		o.dialerOpts = append(o.dialerOpts, "WithProxy")
+		return nil
+	}
+}
+
+// WithLimiter sets the Dialer's Limiter.
+func WithLimiter(limiter Limiter) Option {
+	return func(o *options) error {
+		o.dialer.Limiter = limiter
+		o.dialerOpts = append(o.dialerOpts, "WithLimiter")
+		return nil
+	}
+}
+
+// WithHostLimiter sets the Dialer's HostLimiter.
+func WithHostLimiter(limiter func(host string) Limiter) Option {
+	return func(o *options) error {
+		o.dialer.HostLimiter = limiter
+		o.dialerOpts = append(o.dialerOpts, "WithHostLimiter")
+		return nil
+	}
+}
+
+// WithMaxConcurrentDials sets the Dialer's MaxConcurrentDials
+// and MaxConcurrentDialsPerHost.
+func WithMaxConcurrentDials(max, perHost int) Option {
+	return func(o *options) error {
+		if max < 0 || perHost < 0 {
+			return &OptionError{"WithMaxConcurrentDials", "negative limit"}
+		}
+		o.dialer.MaxConcurrentDials = max
+		o.dialer.MaxConcurrentDialsPerHost = perHost
+		o.dialerOpts = append(o.dialerOpts, "WithMaxConcurrentDials")
+		return nil
+	}
+}
+
+// WithCircuitBreaker sets the Dialer's CircuitBreaker.
+func WithCircuitBreaker(breaker *CircuitBreaker) Option {
+	return func(o *options) error {
+		o.dialer.CircuitBreaker = breaker
+		o.dialerOpts = append(o.dialerOpts, "WithCircuitBreaker")
+		return nil
+	}
+}
+
+// WithOnDialStart sets the Dialer's OnDialStart.
+func WithOnDialStart(start func(network, address string, attempt int)) Option {
+	return func(o *options) error {
+		o.dialer.OnDialStart = start
+		o.dialerOpts = append(o.dialerOpts, "WithOnDialStart")
+		return nil
+	}
+}
+
+// WithOnDialDone sets the Dialer's OnDialDone.
+func WithOnDialDone(done func(network, address string, attempt int, elapsed time.Duration, err error)) Option {
+	return func(o *options) error {
+		o.dialer.OnDialDone = done
+		o.dialerOpts = append(o.dialerOpts, "WithOnDialDone")
+		return nil
+	}
+}
+
+// WithTrace sets the Dialer's Trace.
+func WithTrace(trace *DialTrace) Option {
+	return func(o *options) error {
+		o.dialer.Trace = trace
+		o.dialerOpts = append(o.dialerOpts, "WithTrace")
+		return nil
+	}
+}
+
+// WithOnConn sets the Dialer's OnConn.
+func WithOnConn(wrap func(c net.Conn) net.Conn) Option {
+	return func(o *options) error {
+		o.dialer.OnConn = wrap
+		o.dialerOpts = append(o.dialerOpts, "WithOnConn")
+		return nil
+	}
+}
+
+// WithThrottle sets the Dialer's ReadLimiter and WriteLimiter.
+// Either may be nil.
+func WithThrottle(read, write ByteLimiter) Option {
+	return func(o *options) error {
+		o.dialer.ReadLimiter = read
+		o.dialer.WriteLimiter = write
+		o.dialerOpts = append(o.dialerOpts, "WithThrottle")
+		return nil
+	}
+}
+
+// WithMetered sets the Dialer's Metered.
+func WithMetered(metered bool) Option {
+	return func(o *options) error {
+		o.dialer.Metered = metered
+		o.dialerOpts = append(o.dialerOpts, "WithMetered")
+		return nil
+	}
+}
+
+// WithConnIdleTimeout sets the Dialer's ConnIdleTimeout.
+func WithConnIdleTimeout(timeout time.Duration) Option {
+	return func(o *options) error {
+		if timeout < 0 {
+			return &OptionError{"WithConnIdleTimeout", "negative duration"}
+		}
+		o.dialer.ConnIdleTimeout = timeout
+		o.dialerOpts = append(o.dialerOpts, "WithConnIdleTimeout")
+		return nil
+	}
+}
+
+// WithConnMaxLifetime sets the Dialer's ConnMaxLifetime.
+func WithConnMaxLifetime(lifetime time.Duration) Option {
+	return func(o *options) error {
+		if lifetime < 0 {
+			return &OptionError{"WithConnMaxLifetime", "negative duration"}
+		}
+		o.dialer.ConnMaxLifetime = lifetime
+		o.dialerOpts = append(o.dialerOpts, "WithConnMaxLifetime")
+		return nil
+	}
+}
+
+// WithLocalAddrFunc sets the Dialer's LocalAddrFunc.
+func WithLocalAddrFunc(local func(remote net.Addr) net.Addr) Option {
+	return func(o *options) error {
+		o.dialer.LocalAddrFunc = local
+		o.dialerOpts = append(o.dialerOpts, "WithLocalAddrFunc")
+		return nil
+	}
+}
+
+// WithInterface sets the Dialer's Interface.
+func WithInterface(name string) Option {
+	return func(o *options) error {
+		o.dialer.Interface = name
+		o.dialerOpts = append(o.dialerOpts, "WithInterface")
+		return nil
+	}
+}
+
+// WithIPv4Mapped sets the Dialer's IPv4Mapped.
+func WithIPv4Mapped(mapped bool) Option {
+	return func(o *options) error {
+		o.dialer.IPv4Mapped = mapped
+		o.dialerOpts = append(o.dialerOpts, "WithIPv4Mapped")
+		return nil
+	}
+}
+
+// WithDefaultZone sets the Dialer's DefaultZone.
+func WithDefaultZone(zone string) Option {
+	return func(o *options) error {
+		o.dialer.DefaultZone = zone
+		o.dialerOpts = append(o.dialerOpts, "WithDefaultZone")
+		return nil
+	}
+}
+
+// WithControl sets the Dialer's Control.
+func WithControl(control func(network, address string, c syscall.RawConn) error) Option {
+	return func(o *options) error {
+		o.dialer.Control = control
+		o.dialerOpts = append(o.dialerOpts, "WithControl")
+		return nil
+	}
+}
+
+// WithNoDelay sets the Dialer's NoDelay.
+func WithNoDelay(noDelay bool) Option {
+	return func(o *options) error {
+		o.dialer.NoDelay = &noDelay
+		o.dialerOpts = append(o.dialerOpts, "WithNoDelay")
+		return nil
+	}
+}
+
+// WithReadBufferSize sets the Dialer's ReadBufferSize.
+func WithReadBufferSize(size int) Option {
+	return func(o *options) error {
+		if size < 0 {
+			return &OptionError{"WithReadBufferSize", "negative size"}
+		}
+		o.dialer.ReadBufferSize = size
+		o.dialerOpts = append(o.dialerOpts, "WithReadBufferSize")
+		return nil
+	}
+}
+
+// WithWriteBufferSize sets the Dialer's WriteBufferSize.
+func WithWriteBufferSize(size int) Option {
+	return func(o *options) error {
+		if size < 0 {
+			return &OptionError{"WithWriteBufferSize", "negative size"}
+		}
+		o.dialer.WriteBufferSize = size
+		o.dialerOpts = append(o.dialerOpts, "WithWriteBufferSize")
+		return nil
+	}
+}
+
+// WithKeepAlive sets the Dialer's KeepAlive.
+func WithKeepAlive(keepAlive time.Duration) Option {
+	return func(o *options) error {
+		if keepAlive < 0 {
+			return &OptionError{"WithKeepAlive", "negative duration"}
+		}
+		o.dialer.KeepAlive = keepAlive
+		o.dialerOpts = append(o.dialerOpts, "WithKeepAlive")
+		return nil
+	}
+}
+
+// WithKeepAliveConfig sets the Dialer's KeepAliveConfig.
+func WithKeepAliveConfig(cfg KeepAliveConfig) Option {
+	return func(o *options) error {
+		if cfg.Idle < 0 || cfg.Interval < 0 {
+			return &OptionError{"WithKeepAliveConfig", "negative duration"}
+		}
+		if cfg.Count < 0 {
+			return &OptionError{"WithKeepAliveConfig", "negative count"}
+		}
+		o.dialer.KeepAliveConfig = &cfg
+		o.dialerOpts = append(o.dialerOpts, "WithKeepAliveConfig")
+		return nil
+	}
+}
+
+// WithTCPUserTimeout sets the Dialer's TCPUserTimeout. A positive
+// timeout fails with an *OptionError on platforms other than Linux,
+// where TCP_USER_TIMEOUT isn't supported.
+func WithTCPUserTimeout(timeout time.Duration) Option {
+	return func(o *options) error {
+		if timeout < 0 {
+			return &OptionError{"WithTCPUserTimeout", "negative duration"}
+		}
+		if timeout > 0 && !canSetTCPUserTimeout {
+			return &OptionError{"WithTCPUserTimeout", "not supported on this platform"}
+		}
+		o.dialer.TCPUserTimeout = timeout
+		o.dialerOpts = append(o.dialerOpts, "WithTCPUserTimeout")
+		return nil
+	}
+}
+
+// WithMultipathTCP sets the Dialer's MultipathTCP.
+func WithMultipathTCP(use bool) Option {
+	return func(o *options) error {
+		o.dialer.MultipathTCP = use
+		o.dialerOpts = append(o.dialerOpts, "WithMultipathTCP")
+		return nil
+	}
+}
+
+// WithTrafficClass sets the Dialer's TrafficClass.
+func WithTrafficClass(class int) Option {
+	return func(o *options) error {
+		if class < 0 || class > 0xff {
+			return &OptionError{"WithTrafficClass", "out of range"}
+		}
+		o.dialer.TrafficClass = class
+		o.dialerOpts = append(o.dialerOpts, "WithTrafficClass")
+		return nil
+	}
+}
+
+// WithTTL sets the CacheResolver's TTL.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) error {
+		if ttl < 0 {
+			return &OptionError{"WithTTL", "negative duration"}
+		}
+		o.ttl = ttl
+		o.cacheOpts = append(o.cacheOpts, "WithTTL")
+		return nil
+	}
+}
+
+// WithNegativeTTL sets the CacheResolver's NegativeTTL.
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(o *options) error {
+		if ttl < 0 {
+			return &OptionError{"WithNegativeTTL", "negative duration"}
+		}
+		o.negTTL = ttl
+		o.cacheOpts = append(o.cacheOpts, "WithNegativeTTL")
+		return nil
+	}
+}
+
+// WithMaxEntries sets the CacheResolver's MaxEntries.
+func WithMaxEntries(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return &OptionError{"WithMaxEntries", "negative size"}
+		}
+		o.maxEntries = n
+		o.cacheOpts = append(o.cacheOpts, "WithMaxEntries")
+		return nil
+	}
+}
+
+// WithMonitor invalidates all of the CacheResolver's hosts when m
+// notices that the network has changed, after the IP stack has
+// been probed again.
+func WithMonitor(m *Monitor) Option {
+	return func(o *options) error {
+		if m == nil {
+			return &OptionError{"WithMonitor", "nil monitor"}
+		}
+		o.monitor = m
+		o.cacheOpts = append(o.cacheOpts, "WithMonitor")
+		return nil
+	}
+}
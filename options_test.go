@@ -0,0 +1,140 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNewDialer(t *testing.T) {
+	d, err := NewDialer(WithTimeout(time.Second), WithPreference(PreferIPv6))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Timeout != time.Second || d.Preference != PreferIPv6 || d.Resolver != nil {
+		t.Fatalf("unexpected dialer: %+v", d)
+	}
+
+	d, err = NewDialer(WithResolver(DefaultResolver), WithTTL(time.Minute), WithMaxEntries(10))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r, ok := d.Resolver.(*CacheResolver)
+	if !ok {
+		t.Fatalf("resolver: expected *CacheResolver; got %T", d.Resolver)
+	}
+	if r.Resolver != DefaultResolver || r.TTL != time.Minute || r.MaxEntries != 10 {
+		t.Fatalf("unexpected resolver: %+v", r)
+	}
+}
+
+func TestNew(t *testing.T) {
+	d := DefaultDialer()
+	if d.Timeout != 30*time.Second || d.KeepAlive != 30*time.Second || d.DialStrategy != HappyEyeballs {
+		t.Fatalf("unexpected dialer: %+v", d)
+	}
+	if r, ok := d.Resolver.(*CacheResolver); !ok || r.TTL != time.Minute || r.Resolver != nil {
+		t.Fatalf("unexpected resolver: %+v", d.Resolver)
+	}
+
+	deadline := time.Now().Add(time.Hour)
+	d, err := New(WithDeadline(deadline), WithTTL(time.Hour), WithDialStrategy(Sequential))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Timeout != 0 || !d.Deadline.Equal(deadline) || d.DialStrategy != Sequential {
+		t.Fatalf("unexpected dialer: %+v", d)
+	}
+	if r, ok := d.Resolver.(*CacheResolver); !ok || r.TTL != time.Hour {
+		t.Fatalf("unexpected resolver: %+v", d.Resolver)
+	}
+
+	if d, err = New(WithTimeout(time.Second), WithDeadline(deadline)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Timeout != time.Second || !d.Deadline.Equal(deadline) {
+		t.Fatalf("unexpected dialer: %+v", d)
+	}
+
+	if d, err = New(WithDeadline(time.Now().Add(-time.Second))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := d.Dial("tcp", "127.0.0.1:1"); err == nil {
+		t.Fatal("past deadline: expected error")
+	} else if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("past deadline: expected timeout; got %v", err)
+	}
+
+	cache := &CacheResolver{}
+	if d, err = New(WithResolver(cache)); err != nil || d.Resolver != cache {
+		t.Fatalf("unexpected result: %+v, %v", d, err)
+	}
+}
+
+func TestOptionErrors(t *testing.T) {
+	if _, err := NewDialer(WithTimeout(-time.Second)); err == nil {
+		t.Error("negative timeout: expected error")
+	}
+	if _, err := NewDialer(WithResolver(&CacheResolver{}), WithTTL(time.Minute)); err == nil {
+		t.Error("cached CacheResolver: expected error")
+	}
+	if _, err := NewCacheResolver(WithTTL(time.Minute), WithKeepAlive(time.Minute)); err == nil {
+		t.Error("dialer option on resolver: expected error")
+	}
+	if _, err := NewCacheResolver(WithMaxEntries(-1)); err == nil {
+		t.Error("negative max entries: expected error")
+	}
+}
+
+func TestConnOptions(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+
+	d, err := NewDialer(WithNoDelay(false), WithReadBufferSize(1<<16), WithWriteBufferSize(1<<16))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.NoDelay == nil || *d.NoDelay || d.ReadBufferSize != 1<<16 || d.WriteBufferSize != 1<<16 {
+		t.Fatalf("unexpected dialer: %+v", d)
+	}
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Close()
+
+	if _, err := NewDialer(WithReadBufferSize(-1)); err == nil {
+		t.Fatal("expected error for negative size")
+	}
+}
+
+var _ ContextDialer = (*net.Dialer)(nil)
+
+func TestNewCachingDialer(t *testing.T) {
+	cd, err := NewCachingDialer(time.Minute, WithTimeout(time.Second), WithMaxEntries(10))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d, ok := cd.(*Dialer)
+	if !ok {
+		t.Fatalf("dialer: expected *Dialer; got %T", cd)
+	}
+	r, ok := d.Resolver.(*CacheResolver)
+	if !ok {
+		t.Fatalf("resolver: expected *CacheResolver; got %T", d.Resolver)
+	}
+	if d.Timeout != time.Second || r.TTL != time.Minute || r.MaxEntries != 10 {
+		t.Fatalf("unexpected dialer: %+v, %+v", d, r)
+	}
+
+	if cd, err := NewCachingDialer(-time.Minute); err == nil || cd != nil {
+		t.Fatalf("expected nil dialer and error; got %v, %v", cd, err)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// DialPacket resolves the address on the named packet network and
+// returns an unconnected packet connection for exchanging packets
+// with it, along with the remote address to write to. The remote
+// address is the first selected by the Dialer's filters.
+//
+// The connection is bound to a local address of the remote address's
+// family: the one returned by LocalAddrFunc, LocalAddr, an address
+// of Interface, or an automatically chosen address, in that order.
+// Unlike a connection returned by Dial, it may receive packets from
+// any address.
+//
+// Known networks are "udp", "udp4" (IPv4-only), "udp6" (IPv6-only),
+// "ip", "ip4" (IPv4-only) and "ip6" (IPv6-only), with the protocol
+// given after a colon for the IP networks.
+func (d *Dialer) DialPacket(ctx context.Context, network, address string) (net.PacketConn, net.Addr, error) {
+	if ctx == nil {
+		panic("nil context")
+	}
+	ctx, _, cancel := d.withDeadline(ctx)
+	defer cancel()
+	switch afnet, _ := parseNetwork(network); afnet {
+	case "udp", "udp4", "udp6", "ip", "ip4", "ip6":
+	default:
+		return nil, nil, newDialError(network, address, "resolve", nil, net.UnknownNetworkError(network))
+	}
+	addrs, err := d.resolve(ctx, network, address, d.PublicOnly)
+	if err != nil {
+		return nil, nil, err
+	}
+	raddr, ip := addrs.Addr(0), addrs.IP(0)
+	laddr := d.LocalAddr
+	if d.LocalAddrFunc != nil {
+		laddr = d.LocalAddrFunc(raddr)
+	}
+	if d.Interface != "" && !canBindToDevice && ip != nil {
+		local, err := interfaceAddr(d.Interface, ip)
+		if err != nil {
+			return nil, nil, newDialError(network, address, "connect", raddr, err)
+		}
+		laddr = localAddr(network, local)
+	}
+	var local string
+	if laddr != nil {
+		local = laddr.String()
+	}
+	lc := &net.ListenConfig{Control: d.control()}
+	pc, err := lc.ListenPacket(ctx, familyNetwork(network, ip), local)
+	if err != nil {
+		if oerr, ok := err.(*net.OpError); ok {
+			err = oerr.Err
+		}
+		return nil, nil, newDialError(network, address, "connect", raddr, err)
+	}
+	return pc, raddr, nil
+}
+
+// ListenPacket announces on the local address on the named packet
+// network. The address's host is resolved to the first address
+// selected by the Dialer's filters, and the Dialer's Control and
+// Interface apply to the socket.
+func (d *Dialer) ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error) {
+	lc := &ListenConfig{
+		Resolver: d.Resolver,
+		Filter:   d.filter(),
+		Control:  d.control(),
+	}
+	return lc.ListenPacket(ctx, network, address)
+}
+
+// familyNetwork returns the network restricted to the family of ip,
+// such as "udp4" for "udp" and an IPv4 address.
+func familyNetwork(network string, ip net.IP) string {
+	if ip == nil {
+		return network
+	}
+	afnet, proto := network, ""
+	if i := strings.IndexByte(network, ':'); i >= 0 {
+		afnet, proto = network[:i], network[i:]
+	}
+	if c := afnet[len(afnet)-1]; c == '4' || c == '6' {
+		return network
+	}
+	if ip.To4() != nil {
+		return afnet + "4" + proto
+	}
+	return afnet + "6" + proto
+}
@@ -0,0 +1,75 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestDialPacket(t *testing.T) {
+	srv, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.LocalAddr().String())
+
+	d := &Dialer{Resolver: StaticResolver{"packet.test": {net.IPv4(127, 0, 0, 1)}}}
+	ctx := context.Background()
+	pc, raddr, err := d.DialPacket(ctx, "udp", net.JoinHostPort("packet.test", port))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Close()
+	if raddr.String() != srv.LocalAddr().String() {
+		t.Fatalf("remote: expected %v; got %v", srv.LocalAddr(), raddr)
+	}
+	if laddr := pc.LocalAddr().(*net.UDPAddr); laddr.IP.To4() == nil && !laddr.IP.IsUnspecified() {
+		t.Fatalf("local: expected an IPv4 address; got %v", laddr)
+	}
+	if _, err := pc.WriteTo([]byte("ping"), raddr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	buf := make([]byte, 4)
+	n, from, err := srv.ReadFrom(buf)
+	if err != nil || string(buf[:n]) != "ping" {
+		t.Fatalf("expected ping; got %q, %v", buf[:n], err)
+	}
+	if _, err := srv.WriteTo([]byte("pong"), from); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n, _, err := pc.ReadFrom(buf); err != nil || string(buf[:n]) != "pong" {
+		t.Fatalf("expected pong; got %q, %v", buf[:n], err)
+	}
+
+	if _, _, err := d.DialPacket(ctx, "tcp", "packet.test:1"); err == nil {
+		t.Fatal("expected error for a stream network")
+	}
+	if _, _, err := d.DialPacket(ctx, "udp", "unknown.test:1"); err == nil {
+		t.Fatal("expected error resolving unknown host")
+	}
+}
+
+func TestFamilyNetwork(t *testing.T) {
+	tests := []struct {
+		network string
+		ip      net.IP
+		want    string
+	}{
+		{"udp", net.IPv4(192, 0, 2, 1), "udp4"},
+		{"udp", net.ParseIP("2001:db8::1"), "udp6"},
+		{"udp6", net.ParseIP("2001:db8::1"), "udp6"},
+		{"ip:icmp", net.IPv4(192, 0, 2, 1), "ip4:icmp"},
+		{"ip6:58", net.ParseIP("2001:db8::1"), "ip6:58"},
+		{"udp", nil, "udp"},
+	}
+	for _, tt := range tests {
+		if got := familyNetwork(tt.network, tt.ip); got != tt.want {
+			t.Errorf("familyNetwork(%q, %v): expected %q; got %q", tt.network, tt.ip, tt.want, got)
+		}
+	}
+}
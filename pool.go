@@ -0,0 +1,260 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrPoolClosed is returned by Pool.Get after the pool is closed.
+	ErrPoolClosed = errors.New("pool is closed")
+
+	errConnClosed = errors.New("use of closed pool connection")
+)
+
+// DefaultMaxIdle is the maximum number of idle connections
+// a Pool keeps for each network and address if its MaxIdle
+// is zero.
+const DefaultMaxIdle = 2
+
+// A Pool maintains reusable connections for each network and
+// address. Its methods are safe for concurrent use.
+type Pool struct {
+	// Dialer dials new connections.
+	// If nil, a zero Dialer is used.
+	Dialer *Dialer
+
+	// MaxIdle is the maximum number of idle connections kept
+	// for each network and address. If negative, no connections
+	// are kept.
+	//
+	// If zero, DefaultMaxIdle is used.
+	MaxIdle int
+
+	// MaxActive is the maximum number of connections in use for
+	// each network and address. Get waits for a connection to be
+	// returned once it's reached.
+	//
+	// If zero, there is no limit.
+	MaxActive int
+
+	// IdleTimeout is the length of time after which idle
+	// connections are closed.
+	//
+	// If zero, idle connections are not closed.
+	IdleTimeout time.Duration
+
+	// TestOnGet, if non-nil, is called with an idle connection and
+	// the time it was returned to the pool before Get returns it.
+	// If it returns an error, the connection is closed and another
+	// is tried. The Dialer's HealthCheck, if any, is called too.
+	TestOnGet func(c net.Conn, idleSince time.Time) error
+
+	mu     sync.Mutex
+	hosts  map[poolKey]*poolHost
+	closed bool
+}
+
+type poolKey struct {
+	network, address string
+}
+
+// A poolHost holds the connections of a network and address.
+type poolHost struct {
+	idle  []idleConn    // most recently returned last
+	slots chan struct{} // connections in use, if limited
+}
+
+type idleConn struct {
+	net.Conn
+	since time.Time
+}
+
+// Get returns a connection to the address on the named network,
+// reusing an idle connection if there is one. Otherwise it dials
+// a new connection. The connection must be returned to the pool
+// by closing it or discarded with its Discard method.
+func (p *Pool) Get(ctx context.Context, network, address string) (*PoolConn, error) {
+	key := poolKey{network, address}
+	h, err := p.host(key)
+	if err != nil {
+		return nil, err
+	}
+	if h.slots != nil {
+		select {
+		case h.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, contextError(ctx.Err())
+		}
+	}
+	d := p.Dialer
+	if d == nil {
+		d = &Dialer{}
+	}
+	for {
+		c, since, err := p.popIdle(h)
+		if err != nil {
+			p.release(h)
+			return nil, err
+		}
+		if c == nil {
+			break
+		}
+		if p.TestOnGet != nil && p.TestOnGet(c, since) != nil ||
+			d.HealthCheck != nil && d.HealthCheck(c) != nil {
+			c.Close()
+			continue
+		}
+		return &PoolConn{Conn: c, pool: p, key: key}, nil
+	}
+	c, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		p.release(h)
+		return nil, err
+	}
+	return &PoolConn{Conn: c, pool: p, key: key}, nil
+}
+
+// Close closes the pool's idle connections. Connections in
+// use are closed when they are returned.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, h := range p.hosts {
+		for _, c := range h.idle {
+			c.Close()
+		}
+		h.idle = nil
+	}
+	return nil
+}
+
+func (p *Pool) host(key poolKey) (*poolHost, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+	h := p.hosts[key]
+	if h == nil {
+		h = &poolHost{}
+		if p.MaxActive > 0 {
+			h.slots = make(chan struct{}, p.MaxActive)
+		}
+		if p.hosts == nil {
+			p.hosts = make(map[poolKey]*poolHost)
+		}
+		p.hosts[key] = h
+	}
+	return h, nil
+}
+
+// popIdle removes and returns the most recently returned idle
+// connection of h that hasn't timed out, if there is one.
+func (p *Pool) popIdle(h *poolHost) (net.Conn, time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, time.Time{}, ErrPoolClosed
+	}
+	p.expire(h)
+	n := len(h.idle)
+	if n == 0 {
+		return nil, time.Time{}, nil
+	}
+	c := h.idle[n-1]
+	h.idle[n-1] = idleConn{}
+	h.idle = h.idle[:n-1]
+	return c.Conn, c.since, nil
+}
+
+// put returns c to the idle connections of the network and
+// address or closes it if they're full.
+func (p *Pool) put(key poolKey, c net.Conn) error {
+	p.mu.Lock()
+	h := p.hosts[key]
+	p.expire(h)
+	if p.closed || len(h.idle) >= p.maxIdle() {
+		p.mu.Unlock()
+		p.release(h)
+		return c.Close()
+	}
+	h.idle = append(h.idle, idleConn{c, timeNow()})
+	p.mu.Unlock()
+	p.release(h)
+	return nil
+}
+
+// discard closes c, which is in use for the network and address.
+func (p *Pool) discard(key poolKey, c net.Conn) error {
+	p.mu.Lock()
+	h := p.hosts[key]
+	p.mu.Unlock()
+	p.release(h)
+	return c.Close()
+}
+
+// release frees a connection slot of h.
+func (p *Pool) release(h *poolHost) {
+	if h.slots != nil {
+		<-h.slots
+	}
+}
+
+// expire closes the idle connections of h that have timed out.
+// It must be called with mu held.
+func (p *Pool) expire(h *poolHost) {
+	if p.IdleTimeout <= 0 {
+		return
+	}
+	cutoff := timeNow().Add(-p.IdleTimeout)
+	n := 0
+	for n < len(h.idle) && h.idle[n].since.Before(cutoff) {
+		h.idle[n].Close()
+		n++
+	}
+	if n > 0 {
+		h.idle = append(h.idle[:0], h.idle[n:]...)
+	}
+}
+
+func (p *Pool) maxIdle() int {
+	if p.MaxIdle == 0 {
+		return DefaultMaxIdle
+	}
+	return p.MaxIdle
+}
+
+// A PoolConn is a connection of a Pool.
+type PoolConn struct {
+	net.Conn
+	pool *Pool
+	key  poolKey
+	done int32
+}
+
+// Close returns the connection to its pool.
+func (c *PoolConn) Close() error {
+	if !atomic.CompareAndSwapInt32(&c.done, 0, 1) {
+		return errConnClosed
+	}
+	return c.pool.put(c.key, c.Conn)
+}
+
+// Discard closes the connection without returning it to its pool.
+// It should be used instead of Close if the connection is broken.
+func (c *PoolConn) Discard() error {
+	if !atomic.CompareAndSwapInt32(&c.done, 0, 1) {
+		return errConnClosed
+	}
+	return c.pool.discard(c.key, c.Conn)
+}
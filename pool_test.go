@@ -0,0 +1,144 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// testAccepter starts a server that accepts connections and
+// reports how many it has accepted.
+func testAccepter(t *testing.T) (net.Listener, func() int) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	accepted := make(chan net.Conn, 100)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+	return ln, func() int {
+		time.Sleep(10 * time.Millisecond)
+		return len(accepted)
+	}
+}
+
+func TestPoolReuse(t *testing.T) {
+	ln, accepted := testAccepter(t)
+	defer ln.Close()
+	addr := ln.Addr().String()
+	ctx := context.Background()
+
+	p := &Pool{MaxIdle: 1}
+	defer p.Close()
+	c1, err := p.Get(ctx, "tcp", addr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c2, err := p.Get(ctx, "tcp", addr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conn := c1.Conn
+	c1.Close()
+	c2.Close() // exceeds MaxIdle
+	if err := c1.Close(); err == nil {
+		t.Fatal("expected error closing twice")
+	}
+
+	c3, err := p.Get(ctx, "tcp", addr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c3.Conn != conn {
+		t.Fatal("expected idle connection to be reused")
+	}
+	c3.Discard()
+	if n := accepted(); n != 2 {
+		t.Fatalf("accepted: expected 2; got %d", n)
+	}
+}
+
+func TestPoolMaxActive(t *testing.T) {
+	ln, _ := testAccepter(t)
+	defer ln.Close()
+	addr := ln.Addr().String()
+
+	p := &Pool{MaxActive: 1}
+	defer p.Close()
+	c, err := p.Get(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(ctx, "tcp", addr); err == nil {
+		t.Fatal("expected error while at MaxActive")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c.Close()
+	}()
+	c, err = p.Get(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Close()
+}
+
+func TestPoolIdle(t *testing.T) {
+	defer func(timeFn func() time.Time) { timeNow = timeFn }(timeNow)
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+
+	ln, accepted := testAccepter(t)
+	defer ln.Close()
+	addr := ln.Addr().String()
+	ctx := context.Background()
+
+	errUnhealthy := errors.New("unhealthy")
+	var unhealthy bool
+	p := &Pool{
+		IdleTimeout: time.Minute,
+		TestOnGet: func(c net.Conn, idleSince time.Time) error {
+			if unhealthy {
+				return errUnhealthy
+			}
+			return nil
+		},
+	}
+	get := func() {
+		c, err := p.Get(ctx, "tcp", addr)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		c.Close()
+	}
+	get()
+	get() // reused
+	now = now.Add(2 * time.Minute)
+	get() // expired
+	unhealthy = true
+	get() // failed the test
+	if n := accepted(); n != 3 {
+		t.Fatalf("accepted: expected 3; got %d", n)
+	}
+
+	p.Close()
+	if _, err := p.Get(ctx, "tcp", addr); err != ErrPoolClosed {
+		t.Fatalf("expected ErrPoolClosed; got %v", err)
+	}
+}
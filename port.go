@@ -0,0 +1,86 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"net"
+	"strings"
+)
+
+// ResolvePort returns the port number of the service on the named
+// network, "tcp", "tcp4", "tcp6", "udp", "udp4" or "udp6". The
+// service may be a decimal port number or a service name, such as
+// "http". An empty service or "0" is port 0, which asks for a port
+// to be chosen automatically when listening.
+func ResolvePort(network, service string) (int, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
+	default:
+		return 0, net.UnknownNetworkError(network)
+	}
+	if service == "" {
+		return 0, nil
+	}
+	return parsePort(network, service)
+}
+
+// ResolvePortRange returns the first and last ports of the range
+// of ports on the named network. The range may be two decimal port
+// numbers separated by a hyphen, such as "8000-8100", or a single
+// port as accepted by ResolvePort, which is both the first and the
+// last port.
+func ResolvePortRange(network, ports string) (first, last int, err error) {
+	if i := strings.IndexByte(ports, '-'); i > 0 && isDecimal(ports[:i]) && isDecimal(ports[i+1:]) {
+		if first, err = ResolvePort(network, ports[:i]); err != nil {
+			return 0, 0, err
+		}
+		if last, err = ResolvePort(network, ports[i+1:]); err != nil {
+			return 0, 0, err
+		}
+		if first > last {
+			return 0, 0, &net.AddrError{Err: "invalid port range", Addr: ports}
+		}
+		return first, last, nil
+	}
+	// Service names may contain hyphens, such as "x11-ssh".
+	if first, err = ResolvePort(network, ports); err != nil {
+		return 0, 0, err
+	}
+	return first, first, nil
+}
+
+// SplitHostPort splits an address of the form "host:port",
+// "host%zone:port", "[host]:port" or "[host%zone]:port" on the named
+// network into its host and port number. The port is resolved as
+// by ResolvePort, so "host:http" and ":0" are valid.
+func SplitHostPort(network, address string) (host string, port int, err error) {
+	host, service, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, err
+	}
+	if port, err = ResolvePort(network, service); err != nil {
+		return "", 0, err
+	}
+	return host, port, nil
+}
+
+// SplitHostPortRange splits an address of the form "host:ports",
+// where ports is a range of ports as accepted by ResolvePortRange,
+// into its host and the first and last ports of the range.
+func SplitHostPortRange(network, address string) (host string, first, last int, err error) {
+	host, ports, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if first, last, err = ResolvePortRange(network, ports); err != nil {
+		return "", 0, 0, err
+	}
+	return host, first, last, nil
+}
+
+func isDecimal(s string) bool {
+	_, i, ok := dtoi(s, 0)
+	return ok && i == len(s)
+}
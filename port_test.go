@@ -0,0 +1,59 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import "testing"
+
+func TestResolvePortRange(t *testing.T) {
+	tests := []struct {
+		network, ports string
+		first, last    int
+		ok             bool
+	}{
+		{"tcp", "80", 80, 80, true},
+		{"tcp", "", 0, 0, true},
+		{"tcp", "0", 0, 0, true},
+		{"tcp", "8000-8100", 8000, 8100, true},
+		{"udp6", "53-53", 53, 53, true},
+		{"tcp", "8100-8000", 0, 0, false},
+		{"tcp", "8000-70000", 0, 0, false},
+		{"tcp", "65536", 0, 0, false},
+		{"tcp", "8000-", 0, 0, false},
+		{"unix", "80", 0, 0, false},
+	}
+	for _, tt := range tests {
+		first, last, err := ResolvePortRange(tt.network, tt.ports)
+		if ok := err == nil; ok != tt.ok || first != tt.first || last != tt.last {
+			t.Errorf("ResolvePortRange(%q, %q): expected (%d, %d, ok=%v); got (%d, %d, %v)",
+				tt.network, tt.ports, tt.first, tt.last, tt.ok, first, last, err)
+		}
+	}
+}
+
+func TestSplitHostPort(t *testing.T) {
+	tests := []struct {
+		address, host string
+		port          int
+		ok            bool
+	}{
+		{"example.com:443", "example.com", 443, true},
+		{"[::1]:0", "::1", 0, true},
+		{":0", "", 0, true},
+		{"[fe80::1%eth0]:22", "fe80::1%eth0", 22, true},
+		{"example.com", "", 0, false},
+		{"example.com:-1", "", 0, false},
+	}
+	for _, tt := range tests {
+		host, port, err := SplitHostPort("tcp", tt.address)
+		if ok := err == nil; ok != tt.ok || host != tt.host || port != tt.port {
+			t.Errorf("SplitHostPort(%q): expected (%q, %d, ok=%v); got (%q, %d, %v)",
+				tt.address, tt.host, tt.port, tt.ok, host, port, err)
+		}
+	}
+	host, first, last, err := SplitHostPortRange("tcp", "[::1]:8000-8100")
+	if err != nil || host != "::1" || first != 8000 || last != 8100 {
+		t.Errorf("SplitHostPortRange: expected (::1, 8000, 8100); got (%q, %d, %d, %v)", host, first, last, err)
+	}
+}
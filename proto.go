@@ -0,0 +1,107 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+)
+
+// ErrRawSocketPermission is returned by a dial of an IP network
+// when the process lacks the privileges to open raw sockets.
+var ErrRawSocketPermission = errors.New("raw IP sockets require privileges, such as root or CAP_NET_RAW")
+
+var errUnknownProtocol = errors.New("unknown IP protocol")
+
+var (
+	protocolsPath = "/etc/protocols" // used by tests
+
+	// protocolNames maps the lowercase names and aliases of IP
+	// protocols to their numbers. It's loaded once, on first use.
+	protocolNames map[string]int
+	protocolsOnce sync.Once
+)
+
+// builtinProtocols are the protocols known if /etc/protocols
+// doesn't exist or lacks them.
+var builtinProtocols = map[string]int{
+	"icmp":      1,
+	"igmp":      2,
+	"tcp":       6,
+	"udp":       17,
+	"ipv6-icmp": 58,
+	"sctp":      132,
+}
+
+// lookupProtocol returns the number of the IP protocol given
+// by its decimal number or its case-insensitive name.
+func lookupProtocol(name string) (int, error) {
+	if n, i, ok := dtoi(name, 0); ok && i == len(name) {
+		if n > 0xff {
+			return 0, errUnknownProtocol
+		}
+		return n, nil
+	}
+	protocolsOnce.Do(readProtocols)
+	if n, ok := protocolNames[lowerASCII(name)]; ok {
+		return n, nil
+	}
+	return 0, errUnknownProtocol
+}
+
+func readProtocols() {
+	names := make(map[string]int, len(builtinProtocols))
+	for name, n := range builtinProtocols {
+		names[name] = n
+	}
+	protocolNames = names
+	file, err := open(protocolsPath)
+	if err != nil {
+		return
+	}
+	defer file.close()
+	for line, ok := file.readLine(); ok; line, ok = file.readLine() {
+		// tcp    6   TCP    # transmission control protocol
+		if i := byteIndex(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		f := getFields(line)
+		if len(f) < 2 {
+			continue
+		}
+		n, i, ok := dtoi(f[1], 0)
+		if !ok || i != len(f[1]) || n > 0xff {
+			continue
+		}
+		names[lowerASCII(f[0])] = n
+		for _, alias := range f[2:] {
+			names[lowerASCII(alias)] = n
+		}
+	}
+}
+
+// isPermission reports whether err, possibly wrapped by a
+// *net.OpError, is due to a lack of privileges.
+func isPermission(err error) bool {
+	if oerr, ok := err.(*net.OpError); ok {
+		err = oerr.Err
+	}
+	return err != nil && os.IsPermission(err)
+}
+
+// DialIPProto connects to dst with the IP protocol given by its number
+// or name, such as "icmp", and returns a *net.IPConn. The network is
+// "ip4" or "ip6" depending on dst's family. It fails with
+// ErrRawSocketPermission if the process lacks the privileges to open
+// raw sockets.
+func (d *Dialer) DialIPProto(proto string, dst net.IP) (*net.IPConn, error) {
+	network := "ip6:" + proto
+	if dst.To4() != nil {
+		network = "ip4:" + proto
+	}
+	return d.DialIP(network, dst.String())
+}
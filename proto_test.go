@@ -0,0 +1,77 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func TestLookupProtocol(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nett")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "protocols")
+	data := "# comment\nicmp\t1\tICMP\t# internet control message protocol\nexp\t253\tExperimental EXP1\nbad\t300\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func(path string) {
+		protocolsPath = path
+		protocolsOnce = sync.Once{}
+	}(protocolsPath)
+	protocolsPath = path
+	protocolsOnce = sync.Once{}
+
+	tests := []struct {
+		name string
+		want int
+		ok   bool
+	}{
+		{"1", 1, true},
+		{"255", 255, true},
+		{"256", 0, false},
+		{"icmp", 1, true},
+		{"ICMP", 1, true},
+		{"udp", 17, true}, // built in
+		{"exp1", 253, true},
+		{"Experimental", 253, true},
+		{"bad", 0, false},
+		{"nope", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		n, err := lookupProtocol(tt.name)
+		if tt.ok && (err != nil || n != tt.want) {
+			t.Errorf("%q: expected %d; got %d, %v", tt.name, tt.want, n, err)
+		} else if !tt.ok && err == nil {
+			t.Errorf("%q: expected error; got %d", tt.name, n)
+		}
+	}
+
+	if _, err := parseNetwork("ip4:exp1"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := parseNetwork("ip4:nope"); err == nil {
+		t.Error("expected error for unknown protocol")
+	}
+}
+
+func TestIsPermission(t *testing.T) {
+	err := &net.OpError{Op: "dial", Net: "ip4:icmp", Err: os.NewSyscallError("socket", syscall.EPERM)}
+	if !isPermission(err) {
+		t.Errorf("expected permission error: %v", err)
+	}
+	if isPermission(nil) || isPermission(ErrConnectTimeout) {
+		t.Error("unexpected permission error")
+	}
+}
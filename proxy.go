@@ -0,0 +1,233 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errProxyScheme = errors.New("unsupported proxy scheme")
+	errSOCKSAuth   = errors.New("socks5: authentication failed")
+	errSOCKSReply  = errors.New("socks5: malformed reply")
+)
+
+// ProxyURL returns a proxy function, for use as a Dialer's Proxy,
+// that always returns the same URL.
+func ProxyURL(u *url.URL) func(network, address string) (*url.URL, error) {
+	return func(network, address string) (*url.URL, error) {
+		return u, nil
+	}
+}
+
+// ProxyFromEnvironment returns the URL of the proxy to use for
+// dialing the address, for use as a Dialer's Proxy. It is chosen
+// by http.ProxyFromEnvironment as if for an HTTPS request to the
+// address, so the HTTPS_PROXY and NO_PROXY environment variables
+// apply.
+func ProxyFromEnvironment(network, address string) (*url.URL, error) {
+	return http.ProxyFromEnvironment(&http.Request{
+		URL: &url.URL{Scheme: "https", Host: address},
+	})
+}
+
+// dialProxy connects to the address on the named network through
+// the proxy specified by u.
+func (d *Dialer) dialProxy(ctx context.Context, deadline time.Time, u *url.URL, network, address string) (net.Conn, error) {
+	var (
+		connect func(net.Conn, *url.URL, string) (net.Conn, error)
+		port    string
+	)
+	switch u.Scheme {
+	case "http":
+		connect, port = connectHTTP, "80"
+	case "socks5":
+		connect, port = connectSOCKS, "1080"
+	default:
+		return nil, newDialError(network, address, "proxy", nil, errProxyScheme)
+	}
+	proxyAddr := u.Host
+	if _, _, err := net.SplitHostPort(proxyAddr); err != nil {
+		proxyAddr = net.JoinHostPort(strings.Trim(proxyAddr, "[]"), port)
+	}
+	target := address
+	if d.PublicOnly {
+		// The proxy would resolve the host itself, so resolve and check
+		// it here and have the proxy connect to the address selected.
+		addrs, err := d.resolve(ctx, network, address, true)
+		if err != nil {
+			return nil, err
+		}
+		target = addrs.Addr(0).String()
+	}
+	// The proxy is configured by the application, not the user, so
+	// it may have a non-public address, as is usual.
+	c, err := d.dialDirect(ctx, deadline, "tcp", proxyAddr, false)
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	err = withConn(ctx, c, func() error {
+		var err error
+		conn, err = connect(c, u, target)
+		return err
+	})
+	if err != nil {
+		c.Close()
+		return nil, newDialError(network, address, "handshake", c.RemoteAddr(), err)
+	}
+	return conn, nil
+}
+
+// connectHTTP establishes a tunnel to address with an
+// HTTP CONNECT request sent over c.
+func connectHTTP(c net.Conn, u *url.URL, address string) (net.Conn, error) {
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + pass))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(c); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(c)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("proxy: " + resp.Status)
+	}
+	if br.Buffered() > 0 {
+		// The tunnel's data arrived with the response.
+		return &bufferedConn{c, br}, nil
+	}
+	return c, nil
+}
+
+// A bufferedConn is a connection whose reads are buffered.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+// connectSOCKS establishes a connection to address through
+// the SOCKS5 proxy over c, as described in RFC 1928.
+func connectSOCKS(c net.Conn, u *url.URL, address string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 0xffff {
+		return nil, &net.AddrError{Err: "invalid port", Addr: address}
+	}
+
+	// Negotiate the authentication method.
+	methods := []byte{0x00} // no authentication
+	if u.User != nil {
+		methods = append(methods, 0x02) // username and password
+	}
+	b := append([]byte{0x05, byte(len(methods))}, methods...)
+	if _, err := c.Write(b); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(c, b[:2]); err != nil {
+		return nil, err
+	}
+	if b[0] != 0x05 {
+		return nil, errSOCKSReply
+	}
+	switch b[1] {
+	case 0x00:
+	case 0x02:
+		if u.User == nil {
+			return nil, errSOCKSAuth
+		}
+		// RFC 1929.
+		user := u.User.Username()
+		pass, _ := u.User.Password()
+		if len(user) > 255 || len(pass) > 255 {
+			return nil, errSOCKSAuth
+		}
+		b = append([]byte{0x01, byte(len(user))}, user...)
+		b = append(append(b, byte(len(pass))), pass...)
+		if _, err := c.Write(b); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(c, b[:2]); err != nil {
+			return nil, err
+		}
+		if b[1] != 0x00 {
+			return nil, errSOCKSAuth
+		}
+	default:
+		return nil, errors.New("socks5: no acceptable authentication method")
+	}
+
+	// Request the connection.
+	b = []byte{0x05, 0x01, 0x00} // CONNECT
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return nil, &net.AddrError{Err: "host name too long", Addr: host}
+		}
+		b = append(append(b, 0x03, byte(len(host))), host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		b = append(append(b, 0x01), ip4...)
+	} else {
+		b = append(append(b, 0x04), ip...)
+	}
+	b = append(b, byte(port>>8), byte(port))
+	if _, err := c.Write(b); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(c, b[:4]); err != nil {
+		return nil, err
+	}
+	if b[0] != 0x05 {
+		return nil, errSOCKSReply
+	}
+	if b[1] != 0x00 {
+		return nil, errors.New("socks5: connect failed with code " + strconv.Itoa(int(b[1])))
+	}
+	// Discard the bound address and port.
+	var n int
+	switch b[3] {
+	case 0x01:
+		n = net.IPv4len
+	case 0x04:
+		n = net.IPv6len
+	case 0x03:
+		if _, err := io.ReadFull(c, b[:1]); err != nil {
+			return nil, err
+		}
+		n = int(b[0])
+	default:
+		return nil, errSOCKSReply
+	}
+	if _, err := io.ReadFull(c, make([]byte, n+2)); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
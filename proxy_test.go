@@ -0,0 +1,219 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testEcho starts a server that echoes data on its connections.
+func testEcho(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+	return ln
+}
+
+// testProxy starts a proxy server that handles each connection with
+// serve, which returns the requested address, and then relays data
+// between the connection and backend.
+func testProxy(t *testing.T, backend string, serve func(c net.Conn, br *bufio.Reader) (string, error)) (net.Listener, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	addrs := make(chan string, 1)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				br := bufio.NewReader(c)
+				addr, err := serve(c, br)
+				if err != nil {
+					return
+				}
+				addrs <- addr
+				b, err := net.Dial("tcp", backend)
+				if err != nil {
+					return
+				}
+				defer b.Close()
+				go io.Copy(b, br)
+				io.Copy(c, b)
+			}()
+		}
+	}()
+	return ln, addrs
+}
+
+func testDialProxy(t *testing.T, scheme string, serve func(c net.Conn, br *bufio.Reader) (string, error)) {
+	echo := testEcho(t)
+	defer echo.Close()
+	proxy, addrs := testProxy(t, echo.Addr().String(), serve)
+	defer proxy.Close()
+	_, port, _ := net.SplitHostPort(proxy.Addr().String())
+
+	d := &Dialer{
+		Timeout:  5 * time.Second,
+		Resolver: StaticResolver{"proxy.test": {net.IPv4(127, 0, 0, 1)}},
+		Proxy: ProxyURL(&url.URL{
+			Scheme: scheme,
+			User:   url.UserPassword("user", "pass"),
+			Host:   net.JoinHostPort("proxy.test", port),
+		}),
+	}
+	c, err := d.Dial("tcp", "backend.test:80")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+	if addr := <-addrs; addr != "backend.test:80" {
+		t.Fatalf("proxied address: expected backend.test:80; got %s", addr)
+	}
+	msg := []byte("hello")
+	if _, err := c.Write(msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(c, buf); err != nil || string(buf) != string(msg) {
+		t.Fatalf("echo: expected %q; got %q, %v", msg, buf, err)
+	}
+}
+
+// serveHTTPConnect serves an HTTP CONNECT request
+// authenticated with user and pass.
+func serveHTTPConnect(c net.Conn, br *bufio.Reader) (string, error) {
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return "", err
+	}
+	user, pass, ok := (&http.Request{Header: http.Header{
+		"Authorization": req.Header["Proxy-Authorization"],
+	}}).BasicAuth()
+	if req.Method != "CONNECT" || !ok || user != "user" || pass != "pass" {
+		io.WriteString(c, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+		return "", io.EOF
+	}
+	io.WriteString(c, "HTTP/1.1 200 Connection established\r\n\r\n")
+	return req.Host, nil
+}
+
+func TestDialHTTPProxy(t *testing.T) {
+	testDialProxy(t, "http", serveHTTPConnect)
+}
+
+func TestDialProxyPublicOnly(t *testing.T) {
+	echo := testEcho(t)
+	defer echo.Close()
+	proxy, addrs := testProxy(t, echo.Addr().String(), serveHTTPConnect)
+	defer proxy.Close()
+
+	// The proxy's loopback address is allowed, but the hosts dialed
+	// through it are resolved and restricted locally.
+	d := &Dialer{
+		Timeout:    5 * time.Second,
+		PublicOnly: true,
+		Resolver: StaticResolver{
+			"public.test":   {net.IPv4(8, 8, 8, 8)},
+			"internal.test": {net.IPv4(10, 0, 0, 1)},
+		},
+		Proxy: ProxyURL(&url.URL{
+			Scheme: "http",
+			User:   url.UserPassword("user", "pass"),
+			Host:   proxy.Addr().String(),
+		}),
+	}
+	c, err := d.Dial("tcp", "public.test:80")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Close()
+	if addr := <-addrs; addr != "8.8.8.8:80" {
+		t.Fatalf("proxied address: expected 8.8.8.8:80; got %s", addr)
+	}
+	for _, addr := range []string{"internal.test:80", "127.0.0.1:80", "[64:ff9b::a00:1]:80"} {
+		_, err := d.Dial("tcp", addr)
+		if derr, ok := err.(*DialError); !ok || derr.Unwrap() != ErrNonPublicAddress {
+			t.Errorf("%s: expected ErrNonPublicAddress; got %v", addr, err)
+		}
+	}
+	select {
+	case addr := <-addrs:
+		t.Fatalf("unexpected proxied address: %s", addr)
+	default:
+	}
+}
+
+func TestDialSOCKSProxy(t *testing.T) {
+	testDialProxy(t, "socks5", func(c net.Conn, br *bufio.Reader) (string, error) {
+		b := make([]byte, 2)
+		if _, err := io.ReadFull(br, b); err != nil {
+			return "", err
+		}
+		if _, err := io.ReadFull(br, make([]byte, b[1])); err != nil {
+			return "", err
+		}
+		c.Write([]byte{0x05, 0x02})
+		// Username and password.
+		if _, err := io.ReadFull(br, b); err != nil {
+			return "", err
+		}
+		user := make([]byte, b[1])
+		if _, err := io.ReadFull(br, user); err != nil {
+			return "", err
+		}
+		if _, err := io.ReadFull(br, b[:1]); err != nil {
+			return "", err
+		}
+		pass := make([]byte, b[0])
+		if _, err := io.ReadFull(br, pass); err != nil {
+			return "", err
+		}
+		if string(user) != "user" || string(pass) != "pass" {
+			c.Write([]byte{0x01, 0x01})
+			return "", io.EOF
+		}
+		c.Write([]byte{0x01, 0x00})
+		// Connect request with a domain name.
+		req := make([]byte, 5)
+		if _, err := io.ReadFull(br, req); err != nil {
+			return "", err
+		}
+		if req[1] != 0x01 || req[3] != 0x03 {
+			return "", io.EOF
+		}
+		host := make([]byte, req[4]+2)
+		if _, err := io.ReadFull(br, host); err != nil {
+			return "", err
+		}
+		port := int(host[len(host)-2])<<8 | int(host[len(host)-1])
+		c.Write([]byte{0x05, 0x00, 0x00, 0x01, 127, 0, 0, 1, 0, 0})
+		return net.JoinHostPort(string(host[:len(host)-2]), strconv.Itoa(port)), nil
+	})
+}
@@ -0,0 +1,210 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"container/list"
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// used by tests
+var (
+	lookupMX    = net.DefaultResolver.LookupMX
+	lookupTXT   = net.DefaultResolver.LookupTXT
+	lookupNS    = net.DefaultResolver.LookupNS
+	lookupCNAME = net.DefaultResolver.LookupCNAME
+)
+
+// A RecordResolver looks up DNS records other than addresses,
+// using the local resolver, and caches the results like a
+// CacheResolver. Concurrent lookups of the same record share
+// a single query. Its methods are safe for concurrent use.
+type RecordResolver struct {
+	// TTL is the time to live for resolved records.
+	// If TTL is zero, cached records do not expire.
+	TTL time.Duration
+
+	// NegativeTTL is the time to live for records that failed
+	// to resolve. Cancelled lookups are not cached.
+	// If NegativeTTL is zero, failures are not cached.
+	NegativeTTL time.Duration
+
+	// MaxEntries is the maximum number of cached records.
+	// When the cache is full, the record that was resolved
+	// least recently is evicted.
+	// If MaxEntries is zero, the cache size is not limited.
+	MaxEntries int
+
+	mu    sync.Mutex
+	cache map[recordKey]*recordItem
+	order *list.List // of keys, least recently resolved first
+	calls map[recordKey]*recordCall
+}
+
+// A recordKey identifies a cached record by its type and name.
+type recordKey struct {
+	typ  string
+	name string
+}
+
+type recordItem struct {
+	val  interface{}
+	err  error // non-nil if the lookup failed
+	ttl  time.Time
+	elem *list.Element
+}
+
+// A recordCall is a lookup in progress that's shared by callers.
+type recordCall struct {
+	done     chan struct{}
+	item     *recordItem
+	err      error
+	canceled bool // the caller that made the lookup gave up
+}
+
+// LookupMX returns the MX records of name, sorted by preference.
+func (r *RecordResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	val, err := r.lookup(ctx, recordKey{"MX", name}, func(ctx context.Context) (interface{}, error) {
+		return lookupMX(ctx, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	mxs := make([]*net.MX, len(val.([]*net.MX)))
+	for i, mx := range val.([]*net.MX) {
+		v := *mx
+		mxs[i] = &v
+	}
+	return mxs, nil
+}
+
+// LookupTXT returns the TXT records of name.
+func (r *RecordResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	val, err := r.lookup(ctx, recordKey{"TXT", name}, func(ctx context.Context) (interface{}, error) {
+		return lookupTXT(ctx, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	txts := make([]string, len(val.([]string)))
+	copy(txts, val.([]string))
+	return txts, nil
+}
+
+// LookupNS returns the NS records of name.
+func (r *RecordResolver) LookupNS(ctx context.Context, name string) ([]*net.NS, error) {
+	val, err := r.lookup(ctx, recordKey{"NS", name}, func(ctx context.Context) (interface{}, error) {
+		return lookupNS(ctx, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	nss := make([]*net.NS, len(val.([]*net.NS)))
+	for i, ns := range val.([]*net.NS) {
+		v := *ns
+		nss[i] = &v
+	}
+	return nss, nil
+}
+
+// LookupCNAME returns the canonical name of name.
+func (r *RecordResolver) LookupCNAME(ctx context.Context, name string) (string, error) {
+	val, err := r.lookup(ctx, recordKey{"CNAME", name}, func(ctx context.Context) (interface{}, error) {
+		return lookupCNAME(ctx, name)
+	})
+	if err != nil {
+		return "", err
+	}
+	return val.(string), nil
+}
+
+// Invalidate removes the cached records of name.
+func (r *RecordResolver) Invalidate(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, typ := range []string{"MX", "TXT", "NS", "CNAME"} {
+		key := recordKey{typ, name}
+		if item, ok := r.cache[key]; ok {
+			r.order.Remove(item.elem)
+			delete(r.cache, key)
+		}
+	}
+}
+
+// lookup returns the cached value of key or looks it up with fn,
+// sharing the lookup with concurrent callers.
+func (r *RecordResolver) lookup(ctx context.Context, key recordKey, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	for {
+		now := timeNow()
+		r.mu.Lock()
+		if item, ok := r.cache[key]; ok && (item.ttl.IsZero() || now.Before(item.ttl)) {
+			r.mu.Unlock()
+			return item.val, item.err
+		}
+		if c, ok := r.calls[key]; ok {
+			r.mu.Unlock()
+			select {
+			case <-c.done:
+			case <-ctx.Done():
+				return nil, contextError(ctx.Err())
+			}
+			if c.canceled {
+				// Its caller's context doesn't apply to this one.
+				continue
+			}
+			if c.item == nil {
+				return nil, c.err
+			}
+			return c.item.val, c.item.err
+		}
+		c := &recordCall{done: make(chan struct{})}
+		if r.calls == nil {
+			r.calls = make(map[recordKey]*recordCall)
+		}
+		r.calls[key] = c
+		r.mu.Unlock()
+
+		val, err := fn(ctx)
+		switch {
+		case err == nil:
+			c.item = &recordItem{val: val, ttl: expiry(now, r.TTL)}
+		case r.NegativeTTL > 0 && ctx.Err() == nil:
+			c.item = &recordItem{err: err, ttl: now.Add(r.NegativeTTL)}
+		default:
+			c.err = err
+			c.canceled = ctx.Err() != nil
+		}
+		r.mu.Lock()
+		delete(r.calls, key)
+		if c.item != nil {
+			r.store(key, c.item)
+		}
+		r.mu.Unlock()
+		close(c.done)
+		return val, err
+	}
+}
+
+// store caches item for key. If the cache is full, the least
+// recently stored record is evicted. It must be called with
+// r.mu held.
+func (r *RecordResolver) store(key recordKey, item *recordItem) {
+	if r.cache == nil {
+		r.cache = make(map[recordKey]*recordItem)
+		r.order = list.New()
+	}
+	if old, ok := r.cache[key]; ok {
+		r.order.Remove(old.elem)
+	} else if r.MaxEntries > 0 && len(r.cache) >= r.MaxEntries {
+		oldest := r.order.Front()
+		r.order.Remove(oldest)
+		delete(r.cache, oldest.Value.(recordKey))
+	}
+	item.elem = r.order.PushBack(key)
+	r.cache[key] = item
+}
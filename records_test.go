@@ -0,0 +1,109 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecordResolver(t *testing.T) {
+	defer func(mxFn func(context.Context, string) ([]*net.MX, error), txtFn func(context.Context, string) ([]string, error), timeFn func() time.Time) {
+		lookupMX = mxFn
+		lookupTXT = txtFn
+		timeNow = timeFn
+	}(lookupMX, lookupTXT, timeNow)
+	lookups := 0
+	errNX := errors.New("no such host")
+	lookupMX = func(_ context.Context, name string) ([]*net.MX, error) {
+		lookups++
+		if name == "foo.test" {
+			return []*net.MX{{Host: "mx.foo.test.", Pref: 10}}, nil
+		}
+		return nil, errNX
+	}
+	lookupTXT = func(_ context.Context, name string) ([]string, error) {
+		lookups++
+		return []string{"v=spf1 -all"}, nil
+	}
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+
+	ctx := context.Background()
+	r := &RecordResolver{TTL: time.Minute, NegativeTTL: time.Second, MaxEntries: 2}
+	validate := func(name string, want []*net.MX, wantErr error, wantLookups int) {
+		mxs, err := r.LookupMX(ctx, name)
+		if err != wantErr || !reflect.DeepEqual(mxs, want) {
+			t.Fatalf("%v: expected %v, %v; got %v, %v", name, want, wantErr, mxs, err)
+		}
+		if lookups != wantLookups {
+			t.Fatalf("lookups: expected %d; got %d", wantLookups, lookups)
+		}
+	}
+	foo := []*net.MX{{Host: "mx.foo.test.", Pref: 10}}
+	validate("foo.test", foo, nil, 1)  // lookup
+	validate("foo.test", foo, nil, 1)  // cached
+	now = now.Add(time.Minute)         // expire
+	validate("foo.test", foo, nil, 2)  // lookup
+	validate("nx.test", nil, errNX, 3) // lookup
+	validate("nx.test", nil, errNX, 3) // cached failure
+
+	// Records of each type are cached separately.
+	txts, err := r.LookupTXT(ctx, "foo.test") // lookup, evicts foo's MX
+	if err != nil || !reflect.DeepEqual(txts, []string{"v=spf1 -all"}) {
+		t.Fatalf("TXT: unexpected result: %v, %v", txts, err)
+	}
+	validate("foo.test", foo, nil, 5) // lookup, evicts nx
+	r.Invalidate("foo.test")
+	validate("foo.test", foo, nil, 6) // lookup
+}
+
+func TestRecordResolverShared(t *testing.T) {
+	defer func(fn func(context.Context, string) (string, error)) { lookupCNAME = fn }(lookupCNAME)
+	var (
+		mu      sync.Mutex
+		lookups int
+	)
+	release := make(chan struct{})
+	lookupCNAME = func(ctx context.Context, name string) (string, error) {
+		mu.Lock()
+		lookups++
+		mu.Unlock()
+		select {
+		case <-release:
+			return "bar.test.", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	r := &RecordResolver{}
+	// The first caller gives up; the others' lookup continues.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(ctx context.Context) {
+			defer wg.Done()
+			if cname, err := r.LookupCNAME(ctx, "foo.test"); err != nil || cname != "bar.test." {
+				t.Errorf("unexpected result: %v, %v", cname, err)
+			}
+		}(context.Background())
+	}
+	if _, err := r.LookupCNAME(ctx, "foo.test"); err == nil {
+		t.Fatal("expected error after the deadline")
+	}
+	close(release)
+	wg.Wait()
+	if lookups > 2 {
+		t.Fatalf("lookups: expected at most 2; got %d", lookups)
+	}
+}
@@ -5,6 +5,8 @@
 package nett
 
 import (
+	"container/list"
+	"context"
 	"errors"
 	"net"
 	"sync"
@@ -15,8 +17,22 @@ var (
 	ErrMissingAddress    = errors.New("missing address")
 	ErrNoSuitableAddress = errors.New("no suitable address found")
 
-	lookupIPs = net.LookupIP // used by tests
-	timeNow   = time.Now     // used by tests
+	// ErrNonPublicAddress is returned by a Dialer with PublicOnly
+	// set when the address doesn't resolve to a public address.
+	ErrNonPublicAddress = errors.New("address is not public")
+
+	// ErrResolveTimeout is returned by a dial whose deadline or
+	// ResolveTimeout passes while resolving the address. Its
+	// Timeout method returns true.
+	ErrResolveTimeout error = &timeoutError{op: "resolve"}
+
+	// ErrConnectTimeout is returned by a dial whose deadline or
+	// AddrTimeout passes while connecting to a resolved address.
+	// Its Timeout method returns true.
+	ErrConnectTimeout error = &timeoutError{op: "connect"}
+
+	lookupIPs = lookupIPContext // used by tests
+	timeNow   = time.Now        // used by tests
 )
 
 // Resolver is an interface representing the ability to lookup the
@@ -26,9 +42,175 @@ var (
 // A Resolver must be safe for concurrent use by multiple goroutines.
 type Resolver interface {
 	// Resolve looks up the given host and returns its IP addresses.
+	//
+	// Deprecated: Resolve can't be cancelled. Resolvers should
+	// also implement ResolverContext, which is used instead when
+	// it is available.
 	Resolve(host string) ([]net.IP, error)
 }
 
+// ResolverContext is implemented by a Resolver that can be cancelled
+// by a context. Lookups by a Resolver that doesn't implement it can't
+// be cancelled and continue to run after a dial's deadline has passed,
+// so new Resolvers should implement it.
+type ResolverContext interface {
+	// ResolveContext looks up the given host using the provided
+	// context and returns its IP addresses. The network is a hint
+	// of the address family that will be used: "ip", "ip4", or
+	// "ip6". The results may include other families regardless.
+	ResolveContext(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+// ResolverDeadline is implemented by a Resolver that can't be
+// cancelled by a context but can bound its lookups by a deadline.
+// It's used instead of Resolve when the lookup has a deadline and
+// the Resolver doesn't implement ResolverContext, so that the lookup
+// doesn't outlive it.
+type ResolverDeadline interface {
+	// ResolveDeadline looks up the given host and returns its
+	// IP addresses, failing if the deadline passes first.
+	ResolveDeadline(host string, deadline time.Time) ([]net.IP, error)
+}
+
+// Addrs are the IP addresses of a host with metadata about them.
+type Addrs struct {
+	IPs []net.IP
+
+	// TTL is the length of time for which the addresses may be
+	// cached. Zero means it's unknown.
+	TTL time.Duration
+
+	// Source describes where the addresses came from, such as
+	// SourceNetwork. Empty means it's unknown.
+	Source string
+}
+
+// Sources of Addrs.
+const (
+	SourceCache   = "cache"   // a cache of earlier lookups
+	SourceNetwork = "network" // a lookup using the network
+	SourceStatic  = "static"  // a StaticResolver
+	SourceHosts   = "hosts"   // a hosts file
+)
+
+// ResolverAddrs is implemented by a Resolver that reports the TTL
+// and source of the addresses it returns. A CacheResolver caches
+// addresses for no longer than their TTL if its Resolver implements
+// ResolverAddrs.
+type ResolverAddrs interface {
+	// ResolveAddrs looks up the given host using the provided
+	// context and returns its IP addresses with their metadata.
+	// The network is a hint as for ResolveContext.
+	ResolveAddrs(ctx context.Context, network, host string) (Addrs, error)
+}
+
+// FailureReporter is implemented by a Resolver that accepts reports
+// of failed attempts to dial the IP addresses it returned, such as
+// to avoid returning them again. A Dialer reports failures to its
+// Resolver if it implements FailureReporter.
+type FailureReporter interface {
+	// ReportFailure reports that dialing ip, which was
+	// resolved from host, failed.
+	ReportFailure(host string, ip net.IP)
+}
+
+// resolveContext looks up the host with resolver. If resolver doesn't
+// implement ResolverContext, the lookup is abandoned when ctx is done.
+func resolveContext(ctx context.Context, resolver Resolver, network, host string) ([]net.IP, error) {
+	return resolveContextLate(ctx, resolver, network, host, nil)
+}
+
+// resolveAddrs looks up the host with resolver, returning the
+// metadata of its addresses if resolver implements ResolverAddrs.
+// Otherwise it's like resolveContextLate.
+func resolveAddrs(ctx context.Context, resolver Resolver, network, host string, late func(Addrs, error)) (Addrs, error) {
+	if r, ok := resolver.(ResolverAddrs); ok {
+		addrs, err := r.ResolveAddrs(ctx, network, host)
+		if err != nil && ctx.Err() != nil {
+			return Addrs{}, contextError(ctx.Err())
+		}
+		return addrs, err
+	}
+	var lateIPs func([]net.IP, error)
+	if late != nil {
+		lateIPs = func(ips []net.IP, err error) {
+			late(Addrs{IPs: ips}, err)
+		}
+	}
+	ips, err := resolveContextLate(ctx, resolver, network, host, lateIPs)
+	return Addrs{IPs: ips}, err
+}
+
+// resolveContextLate is like resolveContext, but if the lookup is
+// abandoned, late is called with its results when they arrive,
+// unless it's nil.
+func resolveContextLate(ctx context.Context, resolver Resolver, network, host string, late func([]net.IP, error)) ([]net.IP, error) {
+	if r, ok := resolver.(ResolverContext); ok {
+		ips, err := r.ResolveContext(ctx, network, host)
+		if err != nil && ctx.Err() != nil {
+			// Report cancellation consistently across resolvers.
+			return nil, contextError(ctx.Err())
+		}
+		return ips, err
+	}
+	lookup := func() ([]net.IP, error) {
+		return resolver.Resolve(host)
+	}
+	if r, ok := resolver.(ResolverDeadline); ok {
+		if deadline, ok := ctx.Deadline(); ok {
+			lookup = func() ([]net.IP, error) {
+				return r.ResolveDeadline(host, deadline)
+			}
+		}
+	}
+	return waitLookup(ctx, lookup, late)
+}
+
+// waitLookup runs lookup and waits for its results. If ctx is done
+// first, lookup is abandoned to finish in the background, and late
+// is called with its results, unless it's nil.
+func waitLookup(ctx context.Context, lookup func() ([]net.IP, error), late func([]net.IP, error)) ([]net.IP, error) {
+	if ctx.Done() == nil {
+		return lookup()
+	}
+	type res struct {
+		ips []net.IP
+		err error
+	}
+	var (
+		mu        sync.Mutex
+		abandoned bool
+	)
+	resc := make(chan res, 1)
+	go func() {
+		ips, err := lookup()
+		mu.Lock()
+		defer mu.Unlock()
+		if abandoned {
+			if late != nil {
+				late(ips, err)
+			}
+			return
+		}
+		resc <- res{ips, err}
+	}()
+	select {
+	case <-ctx.Done():
+		mu.Lock()
+		defer mu.Unlock()
+		select {
+		case r := <-resc:
+			// The results arrived in time after all.
+			return r.ips, r.err
+		default:
+		}
+		abandoned = true
+		return nil, contextError(ctx.Err())
+	case r := <-resc:
+		return r.ips, r.err
+	}
+}
+
 // DefaultResolver is the default Resolver.
 var DefaultResolver Resolver = defaultResolver{}
 
@@ -38,71 +220,245 @@ type defaultResolver struct{}
 // Resolve looks up the given host using the local resolver.
 // It returns an array of that host's IPv4 and IPv6 addresses.
 func (defaultResolver) Resolve(host string) ([]net.IP, error) {
-	return lookupIPs(host)
+	return lookupIPs(context.Background(), host)
+}
+
+// ResolveContext looks up the given host using the local resolver
+// and the provided context.
+// It returns an array of that host's IPv4 and IPv6 addresses.
+func (defaultResolver) ResolveContext(ctx context.Context, network, host string) ([]net.IP, error) {
+	return lookupIPs(ctx, host)
+}
+
+// ResolveAddrs looks up the given host using the local resolver
+// and the provided context. The TTL of the addresses is unknown.
+func (defaultResolver) ResolveAddrs(ctx context.Context, network, host string) (Addrs, error) {
+	ips, err := lookupIPs(ctx, host)
+	if err != nil {
+		return Addrs{}, err
+	}
+	return Addrs{IPs: ips, Source: SourceNetwork}, nil
+}
+
+// lookupIPContext looks up host using the local resolver.
+func lookupIPContext(ctx context.Context, host string) ([]net.IP, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	return ips, nil
 }
 
 // CacheResolver looks up the IP addresses of a host
-// and caches successful results.
+// and caches successful results. Failed lookups are
+// cached if NegativeTTL is set.
 type CacheResolver struct {
 	// Resolver resolves hosts that are not cached.
 	// If Resolver is nil, DefaultResolver will be used.
 	Resolver Resolver
-	// TTL is the time to live for resolved hosts.
-	// If TTL is zero, cached hosts do not expire.
+	// TTL is the time to live for resolved hosts. If Resolver
+	// reports a shorter TTL for a host's addresses, as by
+	// ResolverAddrs, it's used instead.
+	// If TTL is zero, cached hosts do not expire unless
+	// Resolver reports a TTL.
 	TTL time.Duration
+	// RefreshAhead is how long before a host expires that it's
+	// resolved again in the background when it's used. Hosts that
+	// are in use are kept fresh, so resolving them doesn't block.
+	// If RefreshAhead is zero, hosts are resolved when they expire.
+	RefreshAhead time.Duration
+	// NegativeTTL is the time to live for hosts that failed
+	// to resolve. Cancelled lookups are not cached.
+	// If NegativeTTL is zero, failures are not cached.
+	NegativeTTL time.Duration
+	// MaxEntries is the maximum number of cached hosts.
+	// When the cache is full, the host that was resolved
+	// least recently is evicted. With a constant TTL, it's
+	// the host that expires first.
+	// If MaxEntries is zero, the cache size is not limited.
+	MaxEntries int
 
 	mu    sync.RWMutex
 	cache map[string]*cacheItem
+	order *list.List // hosts from least to most recently stored
+	stats cacheStats
 }
 
 type cacheItem struct {
-	ips []net.IP
-	ttl time.Time
+	ips    []net.IP
+	err    error // non-nil if the lookup failed
+	ttl    time.Time
+	source string        // of the addresses when they were resolved
+	elem   *list.Element // position of the host in order
+
+	refreshing bool // guarded by CacheResolver.mu
 }
 
 // Resolve returns a host's IP addresses.
 func (r *CacheResolver) Resolve(host string) ([]net.IP, error) {
+	return r.ResolveContext(context.Background(), "ip", host)
+}
+
+// ResolveContext returns a host's IP addresses using the provided
+// context if the host is not cached. Addresses of all families are
+// cached regardless of the network.
+func (r *CacheResolver) ResolveContext(ctx context.Context, network, host string) ([]net.IP, error) {
+	addrs, err := r.ResolveAddrs(ctx, network, host)
+	return addrs.IPs, err
+}
+
+// ResolveAddrs returns a host's IP addresses using the provided
+// context if the host is not cached. The source of cached addresses
+// is SourceCache and their TTL is the time left until they expire.
+func (r *CacheResolver) ResolveAddrs(ctx context.Context, network, host string) (Addrs, error) {
+	now := timeNow()
 	r.mu.RLock()
-	if item, ok := r.cache[host]; ok {
-		if item.ttl.IsZero() || timeNow().Before(item.ttl) {
-			r.mu.RUnlock()
-			ips := make([]net.IP, len(item.ips))
-			copy(ips, item.ips)
-			return ips, nil
+	item, ok := r.cache[host]
+	r.mu.RUnlock()
+	source := SourceCache
+	if !ok || !item.fresh(now) {
+		r.stats.add(func(s *CacheStats) { s.Misses++ })
+		var err error
+		if item, err = r.update(ctx, host, true); err != nil {
+			return Addrs{}, err
+		}
+		source = item.source
+	} else {
+		r.stats.add(func(s *CacheStats) { s.Hits++ })
+		if r.RefreshAhead > 0 && !item.ttl.IsZero() && item.ttl.Sub(now) <= r.RefreshAhead {
+			r.refreshAhead(host, item)
 		}
 	}
-	r.mu.RUnlock()
+	if item.err != nil {
+		return Addrs{}, item.err
+	}
+	addrs := Addrs{IPs: make([]net.IP, len(item.ips)), Source: source}
+	copy(addrs.IPs, item.ips)
+	if !item.ttl.IsZero() {
+		addrs.TTL = item.ttl.Sub(now)
+	}
+	return addrs, nil
+}
 
+// fresh reports whether the item has not expired at the given time.
+func (item *cacheItem) fresh(now time.Time) bool {
+	return item.ttl.IsZero() || now.Before(item.ttl)
+}
+
+// update resolves host and caches the results. A failure is
+// cached if cacheErr is true and NegativeTTL is set.
+func (r *CacheResolver) update(ctx context.Context, host string, cacheErr bool) (*cacheItem, error) {
 	resolver := r.Resolver
 	if resolver == nil {
 		resolver = DefaultResolver
 	}
-	ips, err := resolver.Resolve(host)
+	// Keep the results of a lookup that outlived its caller,
+	// so that its work isn't wasted.
+	late := func(addrs Addrs, err error) {
+		if err == nil {
+			r.storeAddrs(host, addrs)
+		}
+	}
+	r.stats.add(func(s *CacheStats) { s.InFlight++ })
+	addrs, err := resolveAddrs(ctx, resolver, "ip", host, late)
+	r.stats.add(func(s *CacheStats) {
+		s.InFlight--
+		if err != nil {
+			s.Errors++
+		}
+	})
 	if err != nil {
+		if cacheErr && r.NegativeTTL > 0 && ctx.Err() == nil {
+			item := &cacheItem{err: err, ttl: timeNow().Add(r.NegativeTTL)}
+			r.mu.Lock()
+			r.store(host, item)
+			r.mu.Unlock()
+		}
 		return nil, err
 	}
+	return r.storeAddrs(host, addrs), nil
+}
 
-	var ttl time.Time
-	if r.TTL > 0 {
-		ttl = timeNow().Add(r.TTL)
+// storeAddrs caches the addresses resolved for host.
+func (r *CacheResolver) storeAddrs(host string, addrs Addrs) *cacheItem {
+	ttl := r.TTL
+	if addrs.TTL > 0 && (ttl <= 0 || addrs.TTL < ttl) {
+		ttl = addrs.TTL
 	}
-	item := &cacheItem{ips, ttl}
+	var expires time.Time
+	if ttl > 0 {
+		expires = timeNow().Add(ttl)
+	}
+	item := &cacheItem{ips: addrs.IPs, ttl: expires, source: addrs.Source}
 	r.mu.Lock()
+	r.store(host, item)
+	r.mu.Unlock()
+	return item
+}
+
+// store caches item for host. If the cache is full, the least
+// recently stored host is evicted. It must be called with r.mu held.
+func (r *CacheResolver) store(host string, item *cacheItem) {
 	if r.cache == nil {
 		r.cache = make(map[string]*cacheItem)
+		r.order = list.New()
+	}
+	if old, ok := r.cache[host]; ok {
+		r.order.Remove(old.elem)
+	} else if r.MaxEntries > 0 && len(r.cache) >= r.MaxEntries {
+		oldest := r.order.Front()
+		r.order.Remove(oldest)
+		delete(r.cache, oldest.Value.(string))
+		r.stats.add(func(s *CacheStats) { s.Evictions++ })
 	}
+	item.elem = r.order.PushBack(host)
 	r.cache[host] = item
-	r.mu.Unlock()
+}
+
+// ResolveAddrs resolves the address on the named network to the
+// addresses selected by filter, as a Dialer would before dialing.
+// The returned addresses are *net.TCPAddr, *net.UDPAddr, *net.IPAddr
+// or *net.UnixAddr values, depending on the network.
+//
+// If resolver is nil, DefaultResolver is used. If filter is nil,
+// all of the supported addresses are selected.
+func ResolveAddrs(resolver Resolver, filter Filter, network, address string) ([]net.Addr, error) {
+	return ResolveAddrsContext(context.Background(), resolver, filter, network, address)
+}
 
-	ips = make([]net.IP, len(item.ips))
-	copy(ips, item.ips)
-	return ips, err
+// ResolveAddrsContext resolves the address on the named network using
+// the provided context to the addresses selected by filter.
+//
+// See func ResolveAddrs for a description of the parameters.
+func ResolveAddrsContext(ctx context.Context, resolver Resolver, filter Filter, network, address string) ([]net.Addr, error) {
+	var f ipFilter
+	if filter != nil {
+		host := hostOf(address)
+		f = func(ips []net.IP) []net.IP {
+			return filter.Filter(network, host, ips)
+		}
+	}
+	list, err := resolveAddrList(ctx, resolver, f, false, network, address)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]net.Addr, list.Len())
+	for i := range addrs {
+		addrs[i] = list.Addr(i)
+	}
+	return addrs, nil
 }
 
 // ipFilter selects IP addresses from ips.
 type ipFilter func(ips []net.IP) []net.IP
 
-func resolveAddrList(resolver Resolver, filter ipFilter, network, address string) (addrList, error) {
+// If v4mapped is true, IPv4-mapped IPv6 addresses are kept on IPv6
+// networks where the platform supports them.
+func resolveAddrList(ctx context.Context, resolver Resolver, filter ipFilter, v4mapped bool, network, address string) (addrList, error) {
 	nett, err := parseNetwork(network)
 	if err != nil {
 		return nil, err
@@ -114,10 +470,10 @@ func resolveAddrList(resolver Resolver, filter ipFilter, network, address string
 	case "unix", "unixgram", "unixpacket":
 		return unixList{&net.UnixAddr{Name: address, Net: nett}}, nil
 	}
-	return resolveInternetAddrList(resolver, filter, nett, address)
+	return resolveInternetAddrList(ctx, resolver, filter, v4mapped, nett, address)
 }
 
-func resolveInternetAddrList(resolver Resolver, filter ipFilter, network, address string) (addrList, error) {
+func resolveInternetAddrList(ctx context.Context, resolver Resolver, filter ipFilter, v4mapped bool, network, address string) (addrList, error) {
 	host, port, err := parseHostPort(network, address)
 	if err != nil {
 		return nil, err
@@ -157,24 +513,32 @@ func resolveInternetAddrList(resolver Resolver, filter ipFilter, network, addres
 	} else if ip, zone = parseIPv6(host, true); ip != nil {
 		ips = []net.IP{ip}
 	} else {
-		// Try as a DNS name.
 		host, zone = splitHostZone(host)
 		if !isDomainName(host) {
 			return nil, &net.DNSError{Err: "invalid domain name", Name: host}
 		}
+	}
+	afnet := ipNetwork(network, zone)
+	if ips == nil {
+		// Try as a DNS name.
 		if resolver == nil {
 			resolver = DefaultResolver
 		}
-		ips, err = resolver.Resolve(host)
+		ips, err = resolveContext(ctx, resolver, afnet, host)
 		if err != nil {
 			return nil, err
 		}
 	}
-	supported := supportedIP
-	if network[len(network)-1] == '4' {
-		supported = ipv4only
-	} else if network[len(network)-1] == '6' || zone != "" {
-		supported = ipv6only
+	stack := loadIPStack()
+	supported := stack.supportedIP
+	switch afnet {
+	case "ip4":
+		supported = stack.ipv4only
+	case "ip6":
+		supported = stack.ipv6only
+		if v4mapped {
+			supported = stack.ipv6orMapped
+		}
 	}
 	ips = filterIPs(supported, ips)
 	if filter != nil {
@@ -186,6 +550,18 @@ func resolveInternetAddrList(resolver Resolver, filter ipFilter, network, addres
 	return ctor(ips...), nil
 }
 
+// ipNetwork returns the IP network of the address family
+// required by the network and zone: "ip", "ip4", or "ip6".
+func ipNetwork(network, zone string) string {
+	switch {
+	case network[len(network)-1] == '4':
+		return "ip4"
+	case network[len(network)-1] == '6' || zone != "":
+		return "ip6"
+	}
+	return "ip"
+}
+
 func parseNetwork(network string) (string, error) {
 	i := last(network, ':')
 	if i < 0 { // no colon
@@ -202,11 +578,11 @@ func parseNetwork(network string) (string, error) {
 	nett := network[:i]
 	switch nett {
 	case "ip", "ip4", "ip6":
-		// Don't bother validating the protocol. The consequence of this is that
-		// an invalid protocol will fail at dial-time instead of resolve-time.
-		// A case might be made for doing it here like the net package does,
-		// but the cost of duplicating that logic from the standard library
-		// doesn't currently seem justified.
+		// Validate the protocol here, like the net package does, so that
+		// an invalid protocol fails at resolve-time instead of dial-time.
+		if _, err := lookupProtocol(network[i+1:]); err != nil {
+			return "", net.UnknownNetworkError(network)
+		}
 		return nett, nil
 	}
 	return "", net.UnknownNetworkError(network)
@@ -244,7 +620,7 @@ func parsePort(network, port string) (int, error) {
 		}
 	}
 	if p < 0 || p > 0xFFFF {
-		return 0, &net.AddrError{"invalid port", port}
+		return 0, &net.AddrError{Err: "invalid port", Addr: port}
 	}
 	return p, nil
 }
@@ -460,23 +836,3 @@ func isDomainName(s string) bool {
 
 	return ok
 }
-
-// ipv4only returns IPv4 addresses that we can use with the kernel's
-// IPv4 addressing modes. If ip is an IPv4 address, ipv4only returns ip.
-// Otherwise it returns nil.
-func ipv4only(ip net.IP) net.IP {
-	if supportsIPv4 {
-		return ip.To4()
-	}
-	return nil
-}
-
-// ipv6only returns IPv6 addresses that we can use with the kernel's
-// IPv6 addressing modes.  It returns IPv4-mapped IPv6 addresses as
-// nils and returns other IPv6 address types as IPv6 addresses.
-func ipv6only(ip net.IP) net.IP {
-	if supportsIPv6 && len(ip) == net.IPv6len && ip.To4() == nil {
-		return ip
-	}
-	return nil
-}
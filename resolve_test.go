@@ -5,6 +5,7 @@
 package nett
 
 import (
+	"context"
 	"net"
 	"reflect"
 	"strings"
@@ -49,22 +50,20 @@ func init() {
 }
 
 func TestResolveTCP(t *testing.T) {
-	defer func(fn func(string) ([]net.IP, error), ipv4, ipv6 bool) {
+	defer func(fn func(context.Context, string) ([]net.IP, error)) {
 		lookupIPs = fn
-		supportsIPv4 = ipv4
-		supportsIPv6 = ipv6
-	}(lookupIPs, supportsIPv4, supportsIPv6)
+		Reprobe()
+	}(lookupIPs)
 	var ips []net.IP
-	lookupIPs = func(host string) ([]net.IP, error) {
+	lookupIPs = func(ctx context.Context, host string) ([]net.IP, error) {
 		clone := make([]net.IP, len(ips))
 		copy(clone, ips)
 		return clone, nil
 	}
 	for i, ta := range testTCPAddrs {
 		ips = ta.ips
-		supportsIPv4 = ta.ipv4
-		supportsIPv6 = ta.ipv6
-		addrs, err := resolveAddrList(nil, nil, ta.net, ta.addr)
+		SetIPStack(ta.ipv4, ta.ipv6, false)
+		addrs, err := resolveAddrList(context.Background(), nil, nil, false, ta.net, ta.addr)
 		if err != ta.err {
 			t.Errorf("test %d: expecting error: %v\ngot: error: %v\n", i, ta.err, err)
 		} else if err == nil && addrs.Len() == 0 {
@@ -74,22 +73,20 @@ func TestResolveTCP(t *testing.T) {
 }
 
 func TestResolveUDP(t *testing.T) {
-	defer func(fn func(string) ([]net.IP, error), ipv4, ipv6 bool) {
+	defer func(fn func(context.Context, string) ([]net.IP, error)) {
 		lookupIPs = fn
-		supportsIPv4 = ipv4
-		supportsIPv6 = ipv6
-	}(lookupIPs, supportsIPv4, supportsIPv6)
+		Reprobe()
+	}(lookupIPs)
 	var ips []net.IP
-	lookupIPs = func(host string) ([]net.IP, error) {
+	lookupIPs = func(ctx context.Context, host string) ([]net.IP, error) {
 		clone := make([]net.IP, len(ips))
 		copy(clone, ips)
 		return clone, nil
 	}
 	for _, ta := range testUDPAddrs {
 		ips = ta.ips
-		supportsIPv4 = ta.ipv4
-		supportsIPv6 = ta.ipv6
-		addrs, err := resolveAddrList(nil, nil, ta.net, ta.addr)
+		SetIPStack(ta.ipv4, ta.ipv6, false)
+		addrs, err := resolveAddrList(context.Background(), nil, nil, false, ta.net, ta.addr)
 		if err != ta.err {
 			t.Errorf("test: %#v\nexpecting error: %v\ngot error: %v\n", ta, ta.err, err)
 		} else if err == nil && addrs.Len() == 0 {
@@ -99,22 +96,20 @@ func TestResolveUDP(t *testing.T) {
 }
 
 func TestResolveIP(t *testing.T) {
-	defer func(fn func(string) ([]net.IP, error), ipv4, ipv6 bool) {
+	defer func(fn func(context.Context, string) ([]net.IP, error)) {
 		lookupIPs = fn
-		supportsIPv4 = ipv4
-		supportsIPv6 = ipv6
-	}(lookupIPs, supportsIPv4, supportsIPv6)
+		Reprobe()
+	}(lookupIPs)
 	var ips []net.IP
-	lookupIPs = func(host string) ([]net.IP, error) {
+	lookupIPs = func(ctx context.Context, host string) ([]net.IP, error) {
 		clone := make([]net.IP, len(ips))
 		copy(clone, ips)
 		return clone, nil
 	}
 	for _, ta := range testIPAddrs {
 		ips = ta.ips
-		supportsIPv4 = ta.ipv4
-		supportsIPv6 = ta.ipv6
-		addrs, err := resolveAddrList(nil, nil, ta.net, ta.addr)
+		SetIPStack(ta.ipv4, ta.ipv6, false)
+		addrs, err := resolveAddrList(context.Background(), nil, nil, false, ta.net, ta.addr)
 		if err != ta.err {
 			t.Errorf("test: %#v\nexpecting error: %v\ngot error: %v\n", ta, ta.err, err)
 		} else if err == nil && addrs.Len() == 0 {
@@ -123,14 +118,47 @@ func TestResolveIP(t *testing.T) {
 	}
 }
 
+func TestResolveAddrs(t *testing.T) {
+	resolver := StaticResolver{"foo.test": {net.IPv4(192, 0, 2, 1), net.ParseIP("2001:db8::1")}}
+	tests := []struct {
+		filter           Filter
+		network, address string
+		want             []string
+	}{
+		{nil, "tcp", "foo.test:http", []string{"192.0.2.1:80", "[2001:db8::1]:80"}},
+		{FilterFunc(DefaultFilter), "udp", "foo.test:53", []string{"192.0.2.1:53"}},
+		{nil, "tcp6", "foo.test:80", []string{"[2001:db8::1]:80"}},
+		{nil, "ip", "foo.test", []string{"192.0.2.1", "2001:db8::1"}},
+		{nil, "tcp", "[fe80::1%eth0]:80", []string{"[fe80::1%eth0]:80"}},
+		{nil, "unix", "/tmp/sock", []string{"/tmp/sock"}},
+	}
+	for _, tt := range tests {
+		addrs, err := ResolveAddrs(resolver, tt.filter, tt.network, tt.address)
+		if err != nil {
+			t.Errorf("%s %s: unexpected error: %v", tt.network, tt.address, err)
+			continue
+		}
+		var got []string
+		for _, addr := range addrs {
+			got = append(got, addr.String())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %s: expected %v; got %v", tt.network, tt.address, tt.want, got)
+		}
+	}
+	if _, err := ResolveAddrs(resolver, nil, "tcp", "bar.test:80"); err == nil {
+		t.Error("expected error resolving unknown host")
+	}
+}
+
 func TestCacheResolver(t *testing.T) {
-	defer func(lookupFn func(string) ([]net.IP, error), timeFn func() time.Time) {
+	defer func(lookupFn func(context.Context, string) ([]net.IP, error), timeFn func() time.Time) {
 		lookupIPs = lookupFn
 		timeNow = timeFn
 	}(lookupIPs, timeNow)
 	lookups := 0
 	ips := []net.IP{net.IPv6loopback}
-	lookupIPs = func(string) ([]net.IP, error) {
+	lookupIPs = func(context.Context, string) ([]net.IP, error) {
 		lookups++
 		return ips, nil
 	}
@@ -166,3 +194,62 @@ func TestCacheResolver(t *testing.T) {
 	validate("foo.com", 3)       // cached
 	validate("bar.net", 4)       // lookup bar.net
 }
+
+func TestCacheResolverMaxEntries(t *testing.T) {
+	defer func(fn func(context.Context, string) ([]net.IP, error)) {
+		lookupIPs = fn
+	}(lookupIPs)
+	lookupIPs = func(context.Context, string) ([]net.IP, error) {
+		return []net.IP{net.IPv6loopback}, nil
+	}
+	resolver := &CacheResolver{MaxEntries: 2}
+	for _, host := range []string{"foo.com", "bar.net", "foo.com", "baz.org"} {
+		if _, err := resolver.Resolve(host); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n := len(resolver.cache); n > resolver.MaxEntries {
+			t.Fatalf("cache size: expected at most %d; got %d", resolver.MaxEntries, n)
+		}
+	}
+	// foo.com was cached before bar.net and isn't stored again
+	// by a cache hit, so it's the first to be evicted.
+	for host, cached := range map[string]bool{"foo.com": false, "bar.net": true, "baz.org": true} {
+		if _, ok := resolver.cache[host]; ok != cached {
+			t.Errorf("%s: expected cached %v; got %v", host, cached, ok)
+		}
+	}
+}
+
+func TestCacheResolverNegativeTTL(t *testing.T) {
+	defer func(lookupFn func(context.Context, string) ([]net.IP, error), timeFn func() time.Time) {
+		lookupIPs = lookupFn
+		timeNow = timeFn
+	}(lookupIPs, timeNow)
+	lookups := 0
+	errNX := &net.DNSError{Err: "no such host", Name: "foo.com"}
+	lookupIPs = func(context.Context, string) ([]net.IP, error) {
+		lookups++
+		return nil, errNX
+	}
+	start := time.Now()
+	now := start
+	timeNow = func() time.Time { return now }
+	resolver := &CacheResolver{TTL: time.Minute, NegativeTTL: time.Second}
+	validate := func(expLookups int) {
+		if _, err := resolver.Resolve("foo.com"); err != errNX {
+			t.Fatalf("error: expected %v; got %v", errNX, err)
+		}
+		if lookups != expLookups {
+			t.Fatalf("lookups: expected %d; got %d", expLookups, lookups)
+		}
+	}
+	validate(1)                      // lookup foo.com
+	now = start.Add(time.Second / 2) //
+	validate(1)                      // cached failure
+	now = start.Add(time.Second)     // expire foo.com
+	validate(2)                      // lookup foo.com
+
+	resolver = &CacheResolver{TTL: time.Minute}
+	validate(3) // lookup foo.com
+	validate(4) // failures aren't cached
+}
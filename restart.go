@@ -0,0 +1,149 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// listenFdsEnv is the environment variable in which PassListeners
+// gives a child process the descriptors of its listeners. Groups of
+// descriptors, each of which is a MultiListener, are separated by
+// semicolons and the descriptors within a group by commas.
+const listenFdsEnv = "NETT_LISTEN_FDS"
+
+var errNoListenerFile = errors.New("listener has no file")
+
+// PassListeners passes lns to the child process started by cmd, such
+// as a new version of the program during a zero-downtime restart, so
+// that it can continue to accept connections on them. Each of lns may
+// be a *MultiListener, whose listeners are passed as a group, or a
+// KeepAliveListener or TrackingListener, whose Listener is passed.
+// The child reconstructs them with InheritListeners.
+//
+// The listeners' files are appended to cmd.ExtraFiles and described
+// in cmd.Env, which is initialized from the current environment if
+// it's nil. The files should be closed after cmd is started.
+//
+// The parent should close lns before cmd is started, which doesn't
+// affect the files. Starting cmd puts the sockets in blocking mode,
+// after which closing lns may block until a connection is accepted.
+// Connections that arrive in the meantime wait to be accepted by
+// the child.
+func PassListeners(cmd *exec.Cmd, lns ...net.Listener) error {
+	var env []byte
+	for i, ln := range lns {
+		files, err := listenerFiles(ln, nil)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			env = append(env, ';')
+		}
+		for j, f := range files {
+			if j > 0 {
+				env = append(env, ',')
+			}
+			// Extra files are given descriptors after
+			// standard input, output and error.
+			env = strconv.AppendInt(env, int64(3+len(cmd.ExtraFiles)), 10)
+			cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+		}
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	prefix := listenFdsEnv + "="
+	vars := cmd.Env[:0]
+	for _, v := range cmd.Env {
+		if len(v) < len(prefix) || v[:len(prefix)] != prefix {
+			vars = append(vars, v)
+		}
+	}
+	cmd.Env = append(vars, prefix+string(env))
+	return nil
+}
+
+// listenerFiles appends the files of the listeners of ln to files.
+func listenerFiles(ln net.Listener, files []*os.File) ([]*os.File, error) {
+	switch l := ln.(type) {
+	case *MultiListener:
+		for _, l := range l.lns {
+			var err error
+			if files, err = listenerFiles(l, files); err != nil {
+				return nil, err
+			}
+		}
+		return files, nil
+	case *KeepAliveListener:
+		return listenerFiles(l.Listener, files)
+	case *TrackingListener:
+		return listenerFiles(l.Listener, files)
+	case interface{ File() (*os.File, error) }:
+		f, err := l.File()
+		if err != nil {
+			return nil, err
+		}
+		return append(files, f), nil
+	}
+	return nil, &net.OpError{Op: "file", Net: ln.Addr().Network(), Addr: ln.Addr(), Err: errNoListenerFile}
+}
+
+// InheritListeners returns the listeners passed to the process by its
+// parent with PassListeners, in the order they were passed, each as a
+// MultiListener of its group. The wrappers of the parent's listeners,
+// such as a KeepAliveListener, aren't passed and should be applied
+// again. It returns nil if no listeners were passed. The environment
+// variable is unset so that the listeners aren't inherited by child
+// processes unless they're passed again.
+func InheritListeners() ([]*MultiListener, error) {
+	env := os.Getenv(listenFdsEnv)
+	if env == "" {
+		return nil, nil
+	}
+	os.Unsetenv(listenFdsEnv)
+	groups := splitAtBytes(env, ";")
+	mls := make([]*MultiListener, 0, len(groups))
+	var err error
+	for _, group := range groups {
+		var lns []net.Listener
+		for _, s := range splitAtBytes(group, ",") {
+			fd, i, ok := dtoi(s, 0)
+			if !ok || i != len(s) {
+				err = errors.New("invalid " + listenFdsEnv + ": " + env)
+				break
+			}
+			f := os.NewFile(uintptr(fd), "listener")
+			ln, lerr := net.FileListener(f)
+			f.Close()
+			if lerr != nil {
+				err = lerr
+				break
+			}
+			lns = append(lns, ln)
+		}
+		if err != nil || len(lns) == 0 {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			if err == nil {
+				err = errors.New("invalid " + listenFdsEnv + ": " + env)
+			}
+			break
+		}
+		mls = append(mls, NewMultiListener(lns...))
+	}
+	if err != nil {
+		for _, ml := range mls {
+			ml.Close()
+		}
+		return nil, err
+	}
+	return mls, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+)
+
+func TestPassListeners(t *testing.T) {
+	switch runtime.GOOS {
+	case "plan9", "windows":
+		t.Skipf("not supported on %s", runtime.GOOS)
+	}
+	ln1, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ln2, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ml := NewMultiListener(ln1, ln2)
+	defer ml.Close()
+	ln3, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln3.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestInheritListenersHelper$")
+	cmd.Env = append(os.Environ(), "NETT_TEST_HELPER=1", listenFdsEnv+"=stale")
+	if err := PassListeners(cmd, ml, &KeepAliveListener{Listener: ln3}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var n int
+	for _, v := range cmd.Env {
+		if len(v) > len(listenFdsEnv) && v[:len(listenFdsEnv)+1] == listenFdsEnv+"=" {
+			if v != listenFdsEnv+"=3,4;5" {
+				t.Fatalf("unexpected environment: %s", v)
+			}
+			n++
+		}
+	}
+	if n != 1 || len(cmd.ExtraFiles) != 3 {
+		t.Fatalf("unexpected command: %v, %v", cmd.Env, cmd.ExtraFiles)
+	}
+	// Stop accepting in the parent, so that the child accepts.
+	ml.Close()
+	ln3.Close()
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer cmd.Wait()
+	for _, f := range cmd.ExtraFiles {
+		f.Close()
+	}
+
+	r := bufio.NewReader(stdout)
+	if line, err := r.ReadString('\n'); err != nil || line != "ready\n" {
+		t.Fatalf("unexpected output: %q, %v", line, err)
+	}
+	for _, ln := range []net.Listener{ln1, ln2, ln3} {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		line, err := bufio.NewReader(c).ReadString('\n')
+		c.Close()
+		if want := fmt.Sprintf("hello from %s\n", ln.Addr()); err != nil || line != want {
+			t.Fatalf("expected %q; got %q, %v", want, line, err)
+		}
+	}
+}
+
+// TestInheritListenersHelper isn't a real test. It's run as the
+// child process of TestPassListeners.
+func TestInheritListenersHelper(t *testing.T) {
+	if os.Getenv("NETT_TEST_HELPER") != "1" {
+		return
+	}
+	mls, err := InheritListeners()
+	if err != nil || len(mls) != 2 || len(mls[0].Addrs()) != 2 || len(mls[1].Addrs()) != 1 {
+		fmt.Printf("unexpected listeners: %v, %v\n", mls, err)
+		os.Exit(1)
+	}
+	fmt.Println("ready")
+	for i := 0; i < 3; i++ {
+		ml := mls[0]
+		if i == 2 {
+			ml = mls[1]
+		}
+		c, err := ml.Accept()
+		if err != nil {
+			os.Exit(1)
+		}
+		fmt.Fprintf(c, "hello from %s\n", c.LocalAddr())
+		c.Close()
+	}
+	os.Exit(0)
+}
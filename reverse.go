@@ -0,0 +1,121 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"container/list"
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+var lookupAddrs = net.DefaultResolver.LookupAddr // used by tests
+
+// A ReverseResolver looks up the names of IP addresses with PTR
+// records, using the local resolver, and caches the results, such
+// as for enriching logs or checking access. Its methods are safe
+// for concurrent use.
+type ReverseResolver struct {
+	// TTL is the time to live for resolved addresses.
+	// If TTL is zero, cached addresses do not expire.
+	TTL time.Duration
+
+	// NegativeTTL is the time to live for addresses that failed
+	// to resolve. Cancelled lookups are not cached.
+	// If NegativeTTL is zero, failures are not cached.
+	NegativeTTL time.Duration
+
+	// MaxEntries is the maximum number of cached addresses.
+	// When the cache is full, the address that was resolved
+	// least recently is evicted.
+	// If MaxEntries is zero, the cache size is not limited.
+	MaxEntries int
+
+	mu    sync.Mutex
+	cache map[string]*reverseItem
+	order *list.List // of addresses, least recently resolved first
+}
+
+type reverseItem struct {
+	names []string
+	err   error // non-nil if the lookup failed
+	ttl   time.Time
+	elem  *list.Element
+}
+
+// LookupAddr returns the names of ip.
+func (r *ReverseResolver) LookupAddr(ip net.IP) ([]string, error) {
+	return r.LookupAddrContext(context.Background(), ip)
+}
+
+// LookupAddrContext returns the names of ip using the provided
+// context if ip is not cached.
+func (r *ReverseResolver) LookupAddrContext(ctx context.Context, ip net.IP) ([]string, error) {
+	addr := ip.String()
+	now := timeNow()
+	r.mu.Lock()
+	item, ok := r.cache[addr]
+	r.mu.Unlock()
+	if !ok || !item.ttl.IsZero() && !now.Before(item.ttl) {
+		names, err := lookupAddrs(ctx, addr)
+		switch {
+		case err == nil:
+			item = &reverseItem{names: names, ttl: expiry(now, r.TTL)}
+		case r.NegativeTTL > 0 && ctx.Err() == nil:
+			item = &reverseItem{err: err, ttl: now.Add(r.NegativeTTL)}
+		default:
+			return nil, err
+		}
+		r.mu.Lock()
+		r.store(addr, item)
+		r.mu.Unlock()
+	}
+	if item.err != nil {
+		return nil, item.err
+	}
+	names := make([]string, len(item.names))
+	copy(names, item.names)
+	return names, nil
+}
+
+// Invalidate removes the cached names of ip.
+func (r *ReverseResolver) Invalidate(ip net.IP) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	addr := ip.String()
+	if item, ok := r.cache[addr]; ok {
+		r.order.Remove(item.elem)
+		delete(r.cache, addr)
+	}
+}
+
+// store caches item for addr. If the cache is full, the least
+// recently stored address is evicted. It must be called with
+// r.mu held.
+func (r *ReverseResolver) store(addr string, item *reverseItem) {
+	if r.cache == nil {
+		r.cache = make(map[string]*reverseItem)
+		r.order = list.New()
+	}
+	if old, ok := r.cache[addr]; ok {
+		r.order.Remove(old.elem)
+	} else if r.MaxEntries > 0 && len(r.cache) >= r.MaxEntries {
+		oldest := r.order.Front()
+		r.order.Remove(oldest)
+		delete(r.cache, oldest.Value.(string))
+	}
+	item.elem = r.order.PushBack(addr)
+	r.cache[addr] = item
+}
+
+// expiry returns the time at which an entry cached at now with
+// the given TTL expires, or zero if the TTL is zero.
+func expiry(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
@@ -0,0 +1,53 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReverseResolver(t *testing.T) {
+	defer func(lookupFn func(context.Context, string) ([]string, error), timeFn func() time.Time) {
+		lookupAddrs = lookupFn
+		timeNow = timeFn
+	}(lookupAddrs, timeNow)
+	lookups := 0
+	errNX := errors.New("no such host")
+	lookupAddrs = func(_ context.Context, addr string) ([]string, error) {
+		lookups++
+		if addr == "192.0.2.1" {
+			return []string{"foo.test."}, nil
+		}
+		return nil, errNX
+	}
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+
+	r := &ReverseResolver{TTL: time.Minute, NegativeTTL: time.Second, MaxEntries: 1}
+	validate := func(ip net.IP, want []string, wantErr error, wantLookups int) {
+		names, err := r.LookupAddr(ip)
+		if err != wantErr || !reflect.DeepEqual(names, want) {
+			t.Fatalf("%v: expected %v, %v; got %v, %v", ip, want, wantErr, names, err)
+		}
+		if lookups != wantLookups {
+			t.Fatalf("lookups: expected %d; got %d", wantLookups, lookups)
+		}
+	}
+	foo, nx := net.IPv4(192, 0, 2, 1), net.IPv4(192, 0, 2, 2)
+	validate(foo, []string{"foo.test."}, nil, 1) // lookup
+	validate(foo, []string{"foo.test."}, nil, 1) // cached
+	now = now.Add(time.Minute)                   // expire
+	validate(foo, []string{"foo.test."}, nil, 2) // lookup
+	validate(nx, nil, errNX, 3)                  // lookup, evicts foo
+	validate(nx, nil, errNX, 3)                  // cached failure
+	validate(foo, []string{"foo.test."}, nil, 4) // lookup, evicts nx
+	r.Invalidate(foo)
+	validate(foo, []string{"foo.test."}, nil, 5) // lookup
+}
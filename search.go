@@ -0,0 +1,155 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// A SearchResolver resolves short host names, like "db" or
+// "api.prod", by appending search domains to them. It's useful
+// with resolvers that look up names literally, such as a
+// DNSResolver.
+//
+// A host with fewer dots than Ndots is resolved with each search
+// domain in order before falling back to the literal name. Other
+// hosts are resolved literally first. A host that ends with a dot
+// is only resolved literally.
+type SearchResolver struct {
+	// Resolver resolves the expanded host names.
+	// If Resolver is nil, DefaultResolver will be used.
+	Resolver Resolver
+
+	// Domains are the search domains. If Domains is nil, the
+	// search domains of the resolv.conf file are used.
+	Domains []string
+
+	// Ndots is the number of dots that a host must have to be
+	// resolved literally first. If Ndots is zero, the ndots option
+	// of the resolv.conf file is used, or 1 if it isn't set.
+	Ndots int
+
+	// ConfigPath is the path of the resolv.conf file.
+	// If empty, "/etc/resolv.conf" is used.
+	ConfigPath string
+
+	once       sync.Once
+	confDomain []string
+	confNdots  int
+}
+
+// Resolve returns a host's IP addresses.
+func (r *SearchResolver) Resolve(host string) ([]net.IP, error) {
+	return r.ResolveContext(context.Background(), "ip", host)
+}
+
+// ResolveContext returns a host's IP addresses using the
+// provided context.
+func (r *SearchResolver) ResolveContext(ctx context.Context, network, host string) ([]net.IP, error) {
+	addrs, err := r.ResolveAddrs(ctx, network, host)
+	return addrs.IPs, err
+}
+
+// ResolveAddrs returns a host's IP addresses using the provided
+// context with the metadata reported by Resolver. If none of the
+// names resolve, the error of the literal name is returned.
+func (r *SearchResolver) ResolveAddrs(ctx context.Context, network, host string) (Addrs, error) {
+	resolver := r.Resolver
+	if resolver == nil {
+		resolver = DefaultResolver
+	}
+	var literalErr error
+	for _, name := range r.names(host) {
+		addrs, err := resolveAddrs(ctx, resolver, network, name, nil)
+		if err == nil {
+			return addrs, nil
+		}
+		if ctx.Err() != nil {
+			return Addrs{}, err
+		}
+		if name == host {
+			literalErr = err
+		}
+	}
+	return Addrs{}, literalErr
+}
+
+// names returns the names to resolve for host in order.
+func (r *SearchResolver) names(host string) []string {
+	if host == "" || host[len(host)-1] == '.' {
+		return []string{host}
+	}
+	domains, ndots := r.Domains, r.Ndots
+	if domains == nil || ndots == 0 {
+		r.once.Do(r.readConfig)
+		if domains == nil {
+			domains = r.confDomain
+		}
+		if ndots == 0 {
+			ndots = r.confNdots
+		}
+	}
+	names := make([]string, 0, len(domains)+1)
+	literal := countAnyByte(host, ".") >= ndots
+	if literal {
+		names = append(names, host)
+	}
+	for _, domain := range domains {
+		if domain != "" && domain[len(domain)-1] == '.' {
+			domain = domain[:len(domain)-1]
+		}
+		if domain == "" {
+			continue
+		}
+		names = append(names, host+"."+domain)
+	}
+	if !literal {
+		names = append(names, host)
+	}
+	return names
+}
+
+// readConfig reads the search domains and ndots option of the
+// resolv.conf file. If it can't be read, there are no search
+// domains and ndots is 1.
+func (r *SearchResolver) readConfig() {
+	r.confNdots = 1
+	path := r.ConfigPath
+	if path == "" {
+		path = "/etc/resolv.conf"
+	}
+	f, err := open(path)
+	if err != nil {
+		return
+	}
+	defer f.close()
+	for line, ok := f.readLine(); ok; line, ok = f.readLine() {
+		if len(line) > 0 && (line[0] == ';' || line[0] == '#') {
+			continue // comment
+		}
+		fields := getFields(line)
+		if len(fields) < 1 {
+			continue
+		}
+		switch fields[0] {
+		case "domain", "search":
+			// The last of them wins.
+			r.confDomain = append([]string(nil), fields[1:]...)
+		case "options":
+			for _, opt := range fields[1:] {
+				if len(opt) > 6 && opt[:6] == "ndots:" {
+					if n, _, ok := dtoi(opt, 6); ok {
+						if n > 15 {
+							n = 15
+						}
+						r.confNdots = n
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSearchResolverNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nett")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "resolv.conf")
+	data := "# comment\nnameserver 192.0.2.53\ndomain ignored.test\nsearch a.test b.test.\noptions ndots:2 rotate\n"
+	if err := ioutil.WriteFile(conf, []byte(data), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		r    *SearchResolver
+		host string
+		want []string
+	}{
+		{&SearchResolver{ConfigPath: conf}, "db", []string{"db.a.test", "db.b.test", "db"}},
+		{&SearchResolver{ConfigPath: conf}, "api.prod", []string{"api.prod.a.test", "api.prod.b.test", "api.prod"}},
+		{&SearchResolver{ConfigPath: conf}, "a.b.c", []string{"a.b.c", "a.b.c.a.test", "a.b.c.b.test"}},
+		{&SearchResolver{ConfigPath: conf}, "db.", []string{"db."}},
+		{&SearchResolver{ConfigPath: conf, Ndots: 1}, "api.prod", []string{"api.prod", "api.prod.a.test", "api.prod.b.test"}},
+		{&SearchResolver{ConfigPath: conf, Domains: []string{"c.test"}}, "db", []string{"db.c.test", "db"}},
+		{&SearchResolver{ConfigPath: conf, Domains: []string{}}, "db", []string{"db"}},
+		{&SearchResolver{ConfigPath: filepath.Join(dir, "missing")}, "api.prod", []string{"api.prod"}},
+	}
+	for _, tt := range tests {
+		if got := tt.r.names(tt.host); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %q; got %q", tt.host, tt.want, got)
+		}
+	}
+}
+
+func TestSearchResolver(t *testing.T) {
+	static := StaticResolver{
+		"db.a.test": {net.IPv4(192, 0, 2, 1)},
+		"api.prod":  {net.IPv4(192, 0, 2, 2)},
+	}
+	r := &SearchResolver{Resolver: static, Domains: []string{"a.test"}}
+	for host, want := range map[string]net.IP{
+		"db":       net.IPv4(192, 0, 2, 1),
+		"api.prod": net.IPv4(192, 0, 2, 2),
+	} {
+		ips, err := r.Resolve(host)
+		if err != nil || len(ips) != 1 || !ips[0].Equal(want) {
+			t.Errorf("%q: expected [%v]; got %v, %v", host, want, ips, err)
+		}
+	}
+	// The error is reported for the literal name.
+	_, err := r.Resolve("nx")
+	if dnsErr, ok := err.(*net.DNSError); !ok || dnsErr.Name != "nx" {
+		t.Errorf("expected error for %q; got %v", "nx", err)
+	}
+
+	d, err := NewDialer(WithResolver(static), WithSearchDomains("a.test"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ips, err := d.Resolver.Resolve("db"); err != nil || len(ips) != 1 {
+		t.Fatalf("unexpected result: %v, %v", ips, err)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	canBindToDevice      = true
+	canSetTCPUserTimeout = false
+
+	sysIP_BOUND_IF   = 0x19
+	sysIPV6_BOUND_IF = 0x7d
+
+	sysTCP_KEEPINTVL = 0x101
+	sysTCP_KEEPCNT   = 0x102
+)
+
+// bindToDevice binds the socket of c to the named interface.
+func bindToDevice(network, name string, c syscall.RawConn) error {
+	ifi, err := interfaceByName(name)
+	if err != nil {
+		return err
+	}
+	level, opt := syscall.IPPROTO_IP, sysIP_BOUND_IF
+	if network[len(network)-1] == '6' {
+		level, opt = syscall.IPPROTO_IPV6, sysIPV6_BOUND_IF
+	}
+	if cerr := c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), level, opt, ifi.Index)
+	}); cerr != nil {
+		return cerr
+	}
+	return os.NewSyscallError("setsockopt", err)
+}
+
+// setKeepAliveProbes sets the interval in seconds between the
+// keep-alive probes of the socket of c and their count, if positive.
+func setKeepAliveProbes(c syscall.RawConn, interval, count int) error {
+	var err error
+	if cerr := c.Control(func(fd uintptr) {
+		if interval > 0 {
+			err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, sysTCP_KEEPINTVL, interval)
+		}
+		if err == nil && count > 0 {
+			err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, sysTCP_KEEPCNT, count)
+		}
+	}); cerr != nil {
+		return cerr
+	}
+	return os.NewSyscallError("setsockopt", err)
+}
+
+func setTCPUserTimeout(c syscall.RawConn, ms int) error {
+	return nil
+}
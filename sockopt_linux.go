@@ -0,0 +1,57 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	canBindToDevice      = true
+	canSetTCPUserTimeout = true
+
+	sysTCP_USER_TIMEOUT = 0x12
+)
+
+// bindToDevice binds the socket of c to the named interface.
+func bindToDevice(network, name string, c syscall.RawConn) error {
+	var err error
+	if cerr := c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, name)
+	}); cerr != nil {
+		return cerr
+	}
+	return os.NewSyscallError("setsockopt", err)
+}
+
+// setKeepAliveProbes sets the interval in seconds between the
+// keep-alive probes of the socket of c and their count, if positive.
+func setKeepAliveProbes(c syscall.RawConn, interval, count int) error {
+	var err error
+	if cerr := c.Control(func(fd uintptr) {
+		if interval > 0 {
+			err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, interval)
+		}
+		if err == nil && count > 0 {
+			err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, count)
+		}
+	}); cerr != nil {
+		return cerr
+	}
+	return os.NewSyscallError("setsockopt", err)
+}
+
+// setTCPUserTimeout sets the time in milliseconds that data
+// written to the socket of c may remain unacknowledged.
+func setTCPUserTimeout(c syscall.RawConn, ms int) error {
+	var err error
+	if cerr := c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, sysTCP_USER_TIMEOUT, ms)
+	}); cerr != nil {
+		return cerr
+	}
+	return os.NewSyscallError("setsockopt", err)
+}
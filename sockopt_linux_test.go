@@ -0,0 +1,127 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestKeepAliveConfig(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+
+	cfg := KeepAliveConfig{Idle: 10 * time.Second, Interval: 2500 * time.Millisecond, Count: 4}
+	d, err := NewDialer(WithKeepAliveConfig(cfg))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+	rc, err := c.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	opts := []struct {
+		name       string
+		level, opt int
+		want       int
+	}{
+		{"SO_KEEPALIVE", syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, 1},
+		{"TCP_KEEPIDLE", syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, 10},
+		{"TCP_KEEPINTVL", syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, 3},
+		{"TCP_KEEPCNT", syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, 4},
+	}
+	for _, o := range opts {
+		var got int
+		rc.Control(func(fd uintptr) {
+			got, err = syscall.GetsockoptInt(int(fd), o.level, o.opt)
+		})
+		if err != nil || got != o.want {
+			t.Errorf("%s: expected %d; got %d, %v", o.name, o.want, got, err)
+		}
+	}
+
+	if _, err := NewDialer(WithKeepAliveConfig(KeepAliveConfig{Count: -1})); err == nil {
+		t.Fatal("expected error for negative count")
+	}
+}
+
+func TestTCPUserTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+
+	d, err := NewDialer(WithTCPUserTimeout(1500 * time.Millisecond))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+	rc, err := c.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var ms int
+	rc.Control(func(fd uintptr) {
+		ms, err = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, sysTCP_USER_TIMEOUT)
+	})
+	if err != nil || ms != 1500 {
+		t.Fatalf("expected 1500ms; got %d, %v", ms, err)
+	}
+}
+
+func TestTrafficClass(t *testing.T) {
+	for _, network := range []string{"tcp4", "tcp6"} {
+		ln, err := net.Listen(network, "localhost:0")
+		if err != nil {
+			t.Logf("%s: skipping: %v", network, err)
+			continue
+		}
+		defer ln.Close()
+
+		d, err := NewDialer(WithTrafficClass(0x20))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		c, err := d.Dial(network, ln.Addr().String())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", network, err)
+		}
+		defer c.Close()
+		rc, err := c.(*net.TCPConn).SyscallConn()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		level, opt := syscall.IPPROTO_IP, syscall.IP_TOS
+		if network == "tcp6" {
+			level, opt = syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS
+		}
+		var class int
+		rc.Control(func(fd uintptr) {
+			class, err = syscall.GetsockoptInt(int(fd), level, opt)
+		})
+		if err != nil || class != 0x20 {
+			t.Errorf("%s: expected 0x20; got %#x, %v", network, class, err)
+		}
+	}
+
+	if _, err := NewDialer(WithTrafficClass(0x100)); err == nil {
+		t.Fatal("expected error for out of range class")
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !darwin,!linux
+
+package nett
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Sockets can't be bound to an interface on this platform,
+// so a local address of the interface is used instead.
+const canBindToDevice = false
+
+// TCP_USER_TIMEOUT is only supported on Linux.
+const canSetTCPUserTimeout = false
+
+func bindToDevice(network, name string, c syscall.RawConn) error {
+	return errors.New("binding to an interface is not supported")
+}
+
+// setKeepAliveProbes does nothing, since the interval between
+// keep-alive probes and their count can't be set on this platform.
+func setKeepAliveProbes(c syscall.RawConn, interval, count int) error {
+	return nil
+}
+
+func setTCPUserTimeout(c syscall.RawConn, ms int) error {
+	return nil
+}
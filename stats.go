@@ -0,0 +1,98 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// CacheStats is a snapshot of the counters of a CacheResolver,
+// such as for exporting to a metrics system.
+type CacheStats struct {
+	Hits      uint64 // lookups of fresh cached hosts
+	Misses    uint64 // lookups of hosts that weren't cached or had expired
+	Evictions uint64 // hosts evicted from a full cache
+	Errors    uint64 // failed lookups by the underlying Resolver
+	InFlight  int    // lookups by the underlying Resolver in progress
+	Entries   int    // hosts in the cache
+}
+
+// cacheStats counts the events of a CacheResolver.
+type cacheStats struct {
+	mu sync.Mutex
+	s  CacheStats
+}
+
+func (s *cacheStats) add(f func(s *CacheStats)) {
+	s.mu.Lock()
+	f(&s.s)
+	s.mu.Unlock()
+}
+
+// Stats returns a snapshot of the CacheResolver's counters.
+func (r *CacheResolver) Stats() CacheStats {
+	r.stats.mu.Lock()
+	s := r.stats.s
+	r.stats.mu.Unlock()
+	r.mu.RLock()
+	s.Entries = len(r.cache)
+	r.mu.RUnlock()
+	return s
+}
+
+// DialStats is a snapshot of the counters of a Dialer's connection
+// attempts, such as for exporting to a metrics system.
+type DialStats struct {
+	Attempts      uint64 // connection attempts
+	Successes     uint64 // attempts that connected
+	SuccessesIPv4 uint64 // attempts that connected to IPv4 addresses
+	SuccessesIPv6 uint64 // attempts that connected to IPv6 addresses
+	Failures      uint64 // attempts that failed or were canceled
+
+	// AvgLatency is the average duration of the attempts
+	// that connected.
+	AvgLatency time.Duration
+}
+
+// dialStats counts the connection attempts of a Dialer.
+type dialStats struct {
+	mu      sync.Mutex
+	s       DialStats
+	latency time.Duration // of all successful attempts
+}
+
+// record counts an attempt to dial ip that took elapsed.
+func (s *dialStats) record(ip net.IP, elapsed time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.s.Attempts++
+	if err != nil {
+		s.s.Failures++
+		return
+	}
+	s.s.Successes++
+	switch {
+	case ip == nil:
+	case ip.To4() != nil:
+		s.s.SuccessesIPv4++
+	default:
+		s.s.SuccessesIPv6++
+	}
+	s.latency += elapsed
+}
+
+// Stats returns a snapshot of the counters of the Dialer's
+// connection attempts. Connections to proxies are counted.
+func (d *Dialer) Stats() DialStats {
+	d.stats.mu.Lock()
+	defer d.stats.mu.Unlock()
+	s := d.stats.s
+	if s.Successes > 0 {
+		s.AvgLatency = d.stats.latency / time.Duration(s.Successes)
+	}
+	return s
+}
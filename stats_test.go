@@ -0,0 +1,59 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"net"
+	"testing"
+)
+
+func TestCacheResolverStats(t *testing.T) {
+	r := &CacheResolver{
+		Resolver:   StaticResolver{"a.test": {net.IPv4(192, 0, 2, 1)}, "b.test": {net.IPv4(192, 0, 2, 2)}},
+		MaxEntries: 1,
+	}
+	for _, host := range []string{"a.test", "a.test", "b.test", "nx.test"} {
+		r.Resolve(host)
+	}
+	want := CacheStats{Hits: 1, Misses: 3, Evictions: 1, Errors: 1, Entries: 1}
+	if s := r.Stats(); s != want {
+		t.Fatalf("expected %+v; got %+v", want, s)
+	}
+}
+
+func TestDialerStats(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	addr := ln.Addr().String()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	d := &Dialer{}
+	c, err := d.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Close()
+	ln.Close()
+	if _, err := d.Dial("tcp", addr); err == nil {
+		t.Fatal("expected error dialing closed listener")
+	}
+	s := d.Stats()
+	if s.Attempts != 2 || s.Successes != 1 || s.SuccessesIPv4 != 1 || s.SuccessesIPv6 != 0 || s.Failures != 1 {
+		t.Fatalf("unexpected counters: %+v", s)
+	}
+	if s.AvgLatency <= 0 {
+		t.Fatalf("AvgLatency: expected positive; got %v", s.AvgLatency)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"net"
+)
+
+// A ThrottledConn is a connection whose reads and writes are
+// limited by ByteLimiters, such as to cap the bandwidth used by
+// backups or replication. A limiter may be shared by many
+// connections to cap their combined bandwidth.
+type ThrottledConn struct {
+	net.Conn
+
+	// ReadLimiter, if non-nil, limits the rate of reads.
+	// A read is limited to the limiter's burst size and
+	// waits for the bytes it has read.
+	ReadLimiter ByteLimiter
+
+	// WriteLimiter, if non-nil, limits the rate of writes.
+	// A write waits for its bytes in chunks of up to the
+	// limiter's burst size before they're written.
+	WriteLimiter ByteLimiter
+}
+
+// Read reads data from the connection.
+func (c *ThrottledConn) Read(b []byte) (int, error) {
+	if c.ReadLimiter == nil {
+		return c.Conn.Read(b)
+	}
+	if burst := c.ReadLimiter.Burst(); len(b) > burst {
+		b = b[:burst]
+	}
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		if werr := c.ReadLimiter.WaitN(context.Background(), n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+// Write writes data to the connection.
+func (c *ThrottledConn) Write(b []byte) (int, error) {
+	if c.WriteLimiter == nil {
+		return c.Conn.Write(b)
+	}
+	burst := c.WriteLimiter.Burst()
+	var written int
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > burst {
+			chunk = chunk[:burst]
+		}
+		if err := c.WriteLimiter.WaitN(context.Background(), len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestThrottledConn(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	done := make(chan int64)
+	go func() {
+		n, _ := io.Copy(ioutil.Discard, c2)
+		done <- n
+	}()
+
+	// The first 100 bytes are a burst and the
+	// others take 100ms at 2000 bytes per second.
+	limiter := NewByteRate(2000, 100)
+	c := &ThrottledConn{Conn: c1, WriteLimiter: limiter}
+	start := time.Now()
+	if n, err := c.Write(make([]byte, 300)); n != 300 || err != nil {
+		t.Fatalf("unexpected result: %d, %v", n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("write took %v; expected at least 100ms", elapsed)
+	}
+	c1.Close()
+	if n := <-done; n != 300 {
+		t.Fatalf("read %d bytes; expected 300", n)
+	}
+
+	if err := limiter.WaitN(context.Background(), 101); err == nil {
+		t.Fatal("expected error exceeding burst")
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+)
+
+// DialTLS connects to the address on the named network and
+// performs a TLS handshake using config.
+//
+// See func Dialer.DialTLSContext for a description of the
+// config parameter.
+func (d *Dialer) DialTLS(network, address string, config *tls.Config) (*tls.Conn, error) {
+	return d.DialTLSContext(context.Background(), network, address, config)
+}
+
+// DialTLSContext connects to the address on the named network
+// using the provided context and performs a TLS handshake using
+// config. The Dialer's Timeout and Deadline and the context's
+// deadline bound both the connection and the handshake.
+//
+// A nil config is equivalent to the zero configuration. If its
+// ServerName is empty, the host of address is used.
+func (d *Dialer) DialTLSContext(ctx context.Context, network, address string, config *tls.Config) (*tls.Conn, error) {
+	if ctx == nil {
+		panic("nil context")
+	}
+	// Fix the deadline before dialing so that it covers the handshake.
+	if deadline := d.deadline(); !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	c, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	cfg := cloneTLSConfig(config)
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		cfg.ServerName = host
+	}
+	tc := tls.Client(c, cfg)
+	trace := d.trace(ctx)
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+	err = withConn(ctx, tc, tc.Handshake)
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		trace.TLSHandshakeDone(tc.ConnectionState(), err)
+	}
+	if err != nil {
+		c.Close()
+		return nil, newDialError(network, address, "handshake", c.RemoteAddr(), err)
+	}
+	return tc, nil
+}
+
+func cloneTLSConfig(cfg *tls.Config) *tls.Config {
+	if cfg == nil {
+		return &tls.Config{}
+	}
+	return cfg.Clone()
+}
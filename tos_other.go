@@ -0,0 +1,15 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package nett
+
+import "syscall"
+
+// setTrafficClass does nothing, since the type of service and
+// traffic class of sockets aren't set on this platform.
+func setTrafficClass(network string, c syscall.RawConn, class int) error {
+	return nil
+}
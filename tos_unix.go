@@ -0,0 +1,28 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package nett
+
+import (
+	"os"
+	"syscall"
+)
+
+// setTrafficClass sets the IPv4 type of service or IPv6 traffic
+// class of the socket of c, depending on the network's family.
+func setTrafficClass(network string, c syscall.RawConn, class int) error {
+	level, opt := syscall.IPPROTO_IP, syscall.IP_TOS
+	if network[len(network)-1] == '6' {
+		level, opt = syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS
+	}
+	var err error
+	if cerr := c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), level, opt, class)
+	}); cerr != nil {
+		return cerr
+	}
+	return os.NewSyscallError("setsockopt", err)
+}
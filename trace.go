@@ -0,0 +1,153 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+)
+
+// A DialTrace is a set of hooks that are called at each phase of
+// a dial, such as to create tracing spans around them, like the
+// ClientTrace of net/http/httptrace. Any of its hooks may be nil.
+// They may be called concurrently.
+type DialTrace struct {
+	// DNSStart is called when a host lookup begins.
+	// Literal IP addresses aren't looked up.
+	DNSStart func(host string)
+
+	// DNSDone is called when a host lookup ends with the resolved
+	// IP addresses, before they're filtered, and its error.
+	DNSDone func(host string, ips []net.IP, err error)
+
+	// ConnectStart is called when a connection attempt begins with
+	// the network and the resolved address. If more than one address
+	// is dialed, it may be called more than once.
+	ConnectStart func(network, addr string)
+
+	// ConnectDone is called when a connection attempt ends with the
+	// same arguments as ConnectStart and its error.
+	ConnectDone func(network, addr string, err error)
+
+	// TLSHandshakeStart is called when a TLS handshake begins.
+	TLSHandshakeStart func()
+
+	// TLSHandshakeDone is called when a TLS handshake ends with
+	// the state of the connection and its error.
+	TLSHandshakeDone func(state tls.ConnectionState, err error)
+}
+
+type dialTraceKey struct{}
+
+// WithDialTrace returns a copy of ctx with the trace, which is
+// used by the dials of a Dialer with the returned context. If ctx
+// already has a trace, its hooks are called after those of trace.
+func WithDialTrace(ctx context.Context, trace *DialTrace) context.Context {
+	if trace == nil {
+		panic("nil trace")
+	}
+	return context.WithValue(ctx, dialTraceKey{}, trace.compose(ContextDialTrace(ctx)))
+}
+
+// ContextDialTrace returns the DialTrace of ctx, or nil if it
+// doesn't have one.
+func ContextDialTrace(ctx context.Context) *DialTrace {
+	trace, _ := ctx.Value(dialTraceKey{}).(*DialTrace)
+	return trace
+}
+
+// trace returns the trace of a dial with ctx, whose hooks call
+// those of the context's trace and then those of the Dialer's
+// Trace, or nil if neither is set.
+func (d *Dialer) trace(ctx context.Context) *DialTrace {
+	return ContextDialTrace(ctx).compose(d.Trace)
+}
+
+// compose returns a trace whose hooks call those of t and then
+// those of old.
+func (t *DialTrace) compose(old *DialTrace) *DialTrace {
+	if t == nil {
+		return old
+	}
+	if old == nil {
+		return t
+	}
+	c := *t
+	if f, g := t.DNSStart, old.DNSStart; f == nil {
+		c.DNSStart = g
+	} else if g != nil {
+		c.DNSStart = func(host string) {
+			f(host)
+			g(host)
+		}
+	}
+	if f, g := t.DNSDone, old.DNSDone; f == nil {
+		c.DNSDone = g
+	} else if g != nil {
+		c.DNSDone = func(host string, ips []net.IP, err error) {
+			f(host, ips, err)
+			g(host, ips, err)
+		}
+	}
+	if f, g := t.ConnectStart, old.ConnectStart; f == nil {
+		c.ConnectStart = g
+	} else if g != nil {
+		c.ConnectStart = func(network, addr string) {
+			f(network, addr)
+			g(network, addr)
+		}
+	}
+	if f, g := t.ConnectDone, old.ConnectDone; f == nil {
+		c.ConnectDone = g
+	} else if g != nil {
+		c.ConnectDone = func(network, addr string, err error) {
+			f(network, addr, err)
+			g(network, addr, err)
+		}
+	}
+	if f, g := t.TLSHandshakeStart, old.TLSHandshakeStart; f == nil {
+		c.TLSHandshakeStart = g
+	} else if g != nil {
+		c.TLSHandshakeStart = func() {
+			f()
+			g()
+		}
+	}
+	if f, g := t.TLSHandshakeDone, old.TLSHandshakeDone; f == nil {
+		c.TLSHandshakeDone = g
+	} else if g != nil {
+		c.TLSHandshakeDone = func(state tls.ConnectionState, err error) {
+			f(state, err)
+			g(state, err)
+		}
+	}
+	return &c
+}
+
+// A traceResolver calls the DNS hooks of a trace around lookups.
+type traceResolver struct {
+	resolver Resolver
+	trace    *DialTrace
+}
+
+func (r traceResolver) Resolve(host string) ([]net.IP, error) {
+	return r.ResolveContext(context.Background(), "ip", host)
+}
+
+func (r traceResolver) ResolveContext(ctx context.Context, network, host string) ([]net.IP, error) {
+	if r.trace.DNSStart != nil {
+		r.trace.DNSStart(host)
+	}
+	resolver := r.resolver
+	if resolver == nil {
+		resolver = DefaultResolver
+	}
+	ips, err := resolveContext(ctx, resolver, network, host)
+	if r.trace.DNSDone != nil {
+		r.trace.DNSDone(host, ips, err)
+	}
+	return ips, err
+}
@@ -0,0 +1,95 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDialTrace(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer s.Close()
+	_, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+	addr := net.JoinHostPort("127.0.0.1", port)
+
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	record := func(prefix string) *DialTrace {
+		event := func(e string) {
+			mu.Lock()
+			events = append(events, prefix+e)
+			mu.Unlock()
+		}
+		return &DialTrace{
+			DNSStart: func(host string) { event("DNSStart " + host) },
+			DNSDone: func(host string, ips []net.IP, err error) {
+				if err != nil {
+					t.Errorf("DNSDone: unexpected error: %v", err)
+				}
+				event("DNSDone " + host)
+			},
+			ConnectStart: func(network, addr string) { event("ConnectStart " + addr) },
+			ConnectDone: func(network, addr string, err error) {
+				if err != nil {
+					t.Errorf("ConnectDone: unexpected error: %v", err)
+				}
+				event("ConnectDone " + addr)
+			},
+			TLSHandshakeStart: func() { event("TLSHandshakeStart") },
+			TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+				if err != nil || !state.HandshakeComplete {
+					t.Errorf("TLSHandshakeDone: unexpected result: %v, %v", state.HandshakeComplete, err)
+				}
+				event("TLSHandshakeDone")
+			},
+		}
+	}
+
+	d := &Dialer{
+		Timeout:  5 * time.Second,
+		Resolver: StaticResolver{"foo.test": {net.IPv4(127, 0, 0, 1)}},
+		Trace:    record("dialer "),
+	}
+	ctx := WithDialTrace(context.Background(), record("ctx "))
+	c, err := d.DialTLSContext(ctx, "tcp", net.JoinHostPort("foo.test", port), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.Write([]byte("GET / HTTP/1.0\r\n\r\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ioutil.ReadAll(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Close()
+
+	var want []string
+	for _, e := range []string{
+		"DNSStart foo.test",
+		"DNSDone foo.test",
+		"ConnectStart " + addr,
+		"ConnectDone " + addr,
+		"TLSHandshakeStart",
+		"TLSHandshakeDone",
+	} {
+		want = append(want, "ctx "+e, "dialer "+e)
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("events: expected %q; got %q", want, events)
+	}
+}
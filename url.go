@@ -0,0 +1,90 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nett
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/url"
+)
+
+var errURLScheme = errors.New("unsupported URL scheme")
+
+// urlSchemes maps URL schemes to their default ports and
+// whether they use TLS.
+var urlSchemes = map[string]struct {
+	port string
+	tls  bool
+}{
+	"http":  {"80", false},
+	"https": {"443", true},
+	"ws":    {"80", false},
+	"wss":   {"443", true},
+}
+
+// DialURL connects to the host of the URL. The schemes "http" and
+// "ws" are dialed on TCP, port 80 by default, and "https" and "wss"
+// are dialed on TCP, port 443 by default, followed by a TLS handshake
+// using config as by DialTLS. The schemes "tcp", "tcp4", "tcp6",
+// "udp", "udp4" and "udp6" name the network to dial and require a
+// port. The scheme "unix" dials the path of the URL on the unix
+// network, such as "unix:///var/run/app.sock".
+//
+// Config is only used for schemes that use TLS.
+func (d *Dialer) DialURL(u *url.URL, config *tls.Config) (net.Conn, error) {
+	return d.DialURLContext(context.Background(), u, config)
+}
+
+// DialURLContext connects to the host of the URL using the
+// provided context.
+//
+// See func DialURL for a description of the parameters.
+func (d *Dialer) DialURLContext(ctx context.Context, u *url.URL, config *tls.Config) (net.Conn, error) {
+	network, address, useTLS, err := urlAddress(u)
+	if err != nil {
+		// The URL's user info may hold a password
+		// and its path or query may hold tokens.
+		return nil, newDialError(network, u.Scheme+"://"+u.Host, "resolve", nil, err)
+	}
+	if useTLS {
+		return d.DialTLSContext(ctx, network, address, config)
+	}
+	return d.DialContext(ctx, network, address)
+}
+
+// urlAddress returns the network and address to dial for the URL
+// and whether the connection uses TLS.
+func urlAddress(u *url.URL) (network, address string, useTLS bool, err error) {
+	switch u.Scheme {
+	case "unix":
+		path := u.Path
+		if path == "" {
+			path = u.Opaque
+		}
+		if path == "" {
+			return "unix", "", false, ErrMissingAddress
+		}
+		return "unix", path, false, nil
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
+		if u.Port() == "" {
+			return u.Scheme, "", false, &net.AddrError{Err: "missing port in address", Addr: u.Host}
+		}
+		return u.Scheme, u.Host, false, nil
+	}
+	s, ok := urlSchemes[u.Scheme]
+	if !ok {
+		return "", "", false, errURLScheme
+	}
+	if u.Hostname() == "" {
+		return "tcp", "", false, ErrMissingAddress
+	}
+	port := u.Port()
+	if port == "" {
+		port = s.port
+	}
+	return "tcp", net.JoinHostPort(u.Hostname(), port), s.tls, nil
+}